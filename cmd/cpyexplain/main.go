@@ -0,0 +1,184 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command cpyexplain prints how values of a Go type are copied by a
+// cpy.Copier, which is the tree of plans reported by cpy.Copier.Plan:
+// every value within the type along with whether it is deep copied,
+// shared with the source, ignored (i.e., left as zero), or fails to copy.
+//
+// Usage:
+//
+//	cpyexplain [-config file] [-import path]... [-check] importpath.Type
+//
+// The Copier is constructed with cpy.FromConfig from the JSON encoding of a
+// cpy.Config read from the file provided by -config. Without -config, the
+// Copier returned by cpy.Default is explained. Profiles referenced by the
+// config must be registered by the packages provided by -import,
+// which are imported for their side effects.
+// With -check, problems reported by cpy.Copier.Check are also printed,
+// in which case cpyexplain exits with status 1.
+//
+// Since the type is only known by name, cpyexplain generates a helper
+// program that imports the package declaring the type and runs it with
+// "go run" in a temporary directory beneath the current directory.
+// It must thus be run within a module that requires the package declaring
+// the type and github.com/google/go-cpy. Only exported, non-generic types
+// can be explained.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// stringsFlag is a flag that may be provided multiple times.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string     { return strings.Join(*f, ",") }
+func (f *stringsFlag) Set(s string) error { *f = append(*f, s); return nil }
+
+func main() {
+	var imports stringsFlag
+	config := flag.String("config", "", "JSON file of a cpy.Config to construct the Copier from")
+	flag.Var(&imports, "import", "package to import for its side effects (may be repeated)")
+	check := flag.Bool("check", false, "report problems found by cpy.Copier.Check")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: cpyexplain [-config file] [-import path]... [-check] importpath.Type\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	h := helper{Imports: imports, Check: *check}
+	var err error
+	if h.Pkg, h.Name, err = splitTypeName(flag.Arg(0)); err != nil {
+		fatalf("%v", err)
+	}
+	if *config != "" {
+		b, err := os.ReadFile(*config)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		h.Config = string(b)
+	}
+	src, err := h.generate()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if err := run(src, os.Stdout, os.Stderr); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		fatalf("%v", err)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "cpyexplain: "+format+"\n", args...)
+	os.Exit(2)
+}
+
+// splitTypeName splits a fully-qualified type name (e.g., "time.Time" or
+// "example.com/pkg.Type") into the import path and the name of the type.
+func splitTypeName(s string) (pkg, name string, err error) {
+	i := strings.LastIndexByte(s, '.')
+	if i <= 0 || i == len(s)-1 || strings.LastIndexByte(s, '/') > i {
+		return "", "", fmt.Errorf("invalid type name %q; want an import path followed by a dot and a type name", s)
+	}
+	pkg, name = s[:i], s[i+1:]
+	if c := name[0]; c < 'A' || c > 'Z' {
+		return "", "", fmt.Errorf("type %q is not exported", s)
+	}
+	return pkg, name, nil
+}
+
+// helper describes the helper program that explains a type.
+type helper struct {
+	Pkg     string   // import path of the package declaring the type
+	Name    string   // name of the type
+	Config  string   // JSON encoding of a cpy.Config; empty for cpy.Default
+	Imports []string // packages imported for their side effects
+	Check   bool     // whether to report problems found by Copier.Check
+}
+
+var helperTemplate = template.Must(template.New("helper").Parse(`// Code generated by cpyexplain. DO NOT EDIT.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/google/go-cpy/cpy"
+	target {{printf "%q" .Pkg}}
+{{range .Imports}}	_ {{printf "%q" .}}
+{{end}})
+
+func main() {
+	c := cpy.Default()
+	if config := {{printf "%q" .Config}}; config != "" {
+		var cfg cpy.Config
+		if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "cpyexplain: invalid config: %v\n", err)
+			os.Exit(2)
+		}
+		var err error
+		if c, err = cpy.FromConfig(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "cpyexplain: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	t := reflect.TypeOf((*target.{{.Name}})(nil)).Elem()
+	fmt.Print(c.Plan(t))
+	if {{.Check}} {
+		if err := c.Check(t); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+}
+`))
+
+// generate returns the formatted source of the helper program.
+func (h helper) generate() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := helperTemplate.Execute(&buf, h); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// run runs the helper program with source src from a temporary directory
+// beneath the current directory, such that it is built within the current
+// module. The directory name begins with an underscore to exclude it from
+// package patterns such as "./..." while it exists.
+func run(src []byte, stdout, stderr io.Writer) error {
+	dir, err := os.MkdirTemp(".", "_cpyexplain")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), src, 0o644); err != nil {
+		return err
+	}
+	cmd := exec.Command("go", "run", "./"+filepath.ToSlash(dir))
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	return cmd.Run()
+}
@@ -0,0 +1,62 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestSplitTypeName(t *testing.T) {
+	tests := []struct {
+		in        string
+		pkg, name string
+		wantErr   bool
+	}{
+		{in: "time.Time", pkg: "time", name: "Time"},
+		{in: "example.com/pkg.Type", pkg: "example.com/pkg", name: "Type"},
+		{in: "gopkg.in/yaml.v3.Node", pkg: "gopkg.in/yaml.v3", name: "Node"},
+		{in: "Time", wantErr: true},
+		{in: "example.com/pkg", wantErr: true},
+		{in: "time.", wantErr: true},
+		{in: "sync.noCopy", wantErr: true},
+	}
+	for _, tt := range tests {
+		pkg, name, err := splitTypeName(tt.in)
+		if gotErr := err != nil; gotErr != tt.wantErr || pkg != tt.pkg || name != tt.name {
+			t.Errorf("splitTypeName(%q) = (%q, %q, %v), want (%q, %q, error=%v)", tt.in, pkg, name, err, tt.pkg, tt.name, tt.wantErr)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	h := helper{Pkg: "strings", Name: "Builder", Check: true}
+	src, err := h.generate()
+	if err != nil {
+		t.Fatalf("generate() error: %v", err)
+	}
+	var stdout, stderr bytes.Buffer
+	err = run(src, &stdout, &stderr)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("run() error: %v, want exit status 1\n%s", err, stderr.String())
+	}
+	for _, want := range []string{
+		"strings.Builder: deep\n",
+		"\t.buf []uint8: ignore\n",
+		"cpy.Check: ",
+		"strings.Builder.buf: unexported field is ignored",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, stdout.String())
+		}
+	}
+}
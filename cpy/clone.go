@@ -0,0 +1,186 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Clone returns a copy of v using the default Copier (see Default)
+// extended with opts, which take precedence over its options.
+// It is equivalent to CloneWith(Default().With(opts...), v),
+// or CloneWith(Default(), v) if no options are provided.
+// Options thus add to the default configuration rather than replace it
+// (e.g., unexported fields remain ignored when adding MaxDepth).
+//
+// Since initializing a Copier with additional options is relatively
+// expensive, it is recommended that CloneWith be used with a Copier
+// stored in a global variable for values that are copied frequently.
+func Clone[T any](v T, opts ...Option) T {
+	if len(opts) == 0 {
+		return CloneWith(Default(), v)
+	}
+	return CloneWith(Default().With(opts...), v)
+}
+
+// ClonePtr returns a deep copy of the value that p points to
+// using the default Copier extended with opts, or nil if p is nil.
+// It is equivalent to Clone(p, opts...).
+//
+// Example usage:
+//
+//	var cfg *Config = ...
+//	snapshot := cpy.ClonePtr(cfg, cpy.MaxDepth(32)) // snapshot is a *Config
+func ClonePtr[T any](p *T, opts ...Option) *T {
+	if p == nil {
+		return nil
+	}
+	return Clone(p, opts...)
+}
+
+// CloneWith returns a copy of v according to the Copier presets.
+// It copies v in the same way as Copier.Copy, but statically preserves
+// the type of v, such that no type assertion is needed.
+// If T is an interface type, then the dynamic value of v is copied.
+//
+// Values of types that need no deep copy (e.g., int or a struct of only
+// strings) are returned as is without allocating.
+//
+// Example usage:
+//
+//	var copier = cpy.New(cpy.IgnoreAllUnexported())
+//
+//	dst := cpy.CloneWith(copier, src) // dst has the same type as src
+func CloneWith[T any](c *Copier, v T) T {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if len(c.traces) == 0 && len(c.middleware) == 0 && c.isPlain(t) {
+		return v
+	}
+	src, dst := v, new(T) // avoid moving v to the heap in the fast path above
+	reflect.ValueOf(dst).Elem().Set(c.copyRoot(context.Background(), "Clone", reflect.ValueOf(&src).Elem(), nil, nil))
+	return *dst
+}
+
+// CloneAll returns a copy of the slice vs according to the Copier presets,
+// where every element is deep copied into a new slice.
+// It is equivalent to CloneWith(c, vs), but documents the intent to
+// copy a large homogeneous slice: how values of type T are copied
+// is resolved once for all elements rather than once per element.
+//
+// Example usage:
+//
+//	var copier = cpy.New(cpy.IgnoreAllUnexported())
+//
+//	dst := cpy.CloneAll(copier, records) // dst is a []Record
+func CloneAll[T any](c *Copier, vs []T) []T {
+	return CloneWith(c, vs)
+}
+
+// TypedCopier copies values of type T.
+// It must be obtained using CopierFor.
+type TypedCopier[T any] struct {
+	c     *Copier
+	plain bool // whether values are returned as is
+}
+
+// CopierFor returns a TypedCopier for values of type T initialized with opts.
+// Unlike Copier.Copy, TypedCopier.Copy statically preserves the type of
+// the value without any interface conversions or type assertions.
+// How values of type T are copied is resolved once up front.
+//
+// Example usage:
+//
+//	var configCopier = cpy.CopierFor[*Config](cpy.IgnoreAllUnexported())
+//
+//	snapshot := configCopier.Copy(cfg) // snapshot is a *Config
+func CopierFor[T any](opts ...Option) *TypedCopier[T] {
+	c := New(opts...)
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	return &TypedCopier[T]{c: c, plain: len(c.traces) == 0 && len(c.middleware) == 0 && c.isPlain(t)}
+}
+
+// Copier returns the underlying Copier.
+func (tc *TypedCopier[T]) Copier() *Copier {
+	return tc.c
+}
+
+// Copy returns a copy of v. It is equivalent to CloneWith(tc.Copier(), v).
+func (tc *TypedCopier[T]) Copy(v T) T {
+	if tc.plain {
+		return v
+	}
+	src, dst := v, new(T)
+	reflect.ValueOf(dst).Elem().Set(tc.c.copyRoot(context.Background(), "Copy", reflect.ValueOf(&src).Elem(), nil, nil))
+	return *dst
+}
+
+// Compiled copies values of a single type
+// with all options resolved ahead of time.
+// It must be obtained using Compile.
+type Compiled struct {
+	c  *Copier
+	t  reflect.Type
+	ti *typeInfo
+}
+
+// Compile returns a Compiled copier for values of type t initialized with opts.
+// It is the non-generic counterpart of CopierFor for types only known at
+// runtime. How values of type t and all types reachable from t are copied
+// is resolved once up front (see Copier.Precompile), such that copying
+// a value does not pay for resolving any options.
+//
+// Example usage:
+//
+//	var configCopier = cpy.Compile(reflect.TypeOf(Config{}), cpy.IgnoreAllUnexported())
+//
+//	snapshot := configCopier.Copy(cfg).(Config)
+func Compile(t reflect.Type, opts ...Option) *Compiled {
+	if t == nil {
+		panic("cpy.Compile: type must not be nil")
+	}
+	c := New(opts...)
+	c.precompile(t, make(map[reflect.Type]bool))
+	return &Compiled{c: c, t: t, ti: c.typeInfo(t)}
+}
+
+// Copier returns the underlying Copier.
+func (cc *Compiled) Copier() *Copier {
+	return cc.c
+}
+
+// Type returns the type of values copied by cc.
+func (cc *Compiled) Type() reflect.Type {
+	return cc.t
+}
+
+// Copy returns a copy of v, which must be a value of the compiled type
+// or, if the compiled type is an interface type, implement it.
+func (cc *Compiled) Copy(v interface{}) interface{} {
+	vt := reflect.TypeOf(v)
+	switch {
+	case vt == cc.t:
+		return cc.CopyValue(reflect.ValueOf(v)).Interface()
+	case cc.t.Kind() == reflect.Interface && vt != nil && vt.Implements(cc.t):
+		src := reflect.New(cc.t).Elem()
+		src.Set(reflect.ValueOf(v))
+		return cc.CopyValue(src).Interface()
+	default:
+		panic(fmt.Sprintf("cpy.Compiled.Copy: cannot copy %T with a copier compiled for %v", v, cc.t))
+	}
+}
+
+// CopyValue returns a copy of v, which must be a value of the compiled type.
+func (cc *Compiled) CopyValue(v reflect.Value) reflect.Value {
+	if !v.IsValid() || v.Type() != cc.t {
+		panic(fmt.Sprintf("cpy.Compiled.CopyValue: cannot copy %v with a copier compiled for %v", v, cc.t))
+	}
+	if len(cc.c.traces) > 0 || len(cc.c.middleware) > 0 || cc.c.preserveAliasing {
+		return cc.c.copyRoot(context.Background(), "Copy", v, nil, nil)
+	}
+	s := state{Copier: cc.c, root: cc.t}
+	return s.copyWith(v, cc.ti)
+}
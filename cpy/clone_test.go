@@ -0,0 +1,144 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cpy/cpy"
+)
+
+func TestClone(t *testing.T) {
+	src := &S{S: "hello", Pt: &S{S: "world"}, Sl: []M1{{A: 1}}}
+	got := cpy.Clone(src, cpy.IgnoreAllUnexported())
+	if diff := cmp.Diff(src, got, cmp.AllowUnexported(S{}, M{}, M1{}, M2{})); diff != "" {
+		t.Errorf("Clone() mismatch (-want +got):\n%s", diff)
+	}
+	if got == src || got.Pt == src.Pt {
+		t.Errorf("Clone() shares memory with the source")
+	}
+
+	if got := cpy.ClonePtr(src, cpy.IgnoreAllUnexported()); got == src || got.Pt == src.Pt || got.Pt.S != "world" {
+		t.Errorf("ClonePtr() = %v, want copy of %v", got, src)
+	}
+	if got := cpy.ClonePtr[S](nil); got != nil {
+		t.Errorf("ClonePtr(nil) = %v, want nil", got)
+	}
+
+	copier := cpy.New(cpy.IgnoreAllUnexported())
+	var p Proto = &M{A: 1}
+	if got := cpy.CloneWith(copier, p); got.(*M) == p.(*M) || got.(*M).A != 1 {
+		t.Errorf("CloneWith(%T) = %v, want copy of %v", p, got, p)
+	}
+	if got := cpy.CloneWith[Proto](copier, nil); got != nil {
+		t.Errorf("CloneWith(nil) = %v, want nil", got)
+	}
+
+	card := Card{Number: "1234", Holder: "Gopher"}
+	if allocs := testing.AllocsPerRun(100, func() { card = cpy.CloneWith(copier, card) }); allocs > 0 {
+		t.Errorf("CloneWith(%T) allocations = %v, want 0", card, allocs)
+	}
+}
+
+func TestCloneOptions(t *testing.T) {
+	// Options extend the default Copier, which ignores unexported fields.
+	src := &Order{ID: 1, Payments: []*Payment{{Card: Card{Number: "1"}}}, note: "note"}
+	got := cpy.Clone(src, cpy.MaxDepth(16))
+	if got == src || got.Payments[0] == src.Payments[0] || got.ID != 1 || got.note != "" {
+		t.Errorf("Clone() = %+v, want deep copy without unexported fields", got)
+	}
+	if got := cpy.ClonePtr(src, cpy.Shallow(&Payment{})); got.Payments[0] != src.Payments[0] {
+		t.Errorf("ClonePtr() did not apply Shallow option")
+	}
+}
+
+func TestCloneAllocs(t *testing.T) {
+	type Counter struct{ N int }
+	copier := cpy.New(cpy.IgnoreAllUnexported())
+	counters := cpy.CopierFor[Counter](cpy.IgnoreAllUnexported())
+	c := Counter{N: 1}
+	tests := []struct {
+		name  string
+		clone func()
+	}{
+		{"Clone", func() { c = cpy.Clone(c) }},
+		{"CloneWith", func() { c = cpy.CloneWith(copier, c) }},
+		{"TypedCopier.Copy", func() { c = counters.Copy(c) }},
+	}
+	for _, tt := range tests {
+		if allocs := testing.AllocsPerRun(100, tt.clone); allocs > 0 {
+			t.Errorf("%v(%T) allocations = %v, want 0", tt.name, c, allocs)
+		}
+	}
+}
+
+func TestCloneAll(t *testing.T) {
+	copier := cpy.New(cpy.IgnoreAllUnexported())
+	src := make([]Order, 100)
+	for i := range src {
+		src[i] = Order{ID: i, Payments: []*Payment{{Card: Card{Number: fmt.Sprint(i)}}}}
+	}
+	got := cpy.CloneAll(copier, src)
+	if diff := cmp.Diff(src, got, cmp.AllowUnexported(Order{})); diff != "" {
+		t.Errorf("CloneAll() mismatch (-want +got):\n%s", diff)
+	}
+	for i := range src {
+		if got[i].Payments[0] == src[i].Payments[0] {
+			t.Fatalf("CloneAll()[%d] shares memory with the source", i)
+		}
+	}
+	if got := cpy.CloneAll[Order](copier, nil); got != nil {
+		t.Errorf("CloneAll(nil) = %v, want nil", got)
+	}
+}
+
+func TestCopierFor(t *testing.T) {
+	var _ interface{ Copy(*S) *S } = cpy.CopierFor[*S](cpy.IgnoreAllUnexported())
+
+	copier := cpy.CopierFor[*S](cpy.IgnoreAllUnexported())
+	src := &S{S: "hello", Pt: &S{S: "world"}}
+	got := copier.Copy(src)
+	if diff := cmp.Diff(src, got, cmp.AllowUnexported(S{}, M{}, M1{}, M2{})); diff != "" {
+		t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+	}
+	if got == src || got.Pt == src.Pt {
+		t.Errorf("Copy() shares memory with the source")
+	}
+
+	cards := cpy.CopierFor[Card](cpy.IgnoreAllUnexported())
+	card := Card{Number: "1234", Holder: "Gopher"}
+	if allocs := testing.AllocsPerRun(100, func() { card = cards.Copy(card) }); allocs > 0 {
+		t.Errorf("Copy(%T) allocations = %v, want 0", card, allocs)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	copier := cpy.Compile(reflect.TypeOf(&S{}), cpy.IgnoreAllUnexported())
+	src := &S{S: "hello", Pt: &S{S: "world"}}
+	got := copier.Copy(src).(*S)
+	if diff := cmp.Diff(src, got, cmp.AllowUnexported(S{}, M{}, M1{}, M2{})); diff != "" {
+		t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+	}
+	if got == src || got.Pt == src.Pt {
+		t.Errorf("Copy() shares memory with the source")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Copy(%T) did not panic", S{})
+			}
+		}()
+		copier.Copy(S{})
+	}()
+
+	stringers := cpy.Compile(reflect.TypeOf((*fmt.Stringer)(nil)).Elem(), cpy.IgnoreAllUnexported())
+	if got := stringers.Copy(time.Second); got != time.Second {
+		t.Errorf("Copy() = %v, want %v", got, time.Second)
+	}
+}
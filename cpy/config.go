@@ -0,0 +1,171 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Config is a declarative configuration for a Copier.
+// It allows copiers to be constructed from configuration files or by
+// dependency injection frameworks, where the behavior of a copier
+// may vary per deployment without changes to Go code.
+//
+// Options that cannot be expressed declaratively (e.g., Func) are
+// provided by registering them as a named profile with RegisterProfile.
+type Config struct {
+	// Profiles is a list of names of profiles registered with RegisterProfile.
+	// The options of latter profiles take precedence over former profiles.
+	Profiles []string `json:"profiles,omitempty"`
+
+	// IgnoreAllUnexported specifies the IgnoreAllUnexported option.
+	IgnoreAllUnexported bool `json:"ignoreAllUnexported,omitempty"`
+
+	// NormalizeNumbers specifies the NormalizeNumbers option.
+	NormalizeNumbers bool `json:"normalizeNumbers,omitempty"`
+
+	// UnsafeFieldAccess specifies the UnsafeFieldAccess option.
+	UnsafeFieldAccess bool `json:"unsafeFieldAccess,omitempty"`
+
+	// ShallowTypes is a list of fully-qualified names of types
+	// that are shallow copied (see ShallowNamed).
+	ShallowTypes []string `json:"shallowTypes,omitempty"`
+
+	// ImmutableTypes is a list of fully-qualified names of types
+	// that are never mutated (see ImmutableNamed).
+	ImmutableTypes []string `json:"immutableTypes,omitempty"`
+
+	// ShallowPackages is a list of package patterns whose types
+	// are shallow copied (see ShallowPackages).
+	ShallowPackages []string `json:"shallowPackages,omitempty"`
+
+	// Kinds is a mapping from the name of a kind (as reported by
+	// reflect.Kind.String, e.g., "chan" or "map") to the policy for copying
+	// all values of that kind, which is one of the following:
+	//
+	// • "shallow" to shallow copy the values,
+	//
+	// • "zero" to leave the values as zero in the copy, or
+	//
+	// • "deep" to copy the values according to the default behavior,
+	// which disregards policies for the kind provided by profiles.
+	//
+	// Policies follow the same precedence as KindFunc.
+	Kinds map[string]string `json:"kinds,omitempty"`
+}
+
+var profiles struct {
+	sync.Mutex
+	m map[string][]Option
+}
+
+// RegisterProfile registers a named set of options,
+// which can be referenced by name in Config.Profiles.
+// It is intended to be called from an init function.
+// It panics if a profile of the same name is already registered.
+func RegisterProfile(name string, opts ...Option) {
+	profiles.Lock()
+	defer profiles.Unlock()
+	if _, ok := profiles.m[name]; ok {
+		panic(fmt.Sprintf("cpy.RegisterProfile: profile %q is already registered", name))
+	}
+	if profiles.m == nil {
+		profiles.m = make(map[string][]Option)
+	}
+	profiles.m[name] = append([]Option(nil), opts...)
+}
+
+// FromConfig constructs a new Copier according to cfg.
+// The options of all profiles are applied before any other options in cfg.
+// It reports an error if cfg references an unregistered profile or
+// if the resulting set of options is invalid.
+func FromConfig(cfg Config) (*Copier, error) {
+	var opts []Option
+	profiles.Lock()
+	for _, name := range cfg.Profiles {
+		popts, ok := profiles.m[name]
+		if !ok {
+			profiles.Unlock()
+			return nil, fmt.Errorf("cpy.FromConfig: unknown profile %q", name)
+		}
+		opts = append(opts, popts...)
+	}
+	profiles.Unlock()
+
+	if cfg.IgnoreAllUnexported {
+		opts = append(opts, IgnoreAllUnexported())
+	}
+	if cfg.NormalizeNumbers {
+		opts = append(opts, NormalizeNumbers())
+	}
+	if cfg.UnsafeFieldAccess {
+		opts = append(opts, UnsafeFieldAccess())
+	}
+	for _, names := range [][]string{cfg.ShallowTypes, cfg.ImmutableTypes} {
+		for _, name := range names {
+			if err := checkTypeName(name); err != nil {
+				return nil, fmt.Errorf("cpy.FromConfig: %v", err)
+			}
+		}
+	}
+	if len(cfg.ShallowTypes) > 0 {
+		opts = append(opts, ShallowNamed(cfg.ShallowTypes...))
+	}
+	if len(cfg.ImmutableTypes) > 0 {
+		opts = append(opts, ImmutableNamed(cfg.ImmutableTypes...))
+	}
+	for _, p := range cfg.ShallowPackages {
+		if p == "" || p == "..." {
+			return nil, fmt.Errorf("cpy.FromConfig: invalid package pattern %q", p)
+		}
+	}
+	if len(cfg.ShallowPackages) > 0 {
+		opts = append(opts, ShallowPackages(cfg.ShallowPackages...))
+	}
+	kinds := make([]string, 0, len(cfg.Kinds))
+	for name := range cfg.Kinds {
+		kinds = append(kinds, name)
+	}
+	sort.Strings(kinds) // for deterministic options
+	for _, name := range kinds {
+		opt, err := kindPolicy(name, cfg.Kinds[name])
+		if err != nil {
+			return nil, fmt.Errorf("cpy.FromConfig: %v", err)
+		}
+		opts = append(opts, opt)
+	}
+	c, err := newCopier(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// kindPolicy returns the option for the policy of the named kind
+// (see Config.Kinds).
+func kindPolicy(name, policy string) (Option, error) {
+	k := reflect.Invalid
+	for k2 := reflect.Bool; k2 <= reflect.UnsafePointer; k2++ {
+		if k2.String() == name {
+			k = k2
+		}
+	}
+	if k == reflect.Invalid {
+		return nil, fmt.Errorf("unknown kind %q", name)
+	}
+	switch policy {
+	case "shallow":
+		return ShallowIf(func(t reflect.Type) bool { return t.Kind() == k }), nil
+	case "zero":
+		return KindFunc(k, func(c *Copier, v reflect.Value) reflect.Value { return reflect.Zero(v.Type()) }), nil
+	case "deep":
+		return KindFunc(k, func(c *Copier, v reflect.Value) reflect.Value { return reflect.Value{} }), nil
+	default:
+		return nil, fmt.Errorf("unknown policy %q for kind %v", policy, name)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy_test
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-cpy/cpy"
+)
+
+func init() {
+	cpy.RegisterProfile("stdlib", cpy.Shallow(time.Time{}))
+	cpy.RegisterProfile("shareSlices", cpy.ShallowIf(func(t reflect.Type) bool { return t.Kind() == reflect.Slice }))
+}
+
+func TestFromConfig(t *testing.T) {
+	var cfg cpy.Config
+	if err := json.Unmarshal([]byte(`{"profiles": ["stdlib"], "ignoreAllUnexported": true}`), &cfg); err != nil {
+		t.Fatalf("json.Unmarshal error: %v", err)
+	}
+	copier, err := cpy.FromConfig(cfg)
+	if err != nil {
+		t.Fatalf("FromConfig() error: %v", err)
+	}
+	if got := copier.Copy(S{Ti: now}).(S).Ti; !got.Equal(now) {
+		t.Errorf("S.Ti = %v, want %v", got, now)
+	}
+
+	if _, err := cpy.FromConfig(cpy.Config{Profiles: []string{"unknown"}, IgnoreAllUnexported: true}); err == nil {
+		t.Errorf("FromConfig() with unknown profile succeeded, want error")
+	}
+	if _, err := cpy.FromConfig(cpy.Config{Profiles: []string{"stdlib"}}); err == nil {
+		t.Errorf("FromConfig() without unexported policy succeeded, want error")
+	}
+}
+
+func TestFromConfigTypes(t *testing.T) {
+	var cfg cpy.Config
+	if err := json.Unmarshal([]byte(`{
+		"profiles": ["shareSlices"],
+		"ignoreAllUnexported": true,
+		"shallowTypes": ["github.com/google/go-cpy/cpy_test.M1"],
+		"immutableTypes": ["time.Time"],
+		"shallowPackages": ["archive/..."],
+		"kinds": {"map": "zero", "slice": "deep"}
+	}`), &cfg); err != nil {
+		t.Fatalf("json.Unmarshal error: %v", err)
+	}
+	copier, err := cpy.FromConfig(cfg)
+	if err != nil {
+		t.Fatalf("FromConfig() error: %v", err)
+	}
+	src := S{
+		Sl:  []M1{{A: 1, a: 1}},
+		Ma1: map[string]M1{"a": {A: 2}},
+		St:  tar.Header{Name: "file"},
+		PTi: &now,
+	}
+	got := copier.Copy(src).(S)
+	if got.Sl[0] != src.Sl[0] || &got.Sl[0] == &src.Sl[0] {
+		t.Errorf("S.Sl = %v, want deep copied slice of shallow copied M1 values", got.Sl)
+	}
+	if got.Ma1 != nil {
+		t.Errorf("S.Ma1 = %v, want nil", got.Ma1)
+	}
+	if got.St.Name != "file" || got.PTi != src.PTi {
+		t.Errorf("S.St or S.PTi was not shared")
+	}
+
+	for _, cfg := range []cpy.Config{
+		{ShallowTypes: []string{"M1"}},
+		{ImmutableTypes: []string{"time."}},
+		{ShallowPackages: []string{"..."}},
+		{Kinds: map[string]string{"pointer": "zero"}},
+		{Kinds: map[string]string{"map": "copy"}},
+	} {
+		cfg.IgnoreAllUnexported = true
+		if _, err := cpy.FromConfig(cfg); err == nil {
+			t.Errorf("FromConfig(%+v) succeeded, want error", cfg)
+		}
+	}
+}
@@ -8,7 +8,28 @@
 // It is designed with performance in mind and is suitable for production use.
 // By design, it does not handle unexported fields. If such fields need copying,
 // it is the responsibility of the user to provide a custom copy function
-// to specify how a specific type should be copied.
+// to specify how a specific type should be copied
+// (or to permit copying them with AllowUnexportedPackages).
+//
+// How a struct field is copied may be specified next to its declaration
+// with a cpy struct tag (or a tag of another key, see TagName),
+// which takes precedence over all options for the type of the field:
+//
+//	type Session struct {
+//		Cache  map[string][]byte `cpy:"-"`       // skipped and left as zero
+//		Logger *log.Logger       `cpy:"shallow"` // shared with the source
+//		Config *Config           `cpy:"deep"`    // deep copied even if *Config is Shallow
+//	}
+//
+// A field tagged "deep" (and the value it points to, if it is a pointer)
+// is copied according to the default behavior,
+// but options still apply to the elements of its value.
+// A field tagged "redact" is left as zero or set to a placeholder
+// (see RedactTag).
+// Fields of type uintptr that hold handles or pointers (e.g., in structs
+// passed to system calls) are copied bit for bit, which shares the handle.
+// Tag them "-" to leave them as zero, or use FieldFunc to duplicate
+// or release the handle in the copy.
 //
 // WARNING: This package's API is currently unstable and may change without
 // warning. If this matters to you, you should wait until version
@@ -16,30 +37,289 @@
 package cpy
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
+	"runtime"
+	"sort"
+	"strings"
 	"sync"
 )
 
 // A Copier copies Go objects.
+//
+// A Copier is safe for concurrent use by multiple goroutines.
+// Its internal caches are populated once per type and are thereafter
+// read without any locking, such that concurrent copies scale with
+// the number of available CPUs.
 type Copier struct {
 	// concFuncs is a list of copy functions that operate on concrete types.
-	concFuncs []reflect.Value // []func(T) T
+	concFuncs []rule // []func(T) T
 
 	// ifaceFuncs is a list of copy functions that operate on interface types.
-	ifaceFuncs []reflect.Value // []func(I) I
+	ifaceFuncs []rule // []func(I) I
 
-	// lookupFuncCache is a mapping from reflect.Type
-	// to a reflect.Value representing a function operating on that type.
-	lookupFuncCache sync.Map // map[reflect.Type]reflect.Value
-
-	// exportedFieldsCache is a mapping from reflect.Type
-	// to a list of exported struct field indexes.
-	exportedFieldsCache sync.Map // map[reflect.Type][]int
+	// planCache holds the information cached about every type,
+	// which may be shared with other Copiers (see planCaches).
+	*planCache
 
 	// ignoreAllUnexported specifies whether to ignore unxported fields
 	// as opposed to panicking when encountering them.
 	ignoreAllUnexported bool
+
+	// copyUnexported is the set of struct types whose unexported fields
+	// are copied using unsafe (see CopyUnexported).
+	copyUnexported map[reflect.Type]bool
+
+	// ignoreUnexported is the set of struct types whose
+	// unexported fields are ignored (see IgnoreUnexported).
+	ignoreUnexported map[reflect.Type]bool
+
+	// ignoreUnexportedPackages is a list of package patterns for which
+	// the unexported fields of struct types are ignored (see PointerModels).
+	ignoreUnexportedPackages []string
+
+	// immutableTypes is the set of types whose values are never mutated.
+	immutableTypes map[reflect.Type]bool
+
+	// immutableNames is the set of fully-qualified names of types
+	// whose values are never mutated (see ImmutableNamed).
+	immutableNames map[string]bool
+
+	// normalizeNumbers specifies whether to normalize numeric values
+	// held within interface types.
+	normalizeNumbers bool
+
+	// jsonFastPath specifies whether trees of map[string]interface{} and
+	// []interface{} may be copied without reflection.
+	jsonFastPath bool
+
+	// traces is a list of functions to call at the start of every copy.
+	traces []func(op string, t reflect.Type) func(Stats)
+
+	// middleware is a list of functions wrapping the copy of every value,
+	// where the first is the outermost.
+	middleware []middlewareFunc
+
+	// unsafeFieldAccess specifies whether to access struct fields
+	// using unsafe rather than through reflect.Value.Field.
+	unsafeFieldAccess bool
+
+	// unexportedPackages is a list of package patterns for which
+	// unexported fields are copied using unsafe.
+	unexportedPackages []string
+
+	// iterators specifies how iterator functions are copied.
+	iterators IteratorPolicy
+
+	// priorities is the set of distinct priorities of all rules
+	// in descending order.
+	priorities []int
+
+	// matchers is a list of options that copy all types matching
+	// a condition when no Func or Shallow option applies,
+	// in order of precedence.
+	matchers []matcher
+
+	// trackPaths specifies whether to track the path to the current value,
+	// which is only needed if a copy function accepts a Path.
+	trackPaths bool
+
+	// substitutes is a mapping from the dynamic type of a value held in
+	// an interface to the type that the copy is converted to.
+	substitutes map[reflect.Type]reflect.Type
+
+	// rebinds is a mapping from an interface type and the dynamic type
+	// of a value held within it to a function that rebinds the copied value.
+	rebinds map[rebindKey]reflect.Value // func(X) I
+
+	// opts is the list of options that the Copier was initialized with.
+	opts []Option
+
+	// matchFields specifies whether CopyInto may copy between
+	// values of different types (see MatchFields).
+	matchFields bool
+
+	// convertTypes specifies whether CopyInto may convert values
+	// between convertible types (see ConvertTypes).
+	convertTypes bool
+
+	// flattenPointers specifies whether CopyInto may copy pointers
+	// into values of the type they point to (see FlattenPointers).
+	flattenPointers bool
+
+	// boxValues specifies whether CopyInto may copy values
+	// into new pointers to them (see BoxValues).
+	boxValues bool
+
+	// matchTags is a list of struct tag keys whose names fields are
+	// matched by when copying between struct types, in order of precedence
+	// (see MatchTags).
+	matchTags []string
+
+	// registeredTypes is a list of concrete types that CopyInto may copy
+	// values held in interfaces into, in order of precedence
+	// (see RegisterTypes).
+	registeredTypes []reflect.Type
+
+	// reuse specifies whether CopyInto reuses the storage
+	// of the destination (see ReuseDestination).
+	reuse bool
+
+	// preserveAliasing specifies whether identity of pointers
+	// is preserved within every copy (see PreserveAliasing).
+	preserveAliasing bool
+
+	// onError is called for every value that cannot be copied
+	// and decides how to proceed; nil to always panic (see OnError).
+	onError func(error) Action
+
+	// onUnexported decides how unexported fields that are not copied
+	// are handled; nil if not specified (see OnUnexported).
+	onUnexported func(reflect.Type, reflect.StructField) Action
+
+	// tagName is the key of struct tags that configure
+	// how a field is copied (see TagName).
+	tagName string
+
+	// redactTags is a list of struct tag keys and values
+	// of fields that are redacted (see RedactTag).
+	redactTags [][2]string
+
+	// placeholders is a mapping from reflect.Type to the value
+	// that redacted fields of that type are set to (see Placeholders).
+	placeholders map[reflect.Type]reflect.Value
+
+	// skipPaths is a list of paths to fields that are skipped
+	// (see SkipPaths).
+	skipPaths []fieldPath
+
+	// onlyPaths is a list of paths to fields that are the only ones
+	// copied from values of the types at the start of the paths
+	// (see OnlyPaths).
+	onlyPaths []fieldPath
+
+	// pathRules and pathMatchers are the rules and matchers that only
+	// apply to values at paths matching a filter (see FilterPath),
+	// where the first takes precedence.
+	pathRules    []rule
+	pathMatchers []matcher
+
+	// maxDepth, maxNodes, and maxBytes are the limits of a single copy;
+	// 0 if unlimited (see MaxDepth, MaxNodes, and MaxBytes).
+	maxDepth, maxNodes int
+	maxBytes           int64
+
+	// transformers is a mapping from reflect.Type to the function
+	// applied to copies of values of that type (see Transformer).
+	transformers map[reflect.Type]reflect.Value
+
+	// fieldFuncs is a list of functions that rewrite the copies of fields
+	// at specific paths, where the first takes precedence (see FieldFunc).
+	fieldFuncs []fieldFunc
+
+	// pathFields is the set of names of the last fields of all
+	// paths provided to SkipPaths or FieldFunc.
+	pathFields map[string]bool
+
+	// onlyTypes and onlyFields are the sets of names of types and
+	// all fields but the first in paths provided to OnlyPaths.
+	onlyTypes, onlyFields map[string]bool
+}
+
+// planCache holds the information that a Copier caches about how values
+// of every type are copied, all of which is determined by its options.
+type planCache struct {
+	// typeInfoCache is a mapping from reflect.Type
+	// to information about how values of that type are copied.
+	typeInfoCache sync.Map // map[reflect.Type]*typeInfo
+
+	// structLayoutCache is a mapping from reflect.Type
+	// to a list of steps for copying a struct using unsafe.
+	structLayoutCache sync.Map // map[reflect.Type][]layoutStep
+
+	// allowedFieldsCache is a mapping from reflect.Type to the indexes
+	// of unexported fields in that struct type which are copied.
+	allowedFieldsCache sync.Map // map[reflect.Type][]int
+
+	// unexportedActionsCache is a mapping from reflect.Type to the
+	// actions decided by onUnexported for each field of that struct type.
+	unexportedActionsCache sync.Map // map[reflect.Type][]Action
+
+	// fieldTagsCache is a mapping from reflect.Type to the parsed tags
+	// of all fields in that struct type.
+	fieldTagsCache sync.Map // map[reflect.Type][]fieldTag
+
+	// fieldPairsCache is a mapping from a destination and a source
+	// struct type to the pairs of fields copied between them.
+	fieldPairsCache sync.Map // map[[2]reflect.Type][]fieldPair
+
+	// concreteTypesCache is a mapping from a destination interface type
+	// and a source type to the registered type that values are copied into.
+	concreteTypesCache sync.Map // map[[2]reflect.Type]reflect.Type
+}
+
+// planCaches is a mapping from the fingerprint of a list of options
+// to the planCache shared by all Copiers initialized with equivalent options,
+// such that Copiers constructed repeatedly (e.g., for every request)
+// do not each resolve how every type is copied anew.
+// Entries are never evicted, so the number of entries is bounded
+// by maxPlanCaches to avoid growing without limit for programs that
+// construct Copiers from dynamic configuration (e.g., FromConfig).
+var (
+	planCachesMu sync.Mutex
+	planCaches   map[string]*planCache
+)
+
+// maxPlanCaches is the maximum number of distinct configurations
+// whose caches are shared, beyond which every Copier has its own caches.
+const maxPlanCaches = 256
+
+// sharedPlanCache returns the planCache shared by Copiers with options of
+// the fingerprint fp, which is pc if there is none yet.
+func sharedPlanCache(fp string, pc *planCache) *planCache {
+	planCachesMu.Lock()
+	defer planCachesMu.Unlock()
+	if pc2, ok := planCaches[fp]; ok {
+		return pc2
+	}
+	if len(planCaches) < maxPlanCaches {
+		if planCaches == nil {
+			planCaches = make(map[string]*planCache)
+		}
+		planCaches[fp] = pc
+	}
+	return pc
+}
+
+// fingerprint returns a key identifying the configuration that results
+// from the options in leaves, or false if the options cannot be compared.
+// Options providing functions (e.g., Func, KindFunc, If, or Middleware)
+// cannot be compared, since closures may behave differently despite
+// sharing the same code. Options providing types are identified by the
+// types themselves, and rules by their call site (see rule.String) so that
+// errors and descriptions still refer to the options of the Copier.
+func fingerprint(leaves []option) (string, bool) {
+	var sb strings.Builder
+	for _, opt := range leaves {
+		if len(opt.matchers) > 0 || len(opt.traces) > 0 || len(opt.middleware) > 0 ||
+			opt.onError != nil || opt.onUnexported != nil || len(opt.fieldFuncs) > 0 ||
+			len(opt.transformers) > 0 || len(opt.rebinds) > 0 || len(opt.placeholders) > 0 {
+			return "", false
+		}
+		for _, r := range opt.rules {
+			if r.strategy == Custom || r.inPlace || len(r.conds) > 0 || len(r.paths) > 0 {
+				return "", false
+			}
+			fmt.Fprintf(&sb, "%p %v %v %v;", r.typ, r, r.strategy, r.structural)
+		}
+		opt.rules = nil
+		fmt.Fprintf(&sb, "%#v\n", opt) // types are printed as pointers
+	}
+	return sb.String(), true
 }
 
 // New initializes a new Copier according to the provided options.
@@ -57,23 +337,105 @@ type Copier struct {
 //
 // It is recommended that the Copier returned by New
 // be stored in a global variable so that it can be reused.
+// Copiers initialized with equivalent options share the information
+// cached about how values of every type are copied, unless the options
+// provide functions (e.g., Func, KindFunc, or Middleware), such that
+// constructing a Copier repeatedly with options such as Shallow, Immutable,
+// or IgnoreAllUnexported from the same place in the code is inexpensive.
+// The shared information (including the types it refers to) is retained
+// for the lifetime of the program, for at most 256 distinct configurations;
+// Copiers with any other configuration cache information of their own.
 func New(opts ...Option) *Copier {
-	// Process options in reverse order since latter arguments take precedence.
-	// Separate out functions that operate on concrete and interface types.
-	var c Copier
-	for i := len(opts) - 1; i >= 0; i-- {
-		opt := opts[i]
-		for _, fnc := range opt.copyFuncs {
-			if fnc.Type().In(0).Kind() != reflect.Interface {
-				c.concFuncs = append(c.concFuncs, fnc)
-			} else {
-				c.ifaceFuncs = append(c.ifaceFuncs, fnc)
-			}
-		}
-		if opt.ignoreAllUnexported {
-			c.ignoreAllUnexported = true
+	c, err := newCopier(opts)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// With returns a new Copier initialized with the options of c
+// followed by opts, such that opts take precedence over the options of c.
+// It is equivalent to calling New with both lists of options.
+//
+// If opts do not affect how types are resolved (e.g., they only consist of
+// Trace, Middleware, or NormalizeNumbers options), then the new Copier
+// inherits all information that c has cached about previously copied types.
+// Options operating on types (e.g., Func, Shallow, or Immutable)
+// require that such information is resolved anew.
+func (c *Copier) With(opts ...Option) *Copier {
+	c2 := New(append(c.opts[:len(c.opts):len(c.opts)], opts...)...)
+	if c2.planCache == c.planCache {
+		return c2 // already shared (see planCaches)
+	}
+	for _, opt := range flattenOptions(opts) {
+		if opt.affectsTypes() {
+			return c2
 		}
 	}
+	caches := []struct{ dst, src *sync.Map }{
+		{&c2.typeInfoCache, &c.typeInfoCache},
+		{&c2.allowedFieldsCache, &c.allowedFieldsCache},
+	}
+	if (len(c2.middleware) > 0) == (len(c.middleware) > 0) {
+		// Struct layouts depend on whether there is middleware.
+		caches = append(caches, struct{ dst, src *sync.Map }{&c2.structLayoutCache, &c.structLayoutCache})
+	}
+	for _, m := range caches {
+		m.src.Range(func(k, v interface{}) bool {
+			m.dst.Store(k, v)
+			return true
+		})
+	}
+	return c2
+}
+
+// Join returns a new Copier initialized with the options of every
+// provided Copier in order. Options are resolved as if they were passed to
+// a single call of New, such that options of a later Copier take precedence
+// over options of an earlier Copier (e.g., a Func for the same type).
+// Options wrapped by Override still take precedence regardless of order.
+// Use Copier.Conflicts to report options shadowed as a result of joining.
+//
+// Example usage:
+//
+//	var copier = cpy.Join(storage.Copier, billing.Copier, cpy.New(
+//		cpy.Shallow(time.Time{}), // application-wide option
+//	))
+func Join(cs ...*Copier) *Copier {
+	var opts []Option
+	for _, c := range cs {
+		opts = append(opts, c.opts...)
+	}
+	return New(opts...)
+}
+
+// NewStrict is identical to New, but reports every problem with opts
+// as an error instead of panicking. In addition to the problems reported
+// by New, it reports every option that is never used because it is
+// shadowed by another option (see Copier.Conflicts).
+func NewStrict(opts ...Option) (*Copier, error) {
+	c, err := newCopier(opts)
+	var msgs []string
+	if err != nil {
+		msgs = append(msgs, err.Error())
+		c, _ = resolveOptions(opts)
+	}
+	for _, err := range c.Conflicts() {
+		msgs = append(msgs, err.Error())
+	}
+	switch len(msgs) {
+	case 0:
+		return c, nil
+	case 1:
+		return nil, fmt.Errorf("cpy.NewStrict: %v", msgs[0])
+	default:
+		return nil, fmt.Errorf("cpy.NewStrict: %d problems:\n\t%v", len(msgs), strings.Join(msgs, "\n\t"))
+	}
+}
+
+// newCopier initializes a new Copier according to the provided options.
+func newCopier(opts []Option) (*Copier, error) {
+	c, leaves := resolveOptions(opts)
 
 	// TODO: There is no obviously right behavior to take with regard to
 	// unexported fields in a struct. Possible approaches:
@@ -140,11 +502,203 @@ func New(opts ...Option) *Copier {
 	// backwards compatible with deepcopy, which it seeks to replace.
 	//
 	// See the discussion on cl/333563483 for more details.
-	if !c.ignoreAllUnexported {
-		panic("cpy.IgnoreAllUnexported must be specified; this requirement may change in the future")
+	if !c.ignoreAllUnexported && len(c.ignoreUnexported) == 0 && len(c.ignoreUnexportedPackages) == 0 && c.onError == nil && c.onUnexported == nil {
+		return nil, errors.New("cpy.IgnoreAllUnexported must be specified; this requirement may change in the future")
+	}
+
+	c.planCache = new(planCache)
+	if fp, ok := fingerprint(leaves); ok {
+		c.planCache = sharedPlanCache(fp, c.planCache)
+	}
+	c.jsonFastPath = c.canCopyJSONFast()
+	return c, nil
+}
+
+// resolveOptions initializes a new Copier according to the provided options
+// without checking them, which must only be used to inspect the options.
+// It also returns the leaves of opts (see flattenOptions).
+func resolveOptions(opts []Option) (*Copier, []option) {
+	// Process options in reverse order since latter arguments take precedence.
+	// Separate out functions that operate on concrete and interface types.
+	c := Copier{opts: append([]Option(nil), opts...)}
+	leaves := flattenOptions(opts)
+	for i := len(leaves) - 1; i >= 0; i-- {
+		opt := leaves[i]
+		for _, r := range opt.rules {
+			r.priority = opt.priority
+			r.structural = r.structural || opt.structural
+			if ft := r.fnc.Type(); ft.NumIn() > 1 && ft.In(ft.NumIn()-2) == pathType {
+				c.trackPaths = true
+			}
+			switch {
+			case len(r.paths) > 0:
+				c.pathRules = append(c.pathRules, r)
+				c.trackPaths = true
+			case r.typ.Kind() != reflect.Interface:
+				c.concFuncs = append(c.concFuncs, r)
+			default:
+				c.ifaceFuncs = append(c.ifaceFuncs, r)
+			}
+		}
+		if opt.ignoreAllUnexported {
+			c.ignoreAllUnexported = true
+		}
+		for _, t := range opt.copyUnexported {
+			if c.copyUnexported == nil {
+				c.copyUnexported = make(map[reflect.Type]bool)
+			}
+			c.copyUnexported[t] = true
+		}
+		for _, t := range opt.ignoreUnexported {
+			if c.ignoreUnexported == nil {
+				c.ignoreUnexported = make(map[reflect.Type]bool)
+			}
+			c.ignoreUnexported[t] = true
+		}
+		c.ignoreUnexportedPackages = append(c.ignoreUnexportedPackages, opt.ignoredPackages...)
+		for _, t := range opt.immutableTypes {
+			if c.immutableTypes == nil {
+				c.immutableTypes = make(map[reflect.Type]bool)
+			}
+			c.immutableTypes[t] = true
+		}
+		for _, name := range opt.immutableNames {
+			if c.immutableNames == nil {
+				c.immutableNames = make(map[string]bool)
+			}
+			c.immutableNames[name] = true
+		}
+		if opt.normalizeNumbers {
+			c.normalizeNumbers = true
+		}
+		c.traces = append(append([]func(string, reflect.Type) func(Stats){}, opt.traces...), c.traces...)
+		c.middleware = append(append([]middlewareFunc{}, opt.middleware...), c.middleware...)
+		if opt.trackPaths {
+			c.trackPaths = true
+		}
+		if opt.unsafeFieldAccess {
+			c.unsafeFieldAccess = true
+		}
+		if opt.matchFields {
+			c.matchFields = true
+		}
+		if opt.convertTypes {
+			c.convertTypes = true
+		}
+		if opt.flattenPointers {
+			c.flattenPointers = true
+		}
+		if opt.boxValues {
+			c.boxValues = true
+		}
+		c.matchTags = append(c.matchTags, opt.matchTags...)
+		for i := len(opt.registeredTypes) - 1; i >= 0; i-- {
+			c.registeredTypes = append(c.registeredTypes, opt.registeredTypes[i])
+		}
+		if opt.reuse {
+			c.reuse = true
+		}
+		if opt.preserveAliasing {
+			c.preserveAliasing = true
+		}
+		if opt.onError != nil {
+			c.onError = opt.onError
+		}
+		if opt.onUnexported != nil {
+			c.onUnexported = opt.onUnexported
+		}
+		if opt.tagName != "" && c.tagName == "" {
+			c.tagName = opt.tagName
+		}
+		for _, p := range opt.skipPaths {
+			if c.pathFields == nil {
+				c.pathFields = make(map[string]bool)
+			}
+			c.pathFields[p.fields[len(p.fields)-1]] = true
+			c.trackPaths = true
+		}
+		c.skipPaths = append(c.skipPaths, opt.skipPaths...)
+		for _, ff := range opt.fieldFuncs {
+			if c.pathFields == nil {
+				c.pathFields = make(map[string]bool)
+			}
+			c.pathFields[ff.path.fields[len(ff.path.fields)-1]] = true
+			c.trackPaths = true
+		}
+		c.fieldFuncs = append(c.fieldFuncs, opt.fieldFuncs...)
+		if opt.maxDepth > 0 && c.maxDepth == 0 {
+			c.maxDepth = opt.maxDepth
+		}
+		if opt.maxNodes > 0 && c.maxNodes == 0 {
+			c.maxNodes = opt.maxNodes
+		}
+		if opt.maxBytes > 0 && c.maxBytes == 0 {
+			c.maxBytes = opt.maxBytes
+		}
+		for _, fn := range opt.transformers {
+			if c.transformers == nil {
+				c.transformers = make(map[reflect.Type]reflect.Value)
+			}
+			if t := fn.Type().In(0); !c.transformers[t].IsValid() {
+				c.transformers[t] = fn
+			}
+		}
+		c.redactTags = append(c.redactTags, opt.redactTags...)
+		for _, v := range opt.placeholders {
+			if c.placeholders == nil {
+				c.placeholders = make(map[reflect.Type]reflect.Value)
+			}
+			if _, ok := c.placeholders[v.Type()]; !ok {
+				c.placeholders[v.Type()] = v
+			}
+		}
+		for _, p := range opt.onlyPaths {
+			if c.onlyTypes == nil {
+				c.onlyTypes, c.onlyFields = make(map[string]bool), make(map[string]bool)
+			}
+			c.onlyTypes[p.typ] = true
+			for _, name := range p.fields[1:] {
+				c.onlyFields[name] = true
+			}
+			c.trackPaths = true
+		}
+		c.onlyPaths = append(c.onlyPaths, opt.onlyPaths...)
+		c.unexportedPackages = append(c.unexportedPackages, opt.unexportedPackages...)
+		if opt.iterators != 0 && c.iterators == 0 {
+			c.iterators = opt.iterators
+		}
+		for _, m := range opt.matchers {
+			if len(m.paths) > 0 {
+				c.pathMatchers = append(c.pathMatchers, m)
+				c.trackPaths = true
+			} else {
+				c.matchers = append(c.matchers, m)
+			}
+		}
+		for _, fn := range opt.rebinds {
+			if c.rebinds == nil {
+				c.rebinds = make(map[rebindKey]reflect.Value)
+			}
+			k := rebindKey{iface: fn.Type().Out(0), conc: fn.Type().In(0)}
+			if _, ok := c.rebinds[k]; !ok {
+				c.rebinds[k] = fn
+			}
+		}
+		for from, to := range opt.substitutes {
+			if c.substitutes == nil {
+				c.substitutes = make(map[reflect.Type]reflect.Type)
+			}
+			if _, ok := c.substitutes[from]; !ok {
+				c.substitutes[from] = to
+			}
+		}
+	}
+	if c.tagName == "" {
+		c.tagName = defaultTagName
 	}
 
-	return &c
+	c.priorities = rulePriorities(c.concFuncs, c.ifaceFuncs)
+	return &c, leaves
 }
 
 // Copy copies v according to the Copier presets.
@@ -159,6 +713,15 @@ func New(opts ...Option) *Copier {
 // Funcs that operate on interface types, then the behavior listed below.
 // For Funcs operating on the same type, those passed later to New
 // take precedence over any preceding Func arguments.
+// A Func operating on T takes precedence over a Func operating on *T.
+// A Func matching a type only through Structural is used only if
+// no Func operating on a concrete type matches exactly.
+// Shallow is implemented in terms of Func and follows the same rules,
+// such that a Shallow and a Func for the same type are resolved
+// according to which of the two options was passed later to New.
+// Funcs wrapped by Override (or Priority) take precedence over all Funcs
+// of a lower priority (even those that operate on concrete types) and are
+// resolved among each other according to the same rules.
 //
 // • Pointers are copied by allocating a new value of the same type and
 // recursively calling Copy on the pointed-at value.
@@ -171,6 +734,8 @@ func New(opts ...Option) *Copier {
 // of the same type (with the same length and capacity for slices).
 // Every element in the source is recursively copied by calling Copy and
 // storing the result into the destination array or slice.
+// Non-nil slices with zero capacity are shared with the source since
+// appending to such a slice always allocates a new array.
 //
 // • Maps are copied by making a new map of the same type and
 // recursively calling Copy on each map key and map value in the source and
@@ -181,6 +746,8 @@ func New(opts ...Option) *Copier {
 // storing the result into the destination struct. It panics when trying
 // to copy a struct type with unexported fields unless an IgnoreAllUnexported
 // option was passed to New, in which case unexported fields are ignored.
+// Unexported fields permitted by AllowUnexportedPackages are copied
+// in the same way as exported fields.
 // Alternatively, a custom Func may be specified to provide a specialized
 // implemention of deep-copying for the type with unexported fields based
 // on the exported API for that type.
@@ -188,249 +755,2444 @@ func New(opts ...Option) *Copier {
 // • Lastly, all other types (e.g., int, string, etc.) are shallow copied.
 // Note that unsafe.Pointer and channels are shallow copied since there is
 // no obvious behavior to use to deep copy such types.
+// Functions are shallow copied as well, except for iterator functions
+// when an Iterators option specifies otherwise.
 //
 // The output type is guaranteed to be the same as the input type.
 // Copy will panic if that invariant is violated by a provided Func.
-// Copy presently does not handle cycles in the value and will overflow.
+// Use CopyE to report values that cannot be copied as errors instead.
+//
+// Cyclic values reachable through pointers (e.g., a doubly-linked list)
+// are only copied if PreserveAliasing is specified. Otherwise, Copy panics
+// with an error wrapping ErrCycle once a pointer is reached again while
+// copying the value it points to, unless OnError decides otherwise.
+// Cycles through maps, slices, or interfaces only, without any pointer,
+// are not detected and overflow the stack (unless bounded by MaxDepth).
 func (c *Copier) Copy(v interface{}) interface{} {
 	if v == nil {
 		return nil
 	}
-	return c.copy(reflect.ValueOf(v)).Interface()
+	return c.copyRoot(context.Background(), "Copy", reflect.ValueOf(v), nil, nil).Interface()
 }
-func (c *Copier) copy(src reflect.Value) (dst reflect.Value) {
-	t := src.Type()
 
-	// Return zero values as is.
-	if src.IsZero() {
-		return src
+// CopyInto copies src into the value that dst points to,
+// replacing its previous contents entirely.
+// The dst argument must be a non-nil pointer to a value of type T, while
+// src must be a value of type T or a pointer to such a value.
+// A nil src pointer results in the zero value being stored.
+// Values are copied according to the same rules as Copy.
+// The copy is completed before it is stored into dst,
+// such that src may alias the value that dst points to,
+// unless the Copier was created with ReuseDestination.
+// If the Copier was created with MatchFields, src may also be a value
+// of a different type or a pointer to such a value, in which case
+// an error is reported if src cannot be copied into dst.
+//
+// Example usage:
+//
+//	var dst Config
+//	if err := copier.CopyInto(&dst, src); err != nil {
+//		return err
+//	}
+func (c *Copier) CopyInto(dst, src interface{}) (err error) {
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("cpy.CopyInto: destination must be a non-nil pointer, got %T", dst)
 	}
-
-	// Check if there is a specialized copy function for this type.
-	if fnc := c.lookupFunc(t); fnc.IsValid() {
-		ft := fnc.Type().In(0)
-		if ft.Kind() != reflect.Interface {
-			if t == ft {
-				dst = fnc.Call([]reflect.Value{src})[0]
-			} else {
-				dst = fnc.Call([]reflect.Value{makeAddr(src)})[0].Elem()
-			}
-		} else {
-			if t.Implements(ft) {
-				dst = fnc.Call([]reflect.Value{src.Convert(ft)})[0].Elem().Convert(t)
-			} else {
-				dst = fnc.Call([]reflect.Value{makeAddr(src).Convert(ft)})[0].Elem().Elem().Convert(t)
+	t := dv.Type().Elem()
+	sv := reflect.ValueOf(src)
+	switch {
+	case !sv.IsValid():
+		return fmt.Errorf("cpy.CopyInto: cannot copy untyped nil into %v", dv.Type())
+	case sv.Type() == t:
+	case sv.Type() == dv.Type():
+		if sv.IsNil() {
+			dv.Elem().Set(reflect.Zero(t))
+			return nil
+		}
+		sv = sv.Elem()
+	case c.matchFields:
+		if sv.Kind() == reflect.Ptr && t.Kind() != reflect.Ptr {
+			if sv.IsNil() {
+				dv.Elem().Set(reflect.Zero(t))
+				return nil
 			}
+			sv = sv.Elem()
 		}
-		return dst
+		defer recoverError(&err)
+		tmp := reflect.New(t).Elem()
+		c.copyAcrossRoot(tmp, sv)
+		dv.Elem().Set(tmp)
+		return nil
+	default:
+		return fmt.Errorf("cpy.CopyInto: cannot copy %v into %v", sv.Type(), dv.Type())
 	}
+	if c.reuse {
+		c.copyReuseRoot(dv.Elem(), sv)
+		return nil
+	}
+	dv.Elem().Set(c.copyRoot(context.Background(), "CopyInto", sv, nil, nil))
+	return nil
+}
 
-	// Deep copy pointers, interfaces, arrays, slices, maps, and structs.
-	dst = src // shallow copy the value by default
-	switch t.Kind() {
-	case reflect.Ptr:
-		dst = reflect.New(src.Elem().Type())
-		dst.Elem().Set(c.copy(src.Elem()))
-	case reflect.Interface:
-		dst = c.copy(src.Elem()).Convert(t)
-	case reflect.Array:
-		dst = reflect.New(t).Elem()
-		for i := 0; i < src.Len(); i++ {
-			dst.Index(i).Set(c.copy(src.Index(i)))
-		}
-	case reflect.Slice:
-		dst = reflect.MakeSlice(t, src.Len(), src.Cap())
-		for i := 0; i < src.Len(); i++ {
-			dst.Index(i).Set(c.copy(src.Index(i)))
-		}
-	case reflect.Map:
-		dst = reflect.MakeMap(t)
-		for iter := src.MapRange(); iter.Next(); {
-			dst.SetMapIndex(c.copy(iter.Key()), c.copy(iter.Value()))
-		}
-	case reflect.Struct:
-		dst = reflect.New(t).Elem()
-		for _, i := range c.exportedFields(src.Type()) {
-			dst.Field(i).Set(c.copy(src.Field(i)))
-		}
+// CopyE is identical to Copy, but returns an error instead of panicking
+// when a value cannot be copied (e.g., because of an unexported field
+// that may not be ignored or a type forbidden by Forbid).
+// Panics raised by functions provided through options are not recovered.
+func (c *Copier) CopyE(v interface{}) (dst interface{}, err error) {
+	defer recoverError(&err)
+	return c.Copy(v), nil
+}
+
+// CopyContext is identical to CopyE, but periodically checks ctx
+// while copying and aborts the copy if ctx is done,
+// in which case the returned error wraps ctx.Err().
+func (c *Copier) CopyContext(ctx context.Context, v interface{}) (dst interface{}, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &copyError{msg: "cpy.CopyContext: " + err.Error(), err: err}
 	}
-	return dst
+	if v == nil {
+		return nil, nil
+	}
+	defer recoverError(&err)
+	return c.copyRoot(ctx, "CopyContext", reflect.ValueOf(v), nil, nil).Interface(), nil
 }
 
-// lookupFunc returns a custom copy function for the provided type
-// if there is one. Otherwise, it returns an invalid value.
-func (c *Copier) lookupFunc(t reflect.Type) reflect.Value {
-	v, ok := c.lookupFuncCache.Load(t)
-	if !ok {
-		fnc := c.lookupFuncSlow(t)
-		v, _ = c.lookupFuncCache.LoadOrStore(t, fnc)
+// CopyWithStats is identical to Copy, but also returns statistics about
+// the copy, which is useful to understand why copying a value is expensive.
+// Collecting statistics per kind slows down the copy,
+// so it is not intended to be used for every copy.
+func (c *Copier) CopyWithStats(v interface{}) (interface{}, Stats) {
+	if v == nil {
+		return nil, Stats{}
 	}
-	return v.(reflect.Value)
+	var stats Stats
+	dst := c.copyRoot(context.Background(), "CopyWithStats", reflect.ValueOf(v), nil, &stats).Interface()
+	return dst, stats
 }
-func (c *Copier) lookupFuncSlow(t reflect.Type) reflect.Value {
-	// Check for exact match with functions operating on concrete types.
-	for _, t := range []reflect.Type{t, reflect.PtrTo(t)} {
-		for _, fnc := range c.concFuncs {
-			if t == fnc.Type().In(0) {
-				return fnc
-			}
+
+// copyError is an error that prevents a value from being copied.
+// It is raised as a panic by Copy and returned as an error by CopyE.
+type copyError struct {
+	msg string
+	err error // underlying error; may be nil
+}
+
+func errorf(format string, args ...interface{}) *copyError {
+	return &copyError{msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *copyError) Error() string { return e.msg }
+func (e *copyError) Unwrap() error { return e.err }
+
+// recoverError recovers a panicking copyError and stores it in err.
+// Any other panic is propagated. It must be called by defer.
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(*copyError)
+		if !ok {
+			panic(r)
 		}
+		*err = e
 	}
-	// Check for assignability to functions operating on interface types.
-	for _, t := range []reflect.Type{t, reflect.PtrTo(t)} {
-		for _, fnc := range c.ifaceFuncs {
-			if strictImplements(t, fnc.Type().In(0)) {
-				return fnc
-			}
+}
+
+// checkInterval is the number of values copied between checks of
+// whether the context passed to CopyContext is done.
+// It must be a power of two.
+const checkInterval = 1024
+
+// copyRoot returns a copy of the root value src for the operation op.
+// The copy is aborted with a panicking copyError once ctx is done.
+// If non-nil, memo records the copies of pointers (see CopySession)
+// and stats is populated with detailed statistics of the copy.
+func (c *Copier) copyRoot(ctx context.Context, op string, src reflect.Value, memo map[memoKey]reflect.Value, stats *Stats) reflect.Value {
+	if memo == nil && c.preserveAliasing {
+		memo = getMemo()
+		defer putMemo(memo)
+	}
+	if len(c.traces) > 0 || len(c.middleware) > 0 || ctx.Done() != nil || stats != nil {
+		s := &state{Copier: c, memo: memo, root: src.Type()}
+		if ctx.Done() != nil {
+			s.ctx = ctx
 		}
+		if stats != nil {
+			s.stats.Kinds = make(map[reflect.Kind]int)
+			defer func() { *stats = s.stats }()
+		}
+		if len(c.middleware) > 0 {
+			s.next = s.chain()
+		}
+		if len(c.traces) > 0 {
+			defer s.trace(op, src.Type())()
+		}
+		return s.copy(src)
 	}
-	return reflect.Value{}
+	s := state{Copier: c, memo: memo, root: src.Type()} // avoid allocating state when not tracing
+	return s.copy(src)
 }
 
-// strictImplements is identical to reflect.Type.Implements,
-// but reports false if the non-pointer version of t also implements ti.
-//
-// The purpose of this check is to ensure that we consistently call "func(I) I"
-// with the value form of the reciever if it implements I,
-// rather than an inconsistent mixture of both value and pointer receivers.
-func strictImplements(t, ti reflect.Type) bool {
-	if !t.Implements(ti) {
-		return false
+// copy returns a copy of src.
+// It avoids allocating new storage for values that need no deep copy.
+func (s *state) copy(src reflect.Value) reflect.Value {
+	return s.copyWith(src, s.typeInfo(src.Type()))
+}
+
+// copyWith is identical to copy, but uses ti as the type information for src.
+func (s *state) copyWith(src reflect.Value, ti *typeInfo) reflect.Value {
+	src = readable(src)
+	if s.next != nil {
+		return s.visit(src)
 	}
-	if t.Kind() == reflect.Ptr && t.Elem().Implements(ti) {
-		return false
+	return s.copyNode(src, ti)
+}
+func (s *state) copyNode(src reflect.Value, ti *typeInfo) reflect.Value {
+	if ti.plain || src.IsZero() {
+		s.count(src.Kind())
+		return src
 	}
-	return true
+	dst := reflect.New(src.Type()).Elem()
+	s.enter(src.Kind())
+	s.copyValue(dst, src, ti)
+	s.leave()
+	return dst
 }
 
-// makeAddr returns the address of v if possible,
-// otherwise it shallow copies v into a new instance and returns that.
-func makeAddr(v reflect.Value) reflect.Value {
-	if v.CanAddr() {
-		return v.Addr()
+// copyTo copies src into dst, which must be a settable zero value
+// of the same type as src.
+// Values are written directly into the storage of dst such that
+// copying a composite value does not allocate for each of its elements.
+func (s *state) copyTo(dst, src reflect.Value) {
+	if s.next != nil {
+		dst.Set(s.visit(readable(src)))
+		return
 	}
-	p := reflect.New(v.Type())
-	p.Elem().Set(v)
-	return p
+	s.enter(src.Kind())
+	s.copyValue(dst, src, s.typeInfo(src.Type()))
+	s.leave()
 }
+func (s *state) copyValue(dst, src reflect.Value, ti *typeInfo) {
+	src = readable(src)
+	t := src.Type()
 
-// exportedFields returns a list of exported field indexes in struct t.
-// This method caches the result since reflect.Type.Field is slow
-// since every call always allocates reflect.Type.StructField.Index.
-func (c *Copier) exportedFields(t reflect.Type) []int {
-	v, ok := c.exportedFieldsCache.Load(t)
-	if !ok {
-		index := c.exportedFieldsSlow(t)
-		v, _ = c.exportedFieldsCache.LoadOrStore(t, index)
+	// Copy values of types with a Transformer as usual
+	// before transforming the copy.
+	if ti.transform.IsValid() {
+		s.copyValue(dst, src, ti.inner)
+		if !src.IsZero() {
+			dst.Set(ti.transform.Call([]reflect.Value{dst})[0])
+		}
+		return
 	}
-	return v.([]int)
-}
-func (c *Copier) exportedFieldsSlow(t reflect.Type) []int {
-	index := make([]int, 0, t.NumField())
-	for i := 0; i < t.NumField(); i++ {
-		f := t.Field(i)
-		if f.PkgPath == "" {
-			index = append(index, i) // record index of exported field
-		} else if !c.ignoreAllUnexported {
-			var name string
-			if t.Name() != "" {
-				// Named type with unexported fields.
-				name = fmt.Sprintf("%q.%v", t.PkgPath(), t.Name()) // e.g., "path/to/package".MyType
-			} else {
-				// Unnamed type with unexported fields.
-				name = fmt.Sprintf("%q.(%v)", f.PkgPath, t.String()) // e.g., "path/to/package".(struct { a int })
+
+	// Check if a rule applies to the path of the value (see FilterPath).
+	if ti.filtered != nil {
+		for _, fi := range ti.filtered {
+			if fi.rule.appliesAt(s.path) {
+				s.copyValue(dst, src, fi)
+				return
 			}
-			panic(fmt.Sprintf("unable to copy unexported field: %v.%v", name, f.Name))
 		}
+		s.copyValue(dst, src, ti.inner)
+		return
 	}
-	return index
-}
-
-// Option is an option that configures a Copier.
-// An option must be obtained using a constructor (e.g., Func or Shallow).
-type Option option
 
-// Keep the exact representation of Option opaque.
-// We may change it to be an interface in the future.
-type option struct {
-	copyFuncs           []reflect.Value
-	ignoreAllUnexported bool
-}
+	// Leave zero values as is and shallow copy values that
+	// need no deep copy (e.g., primitive types).
+	if ti.plain {
+		dst.Set(src)
+		return
+	}
+	if src.IsZero() {
+		return
+	}
 
-// Func provides specialized copy behavior for specific types.
+	// Check if there is a specialized copy function for this type.
+	// If the function declines to copy the value, then fall back to
+	// the default behavior below.
+	if ti.fnc.IsValid() {
+		if ti.rule.strategy == Fail && s.onError != nil {
+			s.handleError(forbiddenError(ti.rule.typ, ti.rule.name, ti.rule.site), dst, src)
+			return
+		}
+		if ti.rule.inPlace {
+			s.callFuncInPlace(ti.rule, dst, src)
+			return
+		}
+		if v, ok := s.callFunc(ti.rule, src); ok {
+			dst.Set(v)
+			return
+		}
+	}
+
+	// Copy JSON-like trees without reflection if possible.
+	if s.jsonFastPath && (t == jsonObjectType || t == jsonArrayType) && src.CanInterface() {
+		dst.Set(reflect.ValueOf(s.copyJSON(src.Interface())))
+		return
+	}
+
+	// Deep copy pointers, interfaces, arrays, slices, maps, and structs.
+	switch t.Kind() {
+	case reflect.Ptr:
+		k := memoKey{src.UnsafePointer(), t}
+		if p, ok := s.copied(k); ok {
+			dst.Set(p)
+			break
+		}
+		if s.cyclic(k) {
+			s.copyCycle(dst, src)
+			break
+		}
+		s.alloc(int64(t.Elem().Size()))
+		p := reflect.New(t.Elem())
+		s.record(k, p) // record before copying to handle cycles
+		if s.trackPaths {
+			s.push(PathStep{Type: t.Elem(), Index: -1})
+			s.copyTo(p.Elem(), src.Elem())
+			s.pop()
+		} else {
+			s.copyTo(p.Elem(), src.Elem())
+		}
+		s.unrecord(k)
+		dst.Set(p)
+	case reflect.Interface:
+		s.copyInterface(dst, src, nil)
+	case reflect.Array:
+		s.copyElems(dst, src)
+	case reflect.Slice:
+		if src.Cap() == 0 {
+			// A slice with no capacity can be shared as is since
+			// appending to either slice always allocates a new array.
+			dst.Set(src)
+			break
+		}
+		s.alloc(int64(src.Cap()) * int64(t.Elem().Size()))
+		sl := reflect.MakeSlice(t, src.Len(), src.Cap())
+		if s.isPlain(t.Elem()) && s.next == nil {
+			reflect.Copy(sl, src) // copy all elements with a single memmove
+		} else {
+			s.copyElems(sl, src)
+		}
+		dst.Set(sl)
+	case reflect.Map:
+		s.alloc(int64(src.Len()) * int64(t.Key().Size()+t.Elem().Size()))
+		m := reflect.MakeMapWithSize(t, src.Len())
+		if src.Len() > 0 {
+			vt := t.Elem()
+			dynamic := vt.Kind() == reflect.Interface && !s.typeInfo(vt).fnc.IsValid() && s.next == nil
+			var dc dynamicCache
+			for iter := src.MapRange(); iter.Next(); {
+				k, v := iter.Key(), iter.Value()
+				if s.trackPaths {
+					nk := s.copy(k)
+					s.push(PathStep{Type: vt, Index: -1, Key: k})
+					m.SetMapIndex(nk, s.copy(v))
+					s.pop()
+					continue
+				}
+				if dynamic && !v.IsNil() {
+					nv := reflect.New(vt).Elem()
+					s.enter(reflect.Interface)
+					s.copyInterface(nv, v, &dc)
+					s.leave()
+					m.SetMapIndex(s.copy(k), nv)
+				} else {
+					m.SetMapIndex(s.copy(k), s.copy(v))
+				}
+			}
+		}
+		dst.Set(m)
+	case reflect.Struct:
+		if s.handlesStruct(t) {
+			s.copyStructHandled(dst, stage(src), false)
+			break
+		}
+		if s.unsafeFieldAccess || len(s.allowedFields(t)) > 0 {
+			s.copyStructUnsafe(dst, stage(src))
+			break
+		}
+		for _, i := range s.exportedFields(t) {
+			if s.trackPaths {
+				f := t.Field(i)
+				s.push(PathStep{Type: f.Type, Field: f.Name, Index: -1})
+				s.copyTo(dst.Field(i), src.Field(i))
+				s.pop()
+				continue
+			}
+			s.copyTo(dst.Field(i), src.Field(i))
+		}
+	case reflect.Func:
+		if isIterator(t) {
+			s.copyIterator(dst, src)
+			break
+		}
+		dst.Set(src)
+	default:
+		dst.Set(src) // shallow copy all other kinds
+	}
+}
+
+// state is the state of a single call to Copier.Copy.
+type state struct {
+	*Copier
+	depth int // current depth of recursion
+	stats Stats
+	next  CopyFn                    // middleware chain; nil if there is no middleware
+	ctx   context.Context           // checked periodically; nil if it is never done
+	memo  map[memoKey]reflect.Value // copies of pointers; nil if not recorded
+	ptrs  pathPointers              // pointers on the path to the current value; only if memo is nil
+	path  Path                      // path to the current value; only if trackPaths
+	root  reflect.Type              // type of the root value
+}
+
+// chain returns the middleware chain wrapped around copyNode.
+func (s *state) chain() CopyFn {
+	next := CopyFn(func(src reflect.Value) reflect.Value {
+		return s.copyNode(src, s.typeInfo(src.Type()))
+	})
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		next = s.middleware[i](&s.path, next)
+	}
+	return next
+}
+
+// visit copies src through the middleware chain.
+func (s *state) visit(src reflect.Value) reflect.Value {
+	dst := s.next(src)
+	if !dst.IsValid() || dst.Type() != src.Type() {
+		panic(errorf("cpy.Middleware: copy of %v has mismatching type: %v", src.Type(), dst))
+	}
+	return dst
+}
+
+// enter records a visit to a value of kind k
+// one level deeper than the current value.
+func (s *state) enter(k reflect.Kind) {
+	s.count(k)
+	if s.depth++; s.depth > s.stats.MaxDepth {
+		s.stats.MaxDepth = s.depth
+		if s.maxDepth > 0 && s.depth > s.maxDepth {
+			panic(s.limitError("cpy.MaxDepth", "depth", s.maxDepth))
+		}
+	}
+}
+
+// count records a visit of a value of kind k.
+func (s *state) count(k reflect.Kind) {
+	s.stats.Nodes++
+	if s.maxNodes > 0 && s.stats.Nodes > s.maxNodes {
+		panic(s.limitError("cpy.MaxNodes", "node", s.maxNodes))
+	}
+	if s.stats.Kinds != nil {
+		s.stats.Kinds[k]++
+	}
+	if s.ctx != nil && s.stats.Nodes&(checkInterval-1) == 0 {
+		if err := s.ctx.Err(); err != nil {
+			panic(&copyError{msg: "cpy.CopyContext: " + err.Error(), err: err})
+		}
+	}
+}
+
+// leave records a return to the parent of the current value.
+func (s *state) leave() {
+	s.depth--
+}
+
+// trace calls all trace functions with the name of the operation
+// and the root type being copied, and returns a function that
+// reports the statistics of the copy to all trace functions.
+func (s *state) trace(op string, t reflect.Type) func() {
+	var ends []func(Stats)
+	for _, start := range s.traces {
+		if end := start(op, t); end != nil {
+			ends = append(ends, end)
+		}
+	}
+	return func() {
+		for _, end := range ends {
+			end(s.stats)
+		}
+	}
+}
+
+// Stats are statistics about a single copy.
+type Stats struct {
+	// Nodes is the number of values visited.
+	// A value that needs no deep copy (e.g., a struct of primitive fields)
+	// is counted as a single node regardless of its contents.
+	Nodes int
+	// MaxDepth is the maximum depth of recursion reached,
+	// where the root value has a depth of one.
+	MaxDepth int
+	// Bytes is an estimate of the bytes of new storage allocated for
+	// pointers, slices, and maps in the copy. It excludes storage
+	// allocated by functions provided through options.
+	Bytes int64
+	// Kinds is the number of values visited of each kind,
+	// where interface values are counted by the kind of their dynamic value.
+	// It is only populated by Copier.CopyWithStats.
+	Kinds map[reflect.Kind]int
+}
+
+// copyElems copies every element of the array or slice src into dst,
+// which must be of the same type and length.
+func (s *state) copyElems(dst, src reflect.Value) {
+	et := src.Type().Elem()
+	if s.trackPaths {
+		for i := 0; i < src.Len(); i++ {
+			s.push(PathStep{Type: et, Index: i})
+			s.copyTo(dst.Index(i), src.Index(i))
+			s.pop()
+		}
+		return
+	}
+	if et.Kind() == reflect.Interface && !s.typeInfo(et).fnc.IsValid() && s.next == nil {
+		var dc dynamicCache
+		for i := 0; i < src.Len(); i++ {
+			s.enter(reflect.Interface)
+			if e := src.Index(i); !e.IsNil() {
+				s.copyInterface(dst.Index(i), e, &dc)
+			}
+			s.leave()
+		}
+		return
+	}
+	if s.next != nil {
+		for i := 0; i < src.Len(); i++ {
+			s.copyTo(dst.Index(i), src.Index(i))
+		}
+		return
+	}
+	// Resolve the type information once for all elements.
+	ti := s.typeInfo(et)
+	for i := 0; i < src.Len(); i++ {
+		s.enter(et.Kind())
+		s.copyValue(dst.Index(i), src.Index(i), ti)
+		s.leave()
+	}
+}
+
+// dynamicCache caches the type information for the dynamic type of
+// the most recently copied interface value in a collection.
+// Collections of interface values tend to hold values of a small number of
+// dynamic types, such that this avoids resolving type information
+// for the dynamic value of every element.
+type dynamicCache struct {
+	t  reflect.Type
+	ti *typeInfo
+}
+
+// copyInterface copies the non-nil interface value src into dst,
+// which must be a settable zero value of the same interface type.
+// If non-nil, dc is used to cache type information for the dynamic value.
+func (s *state) copyInterface(dst, src reflect.Value, dc *dynamicCache) {
+	t := src.Type()
+	elem := src.Elem()
+	if s.normalizeNumbers {
+		elem = normalizeNumber(elem, t)
+	}
+	if to, ok := s.substitutes[elem.Type()]; ok && to.Implements(t) {
+		elem = elem.Convert(to)
+	}
+	var ti *typeInfo
+	switch et := elem.Type(); {
+	case dc == nil:
+		ti = s.typeInfo(et)
+	case dc.t == et:
+		ti = dc.ti
+	default:
+		ti = s.typeInfo(et)
+		dc.t, dc.ti = et, ti
+	}
+	v := s.copyWith(elem, ti)
+	if fn, ok := s.rebinds[rebindKey{iface: t, conc: elem.Type()}]; ok {
+		dst.Set(fn.Call([]reflect.Value{v})[0])
+		return
+	}
+	dst.Set(v.Convert(t))
+}
+
+// callFuncInPlace calls the in-place copy function of r,
+// which populates the settable zero value dst from src.
+func (s *state) callFuncInPlace(r *rule, dst, src reflect.Value) {
+	pt := reflect.PtrTo(r.typ)
+	if !dst.CanAddr() {
+		tmp := reflect.New(dst.Type()).Elem()
+		s.callFuncInPlace(r, tmp, src)
+		dst.Set(tmp)
+		return
+	}
+	r.fnc.Call([]reflect.Value{dst.Addr().Convert(pt), makeAddr(src).Convert(pt)})
+}
+
+// callFunc calls the copy function of r on src and
+// returns the result as a value of the same type as src.
+// It reports false if the copy function declined to copy src.
+func (s *state) callFunc(r *rule, src reflect.Value) (reflect.Value, bool) {
+	t, ft := src.Type(), r.typ
+
+	// Determine whether the function operates on a pointer to src
+	// (e.g., a func(*T) *T for a value of T).
+	var addr bool
+	if ft.Kind() != reflect.Interface {
+		addr = t != ft && !sameUnderlying(t, ft)
+	} else {
+		addr = !t.Implements(ft)
+	}
+	in := src
+	if addr {
+		in = makeAddr(src)
+	}
+	if in.Type() != ft {
+		in = in.Convert(ft)
+	}
+
+	out, ok := r.call(s, in)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	if ft.Kind() == reflect.Interface {
+		if out.IsNil() {
+			return reflect.Zero(t), true
+		}
+		out = out.Elem()
+	}
+	if addr {
+		return out.Convert(reflect.PtrTo(t)).Elem(), true
+	}
+	if out.Type() != t {
+		out = out.Convert(t)
+	}
+	return out, true
+}
+
+// call calls the copy function of r with in and returns the copy.
+// It panics with a copyError if the function reports an error
+// and reports false if the function declined to copy in.
+// The Copier and the current path of s are passed to functions
+// that accept them.
+func (r *rule) call(s *state, in reflect.Value) (reflect.Value, bool) {
+	var out []reflect.Value
+	switch ft := r.fnc.Type(); {
+	case ft.NumIn() == 1:
+		out = r.fnc.Call([]reflect.Value{in})
+	case ft.NumIn() == 3:
+		out = r.fnc.Call([]reflect.Value{reflect.ValueOf(s.Copier), reflect.ValueOf(append(Path(nil), s.path...)), in})
+	case ft.In(0) == copierType:
+		out = r.fnc.Call([]reflect.Value{reflect.ValueOf(s.Copier), in})
+	default:
+		out = r.fnc.Call([]reflect.Value{reflect.ValueOf(append(Path(nil), s.path...)), in})
+	}
+	if len(out) == 2 {
+		switch out[1].Kind() {
+		case reflect.Bool:
+			if !out[1].Bool() {
+				return reflect.Value{}, false
+			}
+		case reflect.Interface:
+			if !out[1].IsNil() {
+				err := out[1].Interface().(error)
+				panic(&copyError{msg: fmt.Sprintf("cpy: %v failed: %v", r, err), err: err})
+			}
+		}
+	}
+	return out[0], true
+}
+
+// isPlain reports whether values of type t need no deep copy,
+// such that a shallow copy of the entire value is identical to
+// a deep copy of it. This is the case for types composed entirely of
+// primitive types and exported fields, where no custom copy function
+// applies to any part of the type.
+func (c *Copier) isPlain(t reflect.Type) bool {
+	return c.typeInfo(t).plain
+}
+func (c *Copier) isPlainSlow(t reflect.Type) bool {
+	if c.immutableTypes[t] || (t.Kind() == reflect.Ptr && c.immutableTypes[t.Elem()]) {
+		return true
+	}
+	if c.immutableNames != nil && (c.immutableNames[typeName(t)] || (t.Kind() == reflect.Ptr && c.immutableNames[typeName(t.Elem())])) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return false
+	case reflect.Func:
+		return c.iterators <= ShareIterators || !isIterator(t)
+	case reflect.Array:
+		return c.isPlain(t.Elem())
+	case reflect.Struct:
+		fs := loadStructFields(t)
+		if len(fs.unexported) > 0 || c.fieldTags(t) != nil {
+			return false
+		}
+		for _, i := range fs.exported {
+			if !c.isPlain(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	default:
+		return true
+	}
+}
+
+// typeInfo is information about how values of a type are copied.
+type typeInfo struct {
+	fnc   reflect.Value // custom copy function; invalid if there is none
+	rule  *rule         // rule providing fnc; nil if there is none
+	plain bool          // see isPlain
+
+	// transform is the function provided to Transformer that is applied
+	// to copies made according to inner; invalid if there is none.
+	transform reflect.Value
+
+	// filtered is the type information for every rule that applies to
+	// values at paths matching a filter (see FilterPath), which are
+	// otherwise copied according to inner.
+	filtered []*typeInfo
+
+	inner *typeInfo // nil unless there is a transform or filtered rules
+}
+
+// typeInfo returns information about how values of type t are copied.
+// All information for a type is resolved at once and cached,
+// such that copying a value only needs a single cache lookup.
+func (c *Copier) typeInfo(t reflect.Type) *typeInfo {
+	v, ok := c.typeInfoCache.Load(t)
+	if !ok {
+		v, _ = c.typeInfoCache.LoadOrStore(t, c.typeInfoSlow(t))
+	}
+	return v.(*typeInfo)
+}
+func (c *Copier) typeInfoSlow(t reflect.Type) *typeInfo {
+	ti := c.baseTypeInfoSlow(t)
+	if filtered := c.filteredTypeInfoSlow(t); len(filtered) > 0 {
+		ti = &typeInfo{filtered: filtered, inner: ti}
+	}
+	if fn, ok := c.transformers[t]; ok {
+		ti = &typeInfo{transform: fn, inner: ti}
+	}
+	return ti
+}
+func (c *Copier) baseTypeInfoSlow(t reflect.Type) *typeInfo {
+	if r := c.lookupRuleSlow(t); r != nil {
+		return &typeInfo{fnc: r.fnc, rule: r}
+	}
+	for _, m := range c.matchers {
+		if m.cond(t) {
+			r := m.ruleFor(t)
+			return &typeInfo{fnc: r.fnc, rule: r}
+		}
+	}
+	if r := selfCopierRule(t); r != nil {
+		return &typeInfo{fnc: r.fnc, rule: r}
+	}
+	return &typeInfo{plain: c.isPlainSlow(t)}
+}
+
+// lookupRuleSlow returns the rule of the option that provides the custom
+// copy function for type t if there is one. Otherwise, it returns nil.
+func (c *Copier) lookupRuleSlow(t reflect.Type) *rule {
+	vt := t // type of the value being copied
+	// Functions of a higher priority are checked before all other functions.
+	for _, priority := range c.priorities {
+		// Check for exact match with functions operating on concrete types.
+		for _, t := range []reflect.Type{t, reflect.PtrTo(t)} {
+			for i, r := range c.concFuncs {
+				if r.priority == priority && t == r.typ && (t == vt || !r.inPlace) && r.applies(vt) {
+					return &c.concFuncs[i]
+				}
+			}
+		}
+		// Check for structural match with functions operating on concrete types.
+		for _, t := range []reflect.Type{t, reflect.PtrTo(t)} {
+			for i, r := range c.concFuncs {
+				if r.priority == priority && r.structural && sameUnderlying(t, r.typ) && (t == vt || !r.inPlace) && r.applies(vt) {
+					return &c.concFuncs[i]
+				}
+			}
+		}
+		// Check for assignability to functions operating on interface types.
+		for _, t := range []reflect.Type{t, reflect.PtrTo(t)} {
+			for i, r := range c.ifaceFuncs {
+				if r.priority == priority && strictImplements(t, r.typ) && r.applies(vt) {
+					return &c.ifaceFuncs[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Conflicts reports every Func or Shallow option that is never used
+// because it is shadowed by another option of higher precedence
+// that operates on the exact same type.
+// Options wrapped by If never shadow other options.
+// Each error includes the source location where both options were created.
+func (c *Copier) Conflicts() []error {
+	var errs []error
+	type key struct {
+		t          reflect.Type
+		structural bool
+	}
+	seen := make(map[key]rule)
+	for _, priority := range c.priorities {
+		for _, rs := range [][]rule{c.concFuncs, c.ifaceFuncs} {
+			for _, r := range rs {
+				if r.priority != priority {
+					continue
+				}
+				k := key{r.typ, r.structural}
+				if r2, ok := seen[k]; ok {
+					errs = append(errs, fmt.Errorf("%v is shadowed by %v", r, r2))
+					continue
+				}
+				if len(r.conds) == 0 {
+					seen[k] = r // conditional rules only partially shadow others
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// Describe returns a human-readable description of the effective
+// configuration of c. The output is intended for debugging and is not stable.
+//
+// Func, Shallow, and Forbid options are listed in order of precedence,
+// where options operating on concrete types are listed before options
+// operating on interface types, with options of a higher priority
+// listed before all others (see Copier.Copy and Priority for details).
+func (c *Copier) Describe() string {
+	var sb strings.Builder
+	sb.WriteString("Funcs (in order of precedence):\n")
+	for _, priority := range c.priorities {
+		for _, rs := range [][]rule{c.concFuncs, c.ifaceFuncs} {
+			for _, r := range rs {
+				if r.priority != priority {
+					continue
+				}
+				fmt.Fprintf(&sb, "\t%v", r)
+				if r.priority != 0 {
+					fmt.Fprintf(&sb, " (priority %d)", r.priority)
+				}
+				if r.structural {
+					sb.WriteString(" (structural)")
+				}
+				if len(r.conds) > 0 {
+					sb.WriteString(" (conditional)")
+				}
+				sb.WriteString("\n")
+			}
+		}
+	}
+	for _, m := range c.matchers {
+		fmt.Fprintf(&sb, "\t%v at %v\n", m.name, m.site)
+	}
+	for _, r := range c.pathRules {
+		fmt.Fprintf(&sb, "\t%v (path filtered)\n", r)
+	}
+	for _, m := range c.pathMatchers {
+		fmt.Fprintf(&sb, "\t%v at %v (path filtered)\n", m.name, m.site)
+	}
+	if len(c.immutableTypes) > 0 {
+		fmt.Fprintf(&sb, "Immutable types: %v\n", sortedTypeNames(c.immutableTypes))
+	}
+	if len(c.immutableNames) > 0 {
+		names := make([]string, 0, len(c.immutableNames))
+		for name := range c.immutableNames {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&sb, "Immutable named types: %v\n", strings.Join(names, ", "))
+	}
+	if c.tagName != defaultTagName {
+		fmt.Fprintf(&sb, "Tag name: %v\n", c.tagName)
+	}
+	if len(c.skipPaths) > 0 {
+		fmt.Fprintf(&sb, "Skipped paths: %v\n", c.skipPaths)
+	}
+	if len(c.onlyPaths) > 0 {
+		fmt.Fprintf(&sb, "Only paths: %v\n", c.onlyPaths)
+	}
+	for _, ff := range c.fieldFuncs {
+		fmt.Fprintf(&sb, "Field func: %v at %v\n", ff.path, ff.site)
+	}
+	if len(c.transformers) > 0 {
+		ts := make(map[reflect.Type]bool)
+		for t := range c.transformers {
+			ts[t] = true
+		}
+		fmt.Fprintf(&sb, "Transformed types: %v\n", sortedTypeNames(ts))
+	}
+	if c.maxDepth > 0 {
+		fmt.Fprintf(&sb, "Max depth: %d\n", c.maxDepth)
+	}
+	if c.maxNodes > 0 {
+		fmt.Fprintf(&sb, "Max nodes: %d\n", c.maxNodes)
+	}
+	if c.maxBytes > 0 {
+		fmt.Fprintf(&sb, "Max bytes: %d\n", c.maxBytes)
+	}
+	for _, kv := range c.redactTags {
+		fmt.Fprintf(&sb, "Redacted tag: %v:%q\n", kv[0], kv[1])
+	}
+	otherwise := "panic"
+	switch {
+	case c.onUnexported != nil:
+		otherwise = "handled by OnUnexported"
+	case c.ignoreAllUnexported:
+		otherwise = "ignored"
+	case c.onError != nil:
+		otherwise = "handled by OnError"
+	}
+	sb.WriteString("Unexported fields: ")
+	if len(c.unexportedPackages) > 0 {
+		fmt.Fprintf(&sb, "copied in packages %q; ", c.unexportedPackages)
+	}
+	if len(c.copyUnexported) > 0 {
+		fmt.Fprintf(&sb, "copied in types %v; ", sortedTypeNames(c.copyUnexported))
+	}
+	ignoresSome := (len(c.ignoreUnexported) > 0 || len(c.ignoreUnexportedPackages) > 0) && !c.ignoreAllUnexported && c.onUnexported == nil
+	if ignoresSome && len(c.ignoreUnexportedPackages) > 0 {
+		fmt.Fprintf(&sb, "ignored in packages %q; ", c.ignoreUnexportedPackages)
+	}
+	if ignoresSome && len(c.ignoreUnexported) > 0 {
+		fmt.Fprintf(&sb, "ignored in types %v; ", sortedTypeNames(c.ignoreUnexported))
+	}
+	if len(c.unexportedPackages) > 0 || len(c.copyUnexported) > 0 || ignoresSome {
+		sb.WriteString("otherwise ")
+	}
+	sb.WriteString(otherwise + "\n")
+	for _, flag := range []struct {
+		name string
+		on   bool
+	}{
+		{"NormalizeNumbers", c.normalizeNumbers},
+		{"UnsafeFieldAccess", c.unsafeFieldAccess},
+		{"MatchFields", c.matchFields},
+		{"ConvertTypes", c.convertTypes},
+		{"FlattenPointers", c.flattenPointers},
+		{"BoxValues", c.boxValues},
+		{"MatchTags", len(c.matchTags) > 0},
+		{"RegisterTypes", len(c.registeredTypes) > 0},
+		{"ReuseDestination", c.reuse},
+		{"PreserveAliasing", c.preserveAliasing},
+		{"OnError", c.onError != nil},
+		{"Iterators(DropIterators)", c.iterators == DropIterators},
+		{"Iterators(MaterializeIterators)", c.iterators == MaterializeIterators},
+		{"Substitute", len(c.substitutes) > 0},
+		{"Rebind", len(c.rebinds) > 0},
+		{"Middleware", len(c.middleware) > 0},
+		{"Trace", len(c.traces) > 0},
+	} {
+		if flag.on {
+			fmt.Fprintf(&sb, "Enabled: %v\n", flag.name)
+		}
+	}
+	return sb.String()
+}
+
+// sortedTypeNames returns the sorted names of all types in the set ts,
+// joined by commas.
+func sortedTypeNames(ts map[reflect.Type]bool) string {
+	var names []string
+	for t := range ts {
+		names = append(names, t.String())
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// RegisteredTypes returns the concrete types that Func, Shallow,
+// and Forbid options of c operate on, in order of precedence without
+// duplicates. The type of an option operating on a pointer type
+// (e.g., a Func for *T) is reported as such.
+// Types matched by conditions (e.g., KindFunc or ShallowIf)
+// and types provided to Immutable are not reported.
+//
+// Together with Copier.Plan, this allows verifying that every type
+// reachable from a root type either has an explicit handler
+// or needs no special handling.
+func (c *Copier) RegisteredTypes() []reflect.Type {
+	return c.registered(c.concFuncs)
+}
+
+// RegisteredInterfaces is identical to RegisteredTypes,
+// but returns the interface types that options operate on.
+func (c *Copier) RegisteredInterfaces() []reflect.Type {
+	return c.registered(c.ifaceFuncs)
+}
+
+func (c *Copier) registered(rs []rule) []reflect.Type {
+	var ts []reflect.Type
+	seen := make(map[reflect.Type]bool)
+	for _, priority := range c.priorities {
+		for _, r := range rs {
+			if r.priority == priority && !seen[r.typ] {
+				seen[r.typ] = true
+				ts = append(ts, r.typ)
+			}
+		}
+	}
+	return ts
+}
+
+// rule is a copy function along with the properties of the option
+// that it was provided by.
+type rule struct {
+	fnc      reflect.Value // func(T) T or a variant thereof (see Func)
+	typ      reflect.Type  // input type T of fnc
+	inPlace  bool          // whether fnc is a func(dst, src *T)
+	name     string        // e.g., "cpy.Shallow(time.Time)"
+	site     string        // e.g., "path/to/file.go:123"
+	strategy Strategy      // Custom, Share, or Fail
+	priority int           // see Priority
+
+	// structural specifies that fnc also applies to types with
+	// an underlying type identical to that of the input type.
+	structural bool
+
+	// conds are the predicates of every enclosing If option,
+	// all of which must report true for the rule to apply to a type.
+	conds []func(reflect.Type) bool
+
+	// paths are the predicates of every enclosing FilterPath option,
+	// all of which must report true for the rule to apply to a value.
+	paths []func(Path) bool
+}
+
+func (r rule) String() string {
+	if r.site == "" {
+		return r.name // not provided by an option
+	}
+	return fmt.Sprintf("%v at %v", r.name, r.site)
+}
+
+// applies reports whether the conditions of r are satisfied for t.
+func (r *rule) applies(t reflect.Type) bool {
+	for _, cond := range r.conds {
+		if !cond(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// appliesAt reports whether the path predicates of r are satisfied for p.
+func (r *rule) appliesAt(p Path) bool {
+	for _, f := range r.paths {
+		if !f(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// callerSite returns the source location of the caller of
+// the function that called callerSite.
+func callerSite() string {
+	if _, file, line, ok := runtime.Caller(2); ok {
+		return fmt.Sprintf("%v:%d", file, line)
+	}
+	return "unknown location"
+}
+
+// sameUnderlying reports whether the concrete types t and ft
+// have identical underlying types (ignoring struct tags).
+func sameUnderlying(t, ft reflect.Type) bool {
+	// Values of the same kind are only convertible between each other if
+	// their underlying types are identical (ignoring struct tags).
+	// Interface and channel types are the exception, which cannot be
+	// the input type of a concrete copy function.
+	return t.Kind() == ft.Kind() && t.ConvertibleTo(ft)
+}
+
+// strictImplements is identical to reflect.Type.Implements,
+// but reports false if the non-pointer version of t also implements ti.
+//
+// The purpose of this check is to ensure that we consistently call "func(I) I"
+// with the value form of the reciever if it implements I,
+// rather than an inconsistent mixture of both value and pointer receivers.
+func strictImplements(t, ti reflect.Type) bool {
+	if !t.Implements(ti) {
+		return false
+	}
+	if t.Kind() == reflect.Ptr && t.Elem().Implements(ti) {
+		return false
+	}
+	return true
+}
+
+// makeAddr returns the address of v if possible,
+// otherwise it shallow copies v into a new instance and returns that.
+func makeAddr(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v.Addr()
+	}
+	return stage(v).Addr()
+}
+
+// stage returns v if it is addressable,
+// otherwise it shallow copies v into a new instance and returns that.
+// Values obtained from interfaces or map lookups are not addressable.
+func stage(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v
+	}
+	p := reflect.New(v.Type()).Elem()
+	p.Set(v)
+	return p
+}
+
+// exportedFields returns a list of exported field indexes in struct t.
+// It panics if t has unexported fields that may neither be ignored
+// nor copied according to allowedFields.
+func (c *Copier) exportedFields(t reflect.Type) []int {
+	fs := loadStructFields(t)
+	if allowed := c.allowedFields(t); len(fs.unexported) > len(allowed) && !c.ignoresUnexported(t) {
+		// Report the first unexported field that is not allowed.
+		i := fs.unexported[0]
+		for j := 0; j < len(allowed) && allowed[j] == fs.unexported[j]; j++ {
+			i = fs.unexported[j+1]
+		}
+		panic(unexportedFieldError(t, i))
+	}
+	return fs.exported
+}
+
+// unexportedFieldError returns the error for the i-th field of struct t,
+// which is an unexported field that may neither be ignored nor copied.
+func unexportedFieldError(t reflect.Type, i int) *copyError {
+	f := t.Field(i)
+	var name string
+	if t.Name() != "" {
+		// Named type with unexported fields.
+		name = fmt.Sprintf("%q.%v", t.PkgPath(), t.Name()) // e.g., "path/to/package".MyType
+	} else {
+		// Unnamed type with unexported fields.
+		name = fmt.Sprintf("%q.(%v)", f.PkgPath, t.String()) // e.g., "path/to/package".(struct { a int })
+	}
+	return errorf("unable to copy unexported field: %v.%v", name, f.Name)
+}
+
+// allowedFields returns a list of unexported field indexes in struct t
+// that are copied according to AllowUnexportedPackages.
+func (c *Copier) allowedFields(t reflect.Type) []int {
+	if len(c.unexportedPackages) == 0 && len(c.copyUnexported) == 0 {
+		return nil
+	}
+	v, ok := c.allowedFieldsCache.Load(t)
+	if !ok {
+		v, _ = c.allowedFieldsCache.LoadOrStore(t, c.allowedFieldsSlow(t))
+	}
+	return v.([]int)
+}
+func (c *Copier) allowedFieldsSlow(t reflect.Type) []int {
+	if c.copyUnexported[t] {
+		return loadStructFields(t).unexported
+	}
+	var allowed []int
+	for _, i := range loadStructFields(t).unexported {
+		f := t.Field(i)
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr && ft.Name() == "" {
+			ft = ft.Elem()
+		}
+		for _, pattern := range c.unexportedPackages {
+			if matchPackage(pattern, f.PkgPath) || matchPackage(pattern, ft.PkgPath()) {
+				allowed = append(allowed, i)
+				break
+			}
+		}
+	}
+	return allowed
+}
+
+// matchPackage reports whether the package path matches the pattern,
+// which is either an exact package path or a package path followed by "/...",
+// which matches that package and all packages beneath it.
+func matchPackage(pattern, path string) bool {
+	if path == "" {
+		return false
+	}
+	if prefix := strings.TrimSuffix(pattern, "/..."); prefix != pattern {
+		return path == prefix || strings.HasPrefix(path, prefix+"/")
+	}
+	return path == pattern
+}
+
+// structFieldsCache is a mapping from reflect.Type to structFields.
+// Since the fields of a type do not depend on how a Copier is configured,
+// the cache is shared by all Copier instances.
+//
+// Caches that depend on the options of a Copier (e.g., which Func applies
+// to a given type) are only shared by Copiers with equivalent options
+// (see planCaches).
+var structFieldsCache sync.Map // map[reflect.Type]structFields
+
+// structFields describes the fields of a struct type.
+type structFields struct {
+	exported   []int // indexes of all exported fields
+	unexported []int // indexes of all unexported fields
+}
+
+// loadStructFields returns the fields of struct t.
+// This function caches the result since reflect.Type.Field is slow
+// since every call always allocates reflect.Type.StructField.Index.
+func loadStructFields(t reflect.Type) structFields {
+	v, ok := structFieldsCache.Load(t)
+	if !ok {
+		v, _ = structFieldsCache.LoadOrStore(t, loadStructFieldsSlow(t))
+	}
+	return v.(structFields)
+}
+func loadStructFieldsSlow(t reflect.Type) structFields {
+	fs := structFields{exported: make([]int, 0, t.NumField())}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			fs.exported = append(fs.exported, i) // record index of exported field
+		} else {
+			fs.unexported = append(fs.unexported, i)
+		}
+	}
+	return fs
+}
+
+// Option is an option that configures a Copier.
+// An option must be obtained using a constructor (e.g., Func or Shallow)
+// or be an Options list.
+type Option interface {
+	// flatten appends the leaf options within the option to dst.
+	flatten(dst []option) []option
+}
+
+// Options is a list of Option values that also satisfies the Option interface.
+// Helper libraries may use it to export a reusable set of options
+// as a single value (e.g., all options needed for the types of a package).
+// Nil options within the list are ignored.
 //
-// The copy function f must be a function "func(T) T",
-// where T must be a pointer, interface, array, slice, map, or struct;
+// Example usage:
+//
+//	var DomainOptions = cpy.Options{
+//		cpy.Shallow(time.Time{}),
+//		cpy.Func(proto.Clone),
+//	}
+//
+//	copier := cpy.New(DomainOptions, cpy.IgnoreAllUnexported())
+type Options []Option
+
+func (opts Options) flatten(dst []option) []option {
+	for _, opt := range opts {
+		if opt != nil {
+			dst = opt.flatten(dst)
+		}
+	}
+	return dst
+}
+
+// flattenOptions returns the leaf options within opts in order.
+func flattenOptions(opts []Option) []option {
+	return Options(opts).flatten(nil)
+}
+
+// mapOptions returns a copy of opt with f applied to every leaf option,
+// preserving the structure of any Options lists.
+func mapOptions(opt Option, f func(option) option) Option {
+	switch opt := opt.(type) {
+	case Options:
+		opts := make(Options, len(opt))
+		for i, o := range opt {
+			opts[i] = mapOptions(o, f)
+		}
+		return opts
+	case option:
+		return f(opt)
+	default:
+		return opt
+	}
+}
+
+// option is the representation of a leaf Option.
+type option struct {
+	rules               []rule
+	priority            int
+	structural          bool
+	immutableTypes      []reflect.Type
+	immutableNames      []string
+	ignoreAllUnexported bool
+	ignoreUnexported    []reflect.Type
+	ignoredPackages     []string
+	copyUnexported      []reflect.Type
+	normalizeNumbers    bool
+	unsafeFieldAccess   bool
+	unexportedPackages  []string
+	iterators           IteratorPolicy
+	substitutes         map[reflect.Type]reflect.Type
+	rebinds             []reflect.Value
+	traces              []func(op string, t reflect.Type) func(Stats)
+	middleware          []middlewareFunc
+	trackPaths          bool
+	matchers            []matcher
+	matchFields         bool
+	convertTypes        bool
+	flattenPointers     bool
+	boxValues           bool
+	matchTags           []string
+	registeredTypes     []reflect.Type
+	reuse               bool
+	preserveAliasing    bool
+	onError             func(error) Action
+	onUnexported        func(reflect.Type, reflect.StructField) Action
+	tagName             string
+	skipPaths           []fieldPath
+	fieldFuncs          []fieldFunc
+	transformers        []reflect.Value
+	maxDepth            int
+	maxNodes            int
+	maxBytes            int64
+	onlyPaths           []fieldPath
+	redactTags          [][2]string
+	placeholders        []reflect.Value
+}
+
+func (opt option) flatten(dst []option) []option {
+	return append(dst, opt)
+}
+
+// onlyRules reports whether opt only consists of rules and matchers providing
+// copy functions (e.g., Func, Shallow, Forbid, or KindFunc),
+// which are the options that may be restricted to some values.
+func (opt option) onlyRules() bool {
+	opt.rules, opt.priority, opt.structural, opt.matchers = nil, 0, false, nil
+	return reflect.ValueOf(opt).IsZero()
+}
+
+// affectsTypes reports whether opt affects the information that a Copier
+// caches about how values of each type are copied (see Copier.With).
+// Options are presumed to do so unless known otherwise.
+func (opt option) affectsTypes() bool {
+	opt.priority, opt.structural = 0, false
+	opt.ignoreAllUnexported, opt.ignoreUnexported, opt.onError, opt.onUnexported = false, nil, nil, nil
+	opt.ignoredPackages = nil
+	opt.normalizeNumbers, opt.substitutes, opt.rebinds = false, nil, nil
+	opt.traces, opt.middleware, opt.trackPaths, opt.unsafeFieldAccess = nil, nil, false, false
+	opt.matchFields, opt.convertTypes, opt.reuse, opt.preserveAliasing = false, false, false, false
+	opt.flattenPointers, opt.boxValues, opt.registeredTypes = false, false, nil
+	opt.placeholders, opt.maxDepth, opt.maxNodes, opt.maxBytes = nil, 0, 0, 0
+	return !reflect.ValueOf(opt).IsZero()
+}
+
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	boolType   = reflect.TypeOf(false)
+	copierType = reflect.TypeOf((*Copier)(nil))
+	pathType   = reflect.TypeOf(Path(nil))
+)
+
+// Func provides specialized copy behavior for specific types.
+//
+// The copy function f must be a function "func(T) T", "func(T) (T, error)",
+// or "func(T) (T, bool)", where T must be a pointer, interface, array, slice, map, or struct;
 // otherwise it will panic. If T is an interface type,
 // it must have at least one method, otherwise Func will panic.
 // Futhermore, the function must return a concrete type
 // identical to the input type, otherwise Copier.Copy will panic.
 //
+// If the copy function returns a non-nil error, then Copier.Copy panics
+// with an error wrapping it, which Copier.CopyE returns instead.
+// If the copy function returns false, then it declines to copy the value,
+// which is instead deep copied according to the default behavior
+// (ignoring all other Func and Shallow options for the type itself).
+//
+// The copy function may also be a function "func(*cpy.Copier, T) T"
+// (with an optional error or bool result as above), in which case
+// it is passed the Copier performing the copy. This allows the function
+// to deep copy nested values of a type with the same options
+// (e.g., all fields but one). Nested copies are independent of the
+// ongoing copy (e.g., with respect to Trace statistics or CopyContext).
+//
+// The copy function may also accept the Path to the value being copied
+// after the optional Copier (e.g., "func(cpy.Path, T) T"), which allows the
+// function to copy values differently depending on where they occur.
+// Tracking paths slows down every copy made by the Copier.
+//
+// The copy function may also be a function "func(dst, src *T)",
+// which populates the value that dst points to as a copy of the value
+// that src points to, where dst points to a zero value allocated by
+// Copier.Copy (e.g., an element of a new slice). This avoids allocating
+// a temporary value for every copy of T. Unlike other copy functions,
+// such a function only applies to values of T (not *T),
+// and T must not be an interface type.
+//
 // The Func will be used if the current type of the value being copied
 // exactly matches the input type (for concrete types) or if it
 // implements the input type (for interface types).
 // Both the type itself (e.g., T) and a pointer to the type (e.g., *T)
 // are checked when evaluating whether a given Func can be used.
 //
+// A type alias (e.g., type U = T) denotes the identical type,
+// so a Func for T always applies to values of U.
+// A defined type (e.g., type U T) is a distinct type,
+// so a Func for T only applies to values of U if wrapped by Structural.
+//
+// Example usage:
+//
+//	cpy.Func(proto.Clone)
+//
+// This option specifies that proto.Clone is used to copy all types that
+// are assignable to the proto.Message interface.
+func Func(fn interface{}) Option {
+	v := reflect.ValueOf(fn)
+	if !v.IsValid() || v.Kind() != reflect.Func || copyFuncInput(v.Type()) == nil {
+		panic(fmt.Sprintf("cpy.Func: input function %T must be a func([*cpy.Copier,] [cpy.Path,] T) T with an optional error or bool result, or a func(dst, src *T)", fn))
+	}
+	return funcOption("cpy.Func", v, callerSite())
+}
+
+// copyFuncInput returns the input type T of a copy function of type ft,
+// which is nil if ft is not a valid signature for Func.
+func copyFuncInput(ft reflect.Type) reflect.Type {
+	if isInPlaceFunc(ft) {
+		return ft.In(0).Elem()
+	}
+	if ft.IsVariadic() || ft.NumIn() < 1 || ft.NumIn() > 3 || ft.NumOut() < 1 || ft.NumOut() > 2 {
+		return nil
+	}
+	t := ft.In(ft.NumIn() - 1)
+	switch {
+	case ft.NumIn() == 2 && ft.In(0) != copierType && ft.In(0) != pathType:
+		return nil
+	case ft.NumIn() == 3 && (ft.In(0) != copierType || ft.In(1) != pathType):
+		return nil
+	case ft.Out(0) != t:
+		return nil
+	case ft.NumOut() == 2 && ft.Out(1) != errorType && ft.Out(1) != boolType:
+		return nil
+	}
+	return t
+}
+
+// FuncOf is identical to Func, but the signature of the copy function
+// is checked at compile time. The type T must still be a pointer, interface,
+// array, slice, map, or struct; otherwise it will panic.
+//
+// Example usage:
+//
+//	cpy.FuncOf(func(m *pb.Message) *pb.Message {
+//		return proto.Clone(m).(*pb.Message)
+//	})
+func FuncOf[T any](fn func(T) T) Option {
+	if fn == nil {
+		panic("cpy.FuncOf: input function must not be nil")
+	}
+	return funcOption("cpy.FuncOf", reflect.ValueOf(fn), callerSite())
+}
+
+// FuncValue is identical to Func, but provides a copy function for type t
+// that operates on reflect.Value, which is useful when t is only known
+// at runtime (e.g., a type from a codec registry).
+// The copy function fn must return a value of type t.
+//
+// Example usage:
+//
+//	for _, t := range registry.Types() {
+//		opts = append(opts, cpy.FuncValue(t, registry.Clone))
+//	}
+func FuncValue(t reflect.Type, fn func(reflect.Value) reflect.Value) Option {
+	if t == nil || fn == nil {
+		panic("cpy.FuncValue: type and copy function must not be nil")
+	}
+	v := reflect.MakeFunc(
+		reflect.FuncOf([]reflect.Type{t}, []reflect.Type{t}, false), // func(T) T
+		func(in []reflect.Value) []reflect.Value { return []reflect.Value{fn(in[0])} },
+	)
+	return funcOption("cpy.FuncValue", v, callerSite())
+}
+
+// isInPlaceFunc reports whether ft is a func(dst, src *T).
+func isInPlaceFunc(ft reflect.Type) bool {
+	return !ft.IsVariadic() && ft.NumIn() == 2 && ft.NumOut() == 0 &&
+		ft.In(0) == ft.In(1) && ft.In(0).Kind() == reflect.Ptr
+}
+
+// funcOption returns an option for the copy function v
+// created by the option constructor name at the provided site.
+func funcOption(name string, v reflect.Value, site string) Option {
+	t := copyFuncInput(v.Type())
+	if !validKind(t.Kind()) {
+		panic(fmt.Sprintf("%v: input type %v must be a pointer, interface, array, slice, map, or struct", name, t))
+	}
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		panic(fmt.Sprintf("%v: interface type %v must have methods", name, t))
+	}
+	inPlace := isInPlaceFunc(v.Type())
+	if inPlace && t.Kind() == reflect.Interface {
+		panic(fmt.Sprintf("%v: input type %v of in-place function must not be an interface", name, t))
+	}
+	name = fmt.Sprintf("%v(%v)", name, v.Type())
+	return option{rules: []rule{{fnc: v, typ: t, name: name, site: site, strategy: Custom, inPlace: inPlace}}}
+}
+
+// Shallow specifies that the provided type should be shallow copied.
+// The provided type must be a pointer, interface, array, slice, map, or struct;
+// otherwise it will panic.
+//
+// Shallow is equivalent to:
+//
+//	cpy.Func(func(v V) V { return v })
+//
+// Example usage:
+//
+//	cpy.Shallow(time.Time{})
+//
+// Since the fields of time.Time are unexported, the default behavior
+// of Copier.Copy will functionally avoid copying the time value.
+// This option specifies that time.Time is a value that is safe to shallow copy.
+func Shallow(typs ...interface{}) Option {
+	var opt option
+	site := callerSite()
+	for _, typ := range typs {
+		t := reflect.TypeOf(typ)
+		if t == nil || !validKind(t.Kind()) {
+			panic(fmt.Sprintf("cpy.Shallow: input type %v must be a pointer, interface, array, slice, map, or struct", t))
+		}
+		v := reflect.MakeFunc(
+			reflect.FuncOf([]reflect.Type{t}, []reflect.Type{t}, false), // func(T) T
+			func(in []reflect.Value) []reflect.Value { return in },      // shallow copy
+		)
+		name := fmt.Sprintf("cpy.Shallow(%v)", t)
+		opt.rules = append(opt.rules, rule{fnc: v, typ: t, name: name, site: site, strategy: Share})
+	}
+	return opt
+}
+
+// Forbid specifies that values of the provided types must never be copied,
+// such that Copier.Copy panics when it encounters a non-zero value of
+// one of these types. The provided types must be a pointer, interface,
+// array, slice, map, or struct; otherwise it will panic.
+//
+// Forbid is useful for types that own resources which cannot be duplicated
+// by copying memory (e.g., a struct that owns C memory, where a copy would
+// result in a double-free). Such types may alternatively be shared using
+// Shallow or duplicated using a Func that calls an appropriate function.
+//
+// Forbid is implemented in terms of Func and follows the same precedence.
+func Forbid(typs ...interface{}) Option {
+	var opt option
+	site := callerSite()
+	for _, typ := range typs {
+		t := reflect.TypeOf(typ)
+		if t == nil || !validKind(t.Kind()) {
+			panic(fmt.Sprintf("cpy.Forbid: input type %v must be a pointer, interface, array, slice, map, or struct", t))
+		}
+		name := fmt.Sprintf("cpy.Forbid(%v)", t)
+		v := reflect.MakeFunc(
+			reflect.FuncOf([]reflect.Type{t}, []reflect.Type{t}, false), // func(T) T
+			func(in []reflect.Value) []reflect.Value {
+				panic(forbiddenError(t, name, site))
+			},
+		)
+		opt.rules = append(opt.rules, rule{fnc: v, typ: t, name: name, site: site, strategy: Fail})
+	}
+	return opt
+}
+
+// ZeroTypes specifies that values of the provided types are never copied,
+// but replaced with the zero value of their type in the copy.
+// The provided types must be a pointer, interface, array, slice, map,
+// or struct; otherwise it will panic.
+//
+// ZeroTypes is useful for types that hold transient state that must not
+// be carried over into a copy (e.g., caches or synchronization primitives).
+//
+// ZeroTypes is implemented in terms of Func and follows the same precedence.
+//
+// Example usage:
+//
+//	cpy.ZeroTypes(sync.Mutex{}, &lru.Cache{})
+//
+// This option specifies that every mutex in the copy is unlocked and
+// that every cache is dropped from the copy.
+func ZeroTypes(typs ...interface{}) Option {
+	var opt option
+	site := callerSite()
+	for _, typ := range typs {
+		t := reflect.TypeOf(typ)
+		if t == nil || !validKind(t.Kind()) {
+			panic(fmt.Sprintf("cpy.ZeroTypes: input type %v must be a pointer, interface, array, slice, map, or struct", t))
+		}
+		zero := reflect.Zero(t)
+		v := reflect.MakeFunc(
+			reflect.FuncOf([]reflect.Type{t}, []reflect.Type{t}, false), // func(T) T
+			func(in []reflect.Value) []reflect.Value { return []reflect.Value{zero} },
+		)
+		name := fmt.Sprintf("cpy.ZeroTypes(%v)", t)
+		opt.rules = append(opt.rules, rule{fnc: v, typ: t, name: name, site: site, strategy: Ignore})
+	}
+	return opt
+}
+
+// Transformer specifies that every copy of a value of type T is rewritten
+// by the function fn, which must be a function "func(T) T".
+// Unlike Func, it does not take over copying values of type T,
+// but is called with the copy made according to all other options
+// (e.g., a deep copy) and its result is used as the copy instead.
+// It is not called for zero values, which are left as is.
+// The function must not retain or mutate memory shared with the source.
+// If multiple Transformer options are provided for the same type,
+// the latter takes precedence.
+//
 // Example usage:
 //
-//	cpy.Func(proto.Clone)
+//	cpy.Transformer(func(t time.Time) time.Time { return t.Truncate(time.Second) })
 //
-// This option specifies that proto.Clone is used to copy all types that
-// are assignable to the proto.Message interface.
-func Func(fn interface{}) Option {
+// This option specifies that all timestamps are truncated to seconds
+// in the copy, while all other fields are copied as usual.
+func Transformer(fn interface{}) Option {
 	v := reflect.ValueOf(fn)
-	if !v.IsValid() || v.Kind() != reflect.Func ||
-		v.Type().NumIn() != 1 || v.Type().NumOut() != 1 || v.Type().In(0) != v.Type().Out(0) || v.Type().IsVariadic() {
-		panic(fmt.Sprintf("cpy.Func: input function %T must be a func(T) T", fn))
+	if !v.IsValid() || v.Kind() != reflect.Func || v.IsNil() || v.Type().IsVariadic() ||
+		v.Type().NumIn() != 1 || v.Type().NumOut() != 1 || v.Type().In(0) != v.Type().Out(0) {
+		panic(fmt.Sprintf("cpy.Transformer: function %T must be a func(T) T", fn))
 	}
-	if t := v.Type().In(0); !validKind(t.Kind()) {
-		panic(fmt.Sprintf("cpy.Func: input type %v must be a pointer, interface, array, slice, map, or struct", t))
+	return option{transformers: []reflect.Value{v}}
+}
+
+// KindFunc provides specialized copy behavior for all types of kind k
+// (e.g., every map type or every channel type). The copy function fn is
+// called with the Copier performing the copy and a non-zero value to copy,
+// and must return a value of the same type. It may decline to copy the value
+// by returning an invalid reflect.Value, in which case the value is copied
+// according to the default behavior.
+//
+// Func, Shallow, and Forbid options take precedence over KindFunc,
+// regardless of order. Among KindFunc, FuncIf, and ShallowIf options
+// matching the same type, the latter option takes precedence.
+//
+// Example usage:
+//
+//	cpy.KindFunc(reflect.Chan, func(c *cpy.Copier, v reflect.Value) reflect.Value {
+//		return reflect.MakeChan(v.Type(), v.Cap())
+//	})
+//
+// This option specifies that every channel is copied as a new channel
+// with the same capacity, rather than being shared.
+func KindFunc(k reflect.Kind, fn func(c *Copier, v reflect.Value) reflect.Value) Option {
+	if k == reflect.Invalid {
+		panic("cpy.KindFunc: kind must be valid")
 	}
-	if t := v.Type().In(0); t.Kind() == reflect.Interface && t.NumMethod() == 0 {
-		panic(fmt.Sprintf("cpy.Func: interface type %v must have methods", t))
+	if fn == nil {
+		panic("cpy.KindFunc: copy function must not be nil")
 	}
-	return Option{copyFuncs: []reflect.Value{v}}
+	return option{matchers: []matcher{{
+		name: fmt.Sprintf("cpy.KindFunc(%v)", k),
+		cond: func(t reflect.Type) bool { return t.Kind() == k },
+		fn:   fn,
+		site: callerSite(),
+	}}}
 }
 
-// Shallow specifies that the provided type should be shallow copied.
-// The provided type must be a pointer, interface, array, slice, map, or struct;
-// otherwise it will panic.
+// FuncIf is identical to KindFunc, but applies to all types
+// for which cond reports true.
+// The result of cond is cached for each type,
+// so it must be deterministic and safe for concurrent use.
+func FuncIf(cond func(reflect.Type) bool, fn func(c *Copier, v reflect.Value) reflect.Value) Option {
+	if cond == nil || fn == nil {
+		panic("cpy.FuncIf: condition and copy function must not be nil")
+	}
+	return option{matchers: []matcher{{name: "cpy.FuncIf", cond: cond, fn: fn, site: callerSite()}}}
+}
+
+// ShallowIf specifies that all types for which cond reports true
+// are shallow copied. It follows the same precedence as KindFunc.
+// The result of cond is cached for each type,
+// so it must be deterministic and safe for concurrent use.
 //
-// Shallow is equivalent to:
+// Example usage:
 //
-//	cpy.Func(func(v V) V { return v })
+//	cpy.ShallowIf(func(t reflect.Type) bool {
+//		return strings.HasSuffix(t.Name(), "Proto")
+//	})
+//
+// This option specifies that all types with a name ending in "Proto"
+// are shallow copied.
+func ShallowIf(cond func(reflect.Type) bool) Option {
+	if cond == nil {
+		panic("cpy.ShallowIf: condition must not be nil")
+	}
+	return option{matchers: []matcher{{name: "cpy.ShallowIf", cond: cond, site: callerSite()}}}
+}
+
+// ShallowNamed is identical to Shallow, but specifies types by their
+// fully-qualified name, which is the import path of the declaring package
+// followed by a dot and the name of the type (e.g., "example.com/app/internal/cache.Entry").
+// This is useful for types that cannot be referenced at compile time
+// (e.g., types declared in an internal package or loaded by a plugin).
+// It follows the same precedence as KindFunc.
 //
 // Example usage:
 //
-//	cpy.Shallow(time.Time{})
+//	cpy.ShallowNamed("example.com/vendor/internal/pool.Conn")
 //
-// Since the fields of time.Time are unexported, the default behavior
-// of Copier.Copy will functionally avoid copying the time value.
-// This option specifies that time.Time is a value that is safe to shallow copy.
-func Shallow(typs ...interface{}) Option {
-	var opt Option
-	for _, typ := range typs {
-		t := reflect.TypeOf(typ)
-		if t == nil || !validKind(t.Kind()) {
-			panic(fmt.Sprintf("cpy.Shallow: input type %v must be a pointer, interface, array, slice, map, or struct", t))
+// This option specifies that values of the unexported pool.Conn type
+// are shallow copied.
+func ShallowNamed(names ...string) Option {
+	set := typeNameSet("cpy.ShallowNamed", names)
+	return option{matchers: []matcher{{
+		name:  fmt.Sprintf("cpy.ShallowNamed(%v)", strings.Join(names, ", ")),
+		cond:  func(t reflect.Type) bool { return set[typeName(t)] },
+		names: set,
+		site:  callerSite(),
+	}}}
+}
+
+// FuncNamed is identical to KindFunc, but applies to the type with
+// the provided fully-qualified name (see ShallowNamed).
+func FuncNamed(name string, fn func(c *Copier, v reflect.Value) reflect.Value) Option {
+	set := typeNameSet("cpy.FuncNamed", []string{name})
+	if fn == nil {
+		panic("cpy.FuncNamed: copy function must not be nil")
+	}
+	return option{matchers: []matcher{{
+		name:  fmt.Sprintf("cpy.FuncNamed(%v)", name),
+		cond:  func(t reflect.Type) bool { return set[typeName(t)] },
+		names: set,
+		fn:    fn,
+		site:  callerSite(),
+	}}}
+}
+
+// ShallowPackages specifies that all types declared in packages matching
+// one of the patterns, and pointers to such types, are shallow copied.
+// This is useful for entire trees of packages whose types are trusted to be
+// immutable, where enumerating every type is unmaintainable.
+// Patterns have the same form as for AllowUnexportedPackages.
+// It follows the same precedence as KindFunc.
+//
+// Example usage:
+//
+//	cpy.ShallowPackages("google.golang.org/protobuf/...", "example.com/immutable/...")
+//
+// This option specifies that all protobuf runtime types and all types
+// of the example.com/immutable packages are shallow copied.
+func ShallowPackages(patterns ...string) Option {
+	for _, p := range patterns {
+		if p == "" || p == "..." {
+			panic(fmt.Sprintf("cpy.ShallowPackages: invalid pattern %q", p))
 		}
-		v := reflect.MakeFunc(
+	}
+	patterns = append([]string(nil), patterns...)
+	return option{matchers: []matcher{{
+		name: fmt.Sprintf("cpy.ShallowPackages(%v)", strings.Join(patterns, ", ")),
+		cond: func(t reflect.Type) bool {
+			if t.Kind() == reflect.Ptr && t.Name() == "" {
+				t = t.Elem()
+			}
+			for _, p := range patterns {
+				if matchPackage(p, t.PkgPath()) {
+					return true
+				}
+			}
+			return false
+		},
+		site: callerSite(),
+	}}}
+}
+
+// typeNameSet returns the set of fully-qualified type names,
+// panicking on behalf of the option op if any name is malformed.
+func typeNameSet(op string, names []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range names {
+		if err := checkTypeName(name); err != nil {
+			panic(fmt.Sprintf("%v: %v", op, err))
+		}
+		set[name] = true
+	}
+	return set
+}
+
+// checkTypeName reports an error if name is not a fully-qualified type name.
+func checkTypeName(name string) error {
+	if i := strings.LastIndexByte(name, '.'); i <= 0 || i == len(name)-1 || strings.LastIndexByte(name, '/') > i {
+		return fmt.Errorf("invalid type name %q; want an import path followed by a dot and a type name", name)
+	}
+	return nil
+}
+
+// typeName returns the fully-qualified name of a named type t,
+// or the empty string if t is unnamed.
+func typeName(t reflect.Type) string {
+	if t.Name() == "" || t.PkgPath() == "" {
+		return ""
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+// matcher is an option that copies all types matching a condition.
+type matcher struct {
+	name string // e.g., "cpy.KindFunc(map)"
+	cond func(reflect.Type) bool
+	fn   func(*Copier, reflect.Value) reflect.Value // nil to shallow copy
+	site string
+
+	// names is the set of fully-qualified names of the types matched
+	// by cond (see ShallowNamed); nil if cond is an arbitrary predicate.
+	names map[string]bool
+
+	paths []func(Path) bool // see rule.paths
+}
+
+// ruleFor returns a rule that copies values of type t using m.
+func (m matcher) ruleFor(t reflect.Type) *rule {
+	if m.fn == nil {
+		fnc := reflect.MakeFunc(
 			reflect.FuncOf([]reflect.Type{t}, []reflect.Type{t}, false), // func(T) T
 			func(in []reflect.Value) []reflect.Value { return in },      // shallow copy
 		)
-		opt.copyFuncs = append(opt.copyFuncs, v)
+		return &rule{fnc: fnc, typ: t, name: m.name, site: m.site, strategy: Share}
+	}
+	ft := reflect.FuncOf([]reflect.Type{copierType, t}, []reflect.Type{t, boolType}, false) // func(*Copier, T) (T, bool)
+	fnc := reflect.MakeFunc(ft, func(in []reflect.Value) []reflect.Value {
+		out := m.fn(in[0].Interface().(*Copier), in[1])
+		if !out.IsValid() {
+			return []reflect.Value{reflect.Zero(t), reflect.ValueOf(false)}
+		}
+		return []reflect.Value{out, reflect.ValueOf(true)}
+	})
+	return &rule{fnc: fnc, typ: t, name: m.name, site: m.site, strategy: Custom}
+}
+
+// Immutable specifies that values of the provided types are never mutated,
+// such that they can be shared freely between the source and the copy.
+// Values of these types and pointers to such values are shallow copied
+// without ever being traversed.
+//
+// Unlike Shallow, which only controls how the type itself is copied,
+// Immutable allows Copier.Copy to treat the type as if it needed no deep copy
+// in any context. For example, a slice of structs whose fields are all
+// either primitive types or immutable types can be copied in bulk.
+// Func and Shallow options operating on an immutable type
+// take precedence over this option.
+//
+// Example usage:
+//
+//	cpy.Immutable(time.Time{}, language.Tag{})
+//
+// Since time.Time and language.Tag are never mutated once constructed,
+// this option specifies that they (and pointers to them) may be shared.
+func Immutable(typs ...interface{}) Option {
+	var opt option
+	for _, typ := range typs {
+		t := reflect.TypeOf(typ)
+		if t == nil {
+			panic("cpy.Immutable: input type must not be nil")
+		}
+		opt.immutableTypes = append(opt.immutableTypes, t)
+	}
+	return opt
+}
+
+// ImmutableNamed is identical to Immutable, but specifies types by their
+// fully-qualified name (see ShallowNamed).
+func ImmutableNamed(names ...string) Option {
+	typeNameSet("cpy.ImmutableNamed", names) // validate names
+	return option{immutableNames: append([]string(nil), names...)}
+}
+
+// Override specifies that the Func and Shallow options within opt
+// take precedence over all options not wrapped by Override.
+// This is useful when opt must be applied regardless of the order
+// in which options were assembled or whether another option operates on
+// a more specific type (e.g., a concrete type instead of an interface type).
+// Among options wrapped by Override, the usual precedence rules apply
+// as described by Copier.Copy.
+// Override is equivalent to Priority(1, opt), unless opt already
+// has a higher priority.
+//
+// Example usage:
+//
+//	cpy.Override(cpy.Func(proto.Clone))
+//
+// This option specifies that proto.Clone is used to copy all types that
+// are assignable to the proto.Message interface, even if another option
+// specifies a Func or Shallow for a concrete message type.
+func Override(opt Option) Option {
+	return mapOptions(opt, func(opt option) option {
+		if opt.priority < 1 {
+			opt.priority = 1
+		}
+		return opt
+	})
+}
+
+// Priority specifies that the Func, Shallow, and Forbid options within opt
+// have priority n, replacing any priority previously specified for them.
+// Options of a higher priority take precedence over all options of
+// a lower priority, regardless of the order in which options were
+// assembled or the types that they operate on. Among options of the same
+// priority, the usual precedence rules apply as described by Copier.Copy.
+// Options have a priority of zero by default and
+// options wrapped by Override have a priority of one.
+//
+// Example usage:
+//
+//	cpy.New(
+//		cpy.Priority(10, storage.Options), // always takes precedence
+//		billing.Options,
+//		cpy.Priority(-1, defaults.Options), // only used as a fallback
+//	)
+func Priority(n int, opt Option) Option {
+	return mapOptions(opt, func(opt option) option {
+		opt.priority = n
+		return opt
+	})
+}
+
+// rulePriorities returns the distinct priorities of all rules
+// in descending order.
+func rulePriorities(rss ...[]rule) []int {
+	var ps []int
+	seen := make(map[int]bool)
+	for _, rs := range rss {
+		for _, r := range rs {
+			if !seen[r.priority] {
+				seen[r.priority] = true
+				ps = append(ps, r.priority)
+			}
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ps)))
+	return ps
+}
+
+// Structural specifies that the Func and Shallow options within opt
+// also apply to any type with an underlying type identical to
+// the type that the option operates on (ignoring struct tags).
+// Values are converted to the option's type before calling the
+// copy function and the result is converted back to the original type.
+// Structural does not affect options operating on interface types.
+//
+// By default, an option only applies to a type identical to the type
+// it operates on. For unnamed types (e.g., struct{ X int }), this
+// includes all occurrences of an identical type literal, such as the
+// type of an anonymous struct field. With Structural, the option also
+// applies to named types defined in terms of it (e.g., type P struct{ X int }).
+//
+// Among options of the same precedence, an option operating on the
+// exact type takes precedence over a structural match.
+//
+// Example usage:
+//
+//	cpy.Structural(cpy.Shallow(struct{ X, Y float64 }{}))
+//
+// This option specifies that all types with an underlying type of
+// struct{ X, Y float64 } (e.g., type Point struct{ X, Y float64 })
+// are shallow copied.
+func Structural(opt Option) Option {
+	return mapOptions(opt, func(opt option) option {
+		opt.structural = true
+		return opt
+	})
+}
+
+// If specifies that the Func, Shallow, and Forbid options within opt
+// only apply to types for which cond reports true.
+// The type passed to cond is the type of the value being copied,
+// which may differ from the type that an option operates on
+// (e.g., a concrete type implementing an interface type).
+// For types where cond reports false, options of lower precedence apply
+// as if the options within opt were not specified.
+// It panics if opt contains any other kind of option.
+//
+// The result of cond is cached for each type,
+// so it must be deterministic and safe for concurrent use.
+//
+// Example usage:
+//
+//	cpy.If(func(t reflect.Type) bool {
+//		return strings.HasPrefix(t.PkgPath(), "example.com/storage/")
+//	}, cpy.Func(proto.Clone))
+//
+// This option specifies that proto.Clone is only used to copy
+// messages declared in the example.com/storage packages.
+func If(cond func(reflect.Type) bool, opt Option) Option {
+	if cond == nil {
+		panic("cpy.If: condition must not be nil")
+	}
+	return mapOptions(opt, func(opt option) option {
+		if !opt.onlyRules() || len(opt.matchers) > 0 {
+			panic("cpy.If: option must only consist of Func, Shallow, or Forbid options")
+		}
+		rules := make([]rule, len(opt.rules))
+		for i, r := range opt.rules {
+			r.conds = append(r.conds[:len(r.conds):len(r.conds)], cond)
+			rules[i] = r
+		}
+		opt.rules = rules
+		return opt
+	})
+}
+
+// Without derives an option from opt with all Func, Shallow, Immutable,
+// and Transformer rules that match any of the provided selectors removed,
+// including types provided by name (e.g., to ShallowNamed, FuncNamed,
+// or ImmutableNamed). Options that match types by a predicate
+// (e.g., KindFunc, ShallowIf, FuncIf, or ShallowPackages) cannot be
+// removed, as there is no means of excluding a single type from them.
+// All other aspects of opt are preserved as is.
+//
+// Example usage:
+//
+//	cpy.Without(presets, cpy.ForType(time.Time{}))
+//
+// This option is identical to presets, except that it does not specify
+// how time.Time values are copied.
+func Without(opt Option, sels ...Selector) Option {
+	return mapOptions(opt, func(opt option) option {
+		return opt.without(sels)
+	})
+}
+func (opt option) without(sels []Selector) option {
+	selected := func(t reflect.Type) bool {
+		for _, sel := range sels {
+			if sel.typ == t {
+				return true
+			}
+		}
+		return false
+	}
+	selectedName := func(name string) bool {
+		for _, sel := range sels {
+			if name != "" && typeName(sel.typ) == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	var rules []rule
+	for _, r := range opt.rules {
+		if !selected(r.typ) {
+			rules = append(rules, r)
+		}
+	}
+	opt.rules = rules
+
+	var immutableTypes []reflect.Type
+	for _, t := range opt.immutableTypes {
+		if !selected(t) {
+			immutableTypes = append(immutableTypes, t)
+		}
+	}
+	opt.immutableTypes = immutableTypes
+
+	var immutableNames []string
+	for _, name := range opt.immutableNames {
+		if !selectedName(name) {
+			immutableNames = append(immutableNames, name)
+		}
+	}
+	opt.immutableNames = immutableNames
+
+	var matchers []matcher
+	for _, m := range opt.matchers {
+		if m.names != nil {
+			set := make(map[string]bool)
+			for name := range m.names {
+				if !selectedName(name) {
+					set[name] = true
+				}
+			}
+			if len(set) == 0 {
+				continue
+			}
+			m.names, m.cond = set, func(t reflect.Type) bool { return set[typeName(t)] }
+		}
+		matchers = append(matchers, m)
+	}
+	opt.matchers = matchers
+
+	var transformers []reflect.Value
+	for _, fn := range opt.transformers {
+		if !selected(fn.Type().In(0)) {
+			transformers = append(transformers, fn)
+		}
 	}
+	opt.transformers = transformers
 	return opt
 }
 
-// TODO: Add AllowUnexported(typs ...interface{}) option.
-// TODO: Add IgnoreUnexported(typs ...interface{}) option.
+// Selector selects a subset of the rules within an Option.
+// A selector must be obtained using a constructor (e.g., ForType).
+type Selector struct {
+	typ reflect.Type
+}
+
+// ForType selects the Func, Shallow, Immutable, and Transformer rules
+// that operate on the type of typ (see Without).
+// Rules operating on an interface type I are selected by
+// passing a nil pointer to the interface type (e.g., (*I)(nil)).
+func ForType(typ interface{}) Selector {
+	t := reflect.TypeOf(typ)
+	if t == nil {
+		panic("cpy.ForType: input type must not be nil")
+	}
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Interface {
+		t = t.Elem()
+	}
+	return Selector{typ: t}
+}
 
 // IgnoreAllUnexported specifies that Copy should ignore all unexported fields
 // as opposed to panicking when encountering an unexported field.
 func IgnoreAllUnexported() Option {
-	return Option{ignoreAllUnexported: true}
+	return option{ignoreAllUnexported: true}
+}
+
+// IgnoreUnexported is identical to IgnoreAllUnexported, but only ignores
+// the unexported fields of the provided struct types, such that Copy still
+// panics when encountering an unexported field of any other type.
+// Unexported fields copied according to AllowUnexportedPackages
+// are copied regardless of this option.
+//
+// Example usage:
+//
+//	cpy.IgnoreUnexported(vendor.Client{}, vendor.Session{})
+//
+// This option specifies that the unexported fields of two vendored types
+// are ignored, while unexported fields of all other types are reported.
+func IgnoreUnexported(typs ...interface{}) Option {
+	var opt option
+	for _, typ := range typs {
+		t := reflect.TypeOf(typ)
+		if t == nil || t.Kind() != reflect.Struct {
+			panic(fmt.Sprintf("cpy.IgnoreUnexported: input type %v must be a struct", t))
+		}
+		opt.ignoreUnexported = append(opt.ignoreUnexported, t)
+	}
+	return opt
+}
+
+// ignoresUnexported reports whether the unexported fields of struct t
+// are ignored unless copied according to AllowUnexportedPackages.
+func (c *Copier) ignoresUnexported(t reflect.Type) bool {
+	if c.ignoreAllUnexported || c.ignoreUnexported[t] {
+		return true
+	}
+	for _, pattern := range c.ignoreUnexportedPackages {
+		if matchPackage(pattern, t.PkgPath()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Trace specifies a function that is called at the start of every copy
+// with the name of the operation (e.g., "Copy" or "Clone") and the type of the
+// root value being copied. If the function returns a non-nil function,
+// then it is called at the end of the copy (even if the copy panics)
+// with statistics about the copy.
+// If multiple Trace options are provided, they are called in the order
+// that they were passed to New.
+//
+// Trace allows copies to be wrapped by tracing spans without
+// this package depending on any particular tracing library.
+//
+// Example usage:
+//
+//	cpy.Trace(func(op string, t reflect.Type) func(cpy.Stats) {
+//		_, span := tracer.Start(ctx, "cpy."+op)
+//		span.SetAttributes(attribute.String("type", t.String()))
+//		return func(s cpy.Stats) {
+//			span.SetAttributes(attribute.Int("nodes", s.Nodes))
+//			span.End()
+//		}
+//	})
+func Trace(start func(op string, t reflect.Type) func(Stats)) Option {
+	if start == nil {
+		panic("cpy.Trace: start function must not be nil")
+	}
+	return option{traces: []func(string, reflect.Type) func(Stats){start}}
+}
+
+// CopyFn copies a single value and returns the copy,
+// which must have the same type as src.
+type CopyFn func(src reflect.Value) reflect.Value
+
+// Middleware specifies that the copy of every value is performed by
+// calling m with the next step of copying, which copies the value
+// according to the other options (calling middleware for elements of
+// the value as well). The middleware may observe the value,
+// alter the copy returned by next, or not call next at all.
+// Middleware provided earlier to New wrap those provided later.
+//
+// Every value visited by Copier.Copy passes through the middleware,
+// including zero values, values that need no deep copy, and every element
+// of slices and field of structs (even if they would otherwise be copied
+// in bulk, such as with UnsafeFieldAccess).
+// Elements of values that need no deep copy (e.g., the fields of
+// a struct with only fields of primitive types) are not visited.
+//
+// Example usage:
+//
+//	cpy.Middleware(func(next cpy.CopyFn) cpy.CopyFn {
+//		return func(src reflect.Value) reflect.Value {
+//			counts[src.Type()]++
+//			return next(src)
+//		}
+//	})
+//
+// This option counts the number of values copied of each type.
+func Middleware(m func(next CopyFn) CopyFn) Option {
+	if m == nil {
+		panic("cpy.Middleware: middleware function must not be nil")
+	}
+	return option{middleware: []middlewareFunc{func(_ *Path, next CopyFn) CopyFn { return m(next) }}}
+}
+
+// middlewareFunc wraps the copy of every value (see Middleware), where path
+// points to the path to the current value if paths are tracked.
+type middlewareFunc func(path *Path, next CopyFn) CopyFn
+
+// UnsafeFieldAccess specifies that struct fields are accessed using
+// cached field offsets and package unsafe rather than through reflection.
+// Adjacent fields that contain no pointers and need no deep copy
+// are copied together as a single block of memory.
+// This can significantly speed up copying of large structs.
+//
+// The observable behavior of Copier.Copy is identical regardless of
+// whether this option is specified. However, users must accept that
+// the implementation depends on unsafe for the option to be used.
+func UnsafeFieldAccess() Option {
+	return option{unsafeFieldAccess: true}
+}
+
+// AllowUnexportedPackages specifies that unexported struct fields are copied
+// (using package unsafe) if either the field is declared in
+// a package matching one of the patterns or the field type
+// (or the type it points to) is declared in such a package.
+// This permits copying structs that embed unexported types from packages
+// that the user controls, where enumerating the types is impossible.
+// Unexported fields that are copied are otherwise treated the same as
+// exported fields (e.g., Func and Shallow options apply to them).
+//
+// A pattern is either an exact package path (e.g., "example.com/fork/pkg")
+// or a package path followed by "/..." (e.g., "example.com/fork/...")
+// to match that package and all packages beneath it.
+//
+// Users must accept that the copy of an unexported field may not be
+// semantically correct since the field may be an implementation detail
+// (e.g., a sync.Mutex) that is not safe to copy.
+func AllowUnexportedPackages(patterns ...string) Option {
+	for _, p := range patterns {
+		if p == "" || p == "..." {
+			panic(fmt.Sprintf("cpy.AllowUnexportedPackages: invalid pattern %q", p))
+		}
+	}
+	return option{unexportedPackages: append([]string(nil), patterns...)}
+}
+
+// CopyUnexported specifies that all unexported fields of the provided
+// struct types are copied (using package unsafe), such that values of
+// those types are fully deep copied rather than having their unexported
+// fields ignored. It is identical to AllowUnexportedPackages,
+// but applies to specific types instead of all types in a package.
+// The same caveats apply.
+//
+// Example usage:
+//
+//	cpy.CopyUnexported(vendor.Cache{})
+//
+// This option specifies that the private state of vendor.Cache is
+// deep copied along with its exported fields.
+func CopyUnexported(typs ...interface{}) Option {
+	var opt option
+	for _, typ := range typs {
+		t := reflect.TypeOf(typ)
+		if t == nil || t.Kind() != reflect.Struct {
+			panic(fmt.Sprintf("cpy.CopyUnexported: input type %v must be a struct", t))
+		}
+		opt.copyUnexported = append(opt.copyUnexported, t)
+	}
+	return opt
+}
+
+// IteratorPolicy specifies how iterator functions are copied.
+// An iterator function is any function type of the form
+// "func(yield func(V) bool)" or "func(yield func(K, V) bool)",
+// which includes iter.Seq and iter.Seq2.
+type IteratorPolicy int
+
+const (
+	_ IteratorPolicy = iota
+
+	// ShareIterators specifies that iterator functions are shallow copied
+	// like all other functions. This is the default.
+	ShareIterators
+
+	// DropIterators specifies that iterator functions are not copied,
+	// such that they are nil in the copy.
+	DropIterators
+
+	// MaterializeIterators specifies that iterator functions are
+	// called once during the copy to collect the entire sequence.
+	// Every value yielded is deep copied and the copy holds
+	// a new iterator function that yields the copied values in order.
+	// The source iterator must be finite.
+	MaterializeIterators
+)
+
+// Iterators specifies how iterator functions are copied.
+// See IteratorPolicy for details.
+//
+// Example usage:
+//
+//	cpy.Iterators(cpy.MaterializeIterators)
+//
+// This option specifies that the sequences produced by iterators
+// are captured by the copy, such that the copy is independent of
+// any state that the source iterators close over.
+func Iterators(p IteratorPolicy) Option {
+	if p < ShareIterators || p > MaterializeIterators {
+		panic(fmt.Sprintf("cpy.Iterators: invalid policy %d", int(p)))
+	}
+	return option{iterators: p}
+}
+
+// Substitute specifies that values held within interface types
+// whose dynamic type is a key in m are converted to the corresponding
+// type in m and copied as values of that type. Every key must be convertible to its value
+// (e.g., a defined type to another with the same underlying type),
+// otherwise Substitute panics.
+//
+// A value is only substituted if the substitute type still implements
+// the interface type that it is held within. Values of a statically
+// known type (e.g., a struct field of the key type) are never substituted
+// since that would change the type of the containing value.
+// The top-level value passed to Copier.Copy is never substituted.
+// For keys appearing in multiple Substitute options,
+// the one passed later to New takes precedence.
+//
+// Example usage:
+//
+//	cpy.Substitute(map[reflect.Type]reflect.Type{
+//		reflect.TypeOf(legacy.ID("")): reflect.TypeOf(ids.ID("")),
+//	})
+//
+// This option specifies that every legacy.ID held within an interface
+// (e.g., the values of a map[string]interface{}) becomes an ids.ID.
+func Substitute(m map[reflect.Type]reflect.Type) Option {
+	opt := option{substitutes: make(map[reflect.Type]reflect.Type, len(m))}
+	for from, to := range m {
+		if from == nil || to == nil || !from.ConvertibleTo(to) {
+			panic(fmt.Sprintf("cpy.Substitute: type %v is not convertible to %v", from, to))
+		}
+		opt.substitutes[from] = to
+	}
+	return opt
+}
+
+// Rebind specifies that values of a concrete type X held within
+// an interface type I are replaced in the copy by the result of fn,
+// which must be a function "func(X) I", otherwise Rebind panics.
+// The function is called with the copy of the value, which is
+// produced as usual (e.g., according to a Func for X), and may return
+// a wrapper around it or an alternative implementation of I.
+//
+// Values are only rebound if the interface type they are held within
+// is exactly I. For example, an X held within an interface{}
+// is copied as usual. For functions operating on the same X and I,
+// the one passed later to New takes precedence.
+//
+// Example usage:
+//
+//	cpy.Rebind(func(s *sql.Store) storage.Store {
+//		return &instrumented.Store{Store: s}
+//	})
+//
+// This option specifies that every *sql.Store held within a
+// storage.Store is instrumented in the copy.
+func Rebind(fn interface{}) Option {
+	v := reflect.ValueOf(fn)
+	if !v.IsValid() || v.Kind() != reflect.Func || v.Type().IsVariadic() ||
+		v.Type().NumIn() != 1 || v.Type().NumOut() != 1 || v.Type().Out(0).Kind() != reflect.Interface {
+		panic(fmt.Sprintf("cpy.Rebind: input function %T must be a func(X) I, where I is an interface type", fn))
+	}
+	if x, i := v.Type().In(0), v.Type().Out(0); x.Kind() == reflect.Interface || !x.Implements(i) {
+		panic(fmt.Sprintf("cpy.Rebind: input type %v must be a concrete type implementing %v", x, i))
+	}
+	return option{rebinds: []reflect.Value{v}}
+}
+
+// rebindKey is the key for functions provided by Rebind.
+type rebindKey struct {
+	iface reflect.Type // interface type I
+	conc  reflect.Type // concrete type X
+}
+
+// NormalizeNumbers specifies that numeric values held within interface types
+// (e.g., the values of a map[string]interface{}) are normalized to
+// a canonical dynamic type so that copies have predictable types.
+//
+// Numeric values are normalized according to the following rules:
+//
+// • Signed integers, and unsigned integers that fit within an int64,
+// are converted to int64.
+//
+// • Floating-point numbers that are whole and fit within an int64
+// are converted to int64, while all other finite and non-finite
+// floating-point numbers are converted to float64.
+//
+// • A json.Number is parsed and normalized as either an integer or
+// a floating-point number according to the rules above.
+// Invalid numbers are left as is.
+//
+// Only numbers of the predeclared numeric types (e.g., int32 or float64)
+// or json.Number are normalized; other named types (e.g., time.Duration)
+// are left as is. A number is only normalized if the normalized type
+// still implements the interface type that it is held within.
+// The top-level value passed to Copier.Copy is never normalized.
+func NormalizeNumbers() Option {
+	return option{normalizeNumbers: true}
+}
+
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+
+// normalizeNumber normalizes v according to the rules of NormalizeNumbers
+// if the normalized type implements the interface type t.
+// Otherwise, it returns v as is.
+func normalizeNumber(v reflect.Value, t reflect.Type) reflect.Value {
+	var n interface{}
+	switch {
+	case v.Type() == jsonNumberType:
+		if i, err := v.Interface().(json.Number).Int64(); err == nil {
+			n = i
+		} else if f, err := v.Interface().(json.Number).Float64(); err == nil {
+			n = normalizeFloat(f)
+		}
+	case v.Type().PkgPath() != "":
+		// Avoid normalizing named types since they carry semantic meaning.
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		n = v.Int()
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uintptr:
+		if u := v.Uint(); u <= math.MaxInt64 {
+			n = int64(u)
+		}
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		n = normalizeFloat(v.Float())
+	}
+	if n == nil || !reflect.TypeOf(n).Implements(t) {
+		return v
+	}
+	return reflect.ValueOf(n)
+}
+func normalizeFloat(f float64) interface{} {
+	if f == math.Trunc(f) && -(1<<63) <= f && f < 1<<63 {
+		return int64(f)
+	}
+	return f
 }
 
 func validKind(k reflect.Kind) bool {
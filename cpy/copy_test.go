@@ -6,8 +6,15 @@ package cpy_test
 
 import (
 	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -55,6 +62,10 @@ type S struct {
 	PTi *time.Time
 }
 
+type Point struct{ X, Y, z int }
+type PointAlias = Point
+type PointDefined Point
+
 type Proto interface{ Proto() }
 type ProtoM1 interface{ ProtoM1() }
 type ProtoM2 interface{ ProtoM2() }
@@ -100,6 +111,303 @@ func Test(t *testing.T) {
 		src:     S{Ti: now, PTi: &now},
 		cpyOpts: []cpy.Option{cpy.Func(func(t time.Time) time.Time { return t })},
 		reason:  "unexported fields of time.Time copied because we provide custom copy function",
+	}, {
+		src:     S{Ti: now, PTi: &now},
+		cpyOpts: []cpy.Option{cpy.FuncOf(func(t time.Time) time.Time { return t })},
+		reason:  "unexported fields of time.Time copied because we provide typed custom copy function",
+	}, {
+		src:     S{Ti: now, PTi: &now},
+		cpyOpts: []cpy.Option{cpy.FuncValue(reflect.TypeOf(time.Time{}), func(v reflect.Value) reflect.Value { return v })},
+		reason:  "unexported fields of time.Time copied because we provide reflective custom copy function",
+	}, {
+		src: struct{ X, Y *M }{&M{A: 1}, &M{A: 2}},
+		cpyOpts: []cpy.Option{cpy.Func(func(m *M) (*M, bool) {
+			return m, m.A == 1 // only share the first value
+		})},
+		cmpOpts: []cmp.Option{cmp.AllowUnexported(M{})},
+		verify: func(t *testing.T, dst, src interface{}) {
+			d, s := dst.(struct{ X, Y *M }), src.(struct{ X, Y *M })
+			if d.X != s.X || d.Y == s.Y {
+				t.Errorf("(X, Y) shared = (%v, %v), want (true, false)", d.X == s.X, d.Y == s.Y)
+			}
+		},
+		reason: "custom copy function declines to copy some values",
+	}, {
+		src: S{Pt: &S{S: "inner", Sl: []M1{{A: 1}, {A: 2}}}},
+		cpyOpts: []cpy.Option{cpy.Func(func(c *cpy.Copier, sl []M1) []M1 {
+			out := make([]M1, len(sl), cap(sl))
+			for i := range sl {
+				out[i] = c.Copy(sl[i]).(M1) // deep copy each element
+			}
+			return out
+		})},
+		verify: func(t *testing.T, dst, src interface{}) {
+			d, s := dst.(S), src.(S)
+			if &d.Pt.Sl[0] == &s.Pt.Sl[0] {
+				t.Errorf("S.Pt.Sl shares memory with the source")
+			}
+		},
+		reason: "custom copy function uses the copier to copy nested values",
+	}, {
+		src: S{Sl: []M1{{A: 1, a: 1}, {A: 2, a: 2}}, M1a: M1{A: 3, a: 3}, M1b: &M1{A: 4, a: 4}},
+		cpyOpts: []cpy.Option{cpy.Func(func(dst, src *M1) {
+			*dst = *src // including unexported fields
+		})},
+		verify: func(t *testing.T, dst, src interface{}) {
+			if d, s := dst.(S), src.(S); &d.Sl[0] == &s.Sl[0] || d.M1b == s.M1b {
+				t.Errorf("S.Sl or S.M1b shares memory with the source")
+			}
+		},
+		reason: "in-place copy function populates allocated values",
+	}, {
+		src: S{Ch: make(chan int, 3), Ma1: map[string]M1{"a": {A: 1}}},
+		cpyOpts: []cpy.Option{
+			cpy.KindFunc(reflect.Chan, func(c *cpy.Copier, v reflect.Value) reflect.Value {
+				return reflect.MakeChan(v.Type(), v.Cap())
+			}),
+			cpy.KindFunc(reflect.Map, func(c *cpy.Copier, v reflect.Value) reflect.Value {
+				return reflect.Value{} // decline to copy
+			}),
+		},
+		cmpOpts: []cmp.Option{cmpopts.IgnoreFields(S{}, "Ch")},
+		verify: func(t *testing.T, dst, src interface{}) {
+			if d, s := dst.(S), src.(S); d.Ch == s.Ch || cap(d.Ch) != cap(s.Ch) {
+				t.Errorf("S.Ch = %v (cap %d), want new channel with cap %d", d.Ch, cap(d.Ch), cap(s.Ch))
+			}
+		},
+		reason: "kind functions copy every channel and decline to copy maps",
+	}, {
+		src: S{If: &M{A: 1}},
+		cpyOpts: []cpy.Option{
+			cpy.KindFunc(reflect.Interface, func(c *cpy.Copier, v reflect.Value) reflect.Value {
+				return reflect.Zero(v.Type())
+			}),
+		},
+		cmpOpts: []cmp.Option{cmpopts.IgnoreFields(S{}, "If")},
+		verify: func(t *testing.T, dst, src interface{}) {
+			if d := dst.(S); d.If != nil {
+				t.Errorf("S.If = %v, want nil", d.If)
+			}
+		},
+		reason: "kind function copies interfaces as nil interfaces",
+	}, {
+		src: S{Mb: &M{A: 1}, M1b: &M1{A: 2}, M2b: &M2{A: 3}},
+		cpyOpts: []cpy.Option{
+			cpy.ShallowIf(func(t reflect.Type) bool {
+				return t.Kind() == reflect.Ptr && strings.HasPrefix(t.Elem().Name(), "M")
+			}),
+			cpy.FuncIf(func(t reflect.Type) bool { return t == reflect.TypeOf(&M2{}) }, func(c *cpy.Copier, v reflect.Value) reflect.Value {
+				return reflect.ValueOf(&M2{A: v.Interface().(*M2).A})
+			}),
+		},
+		verify: func(t *testing.T, dst, src interface{}) {
+			d, s := dst.(S), src.(S)
+			if d.Mb != s.Mb || d.M1b != s.M1b || d.M2b == s.M2b {
+				t.Errorf("(Mb, M1b, M2b) shared = (%v, %v, %v), want (true, true, false)", d.Mb == s.Mb, d.M1b == s.M1b, d.M2b == s.M2b)
+			}
+		},
+		reason: "types matching conditions are shallow copied or copied by a function",
+	}, {
+		src:     S{St: tar.Header{PAXRecords: map[string]string{"k": "v"}}},
+		cpyOpts: []cpy.Option{cpy.ShallowNamed("archive/tar.Header")},
+		verify: func(t *testing.T, dst, src interface{}) {
+			if m1, m2 := dst.(S).St.PAXRecords, src.(S).St.PAXRecords; reflect.ValueOf(m1).Pointer() != reflect.ValueOf(m2).Pointer() {
+				t.Errorf("S.St.PAXRecords are not shared, want shared")
+			}
+		},
+		reason: "type matching name is shallow copied",
+	}, {
+		src: S{St: tar.Header{PAXRecords: map[string]string{"k": "v"}}},
+		cpyOpts: []cpy.Option{
+			cpy.FuncNamed("archive/tar.Header", func(c *cpy.Copier, v reflect.Value) reflect.Value { return v }),
+		},
+		verify: func(t *testing.T, dst, src interface{}) {
+			if m1, m2 := dst.(S).St.PAXRecords, src.(S).St.PAXRecords; reflect.ValueOf(m1).Pointer() != reflect.ValueOf(m2).Pointer() {
+				t.Errorf("S.St.PAXRecords are not shared, want shared")
+			}
+		},
+		reason: "type matching name is copied by a function",
+	}, {
+		src:     S{St: tar.Header{PAXRecords: map[string]string{"k": "v"}}, PTi: &now},
+		cpyOpts: []cpy.Option{cpy.ShallowPackages("archive/...", "time")},
+		verify: func(t *testing.T, dst, src interface{}) {
+			d, s := dst.(S), src.(S)
+			if reflect.ValueOf(d.St.PAXRecords).Pointer() != reflect.ValueOf(s.St.PAXRecords).Pointer() {
+				t.Errorf("S.St.PAXRecords are not shared, want shared")
+			}
+			if d.PTi != s.PTi {
+				t.Errorf("S.PTi are inequal, want equal")
+			}
+		},
+		reason: "types and pointers to types in matching packages are shallow copied",
+	}, {
+		src:     S{Ti: now, PTi: &now},
+		cpyOpts: []cpy.Option{cpy.Immutable(time.Time{})},
+		verify: func(t *testing.T, dst, src interface{}) {
+			if p1, p2 := dst.(S).PTi, src.(S).PTi; p1 != p2 {
+				t.Errorf("S.PTi are inequal, want equal")
+			}
+		},
+		reason: "immutable time.Time and *time.Time values are shared",
+	}, {
+		src:     S{Ti: now, PTi: &now},
+		cpyOpts: []cpy.Option{cpy.Without(cpy.Immutable(time.Time{}), cpy.ForType(time.Time{})), cpy.Shallow(time.Time{})},
+		verify: func(t *testing.T, dst, src interface{}) {
+			if p1, p2 := dst.(S).PTi, src.(S).PTi; p1 == p2 {
+				t.Errorf("S.PTi are equal, want inequal")
+			}
+		},
+		reason: "immutable rule for time.Time is removed",
+	}, {
+		src:     S{St: tar.Header{PAXRecords: map[string]string{"k": "v"}}},
+		cpyOpts: []cpy.Option{cpy.Without(cpy.ShallowNamed("archive/tar.Header", "time.Time"), cpy.ForType(tar.Header{}))},
+		verify: func(t *testing.T, dst, src interface{}) {
+			if m1, m2 := dst.(S).St.PAXRecords, src.(S).St.PAXRecords; reflect.ValueOf(m1).Pointer() == reflect.ValueOf(m2).Pointer() {
+				t.Errorf("S.St.PAXRecords are equal, want inequal")
+			}
+		},
+		reason: "named shallow rule for tar.Header is removed",
+	}, {
+		src:     S{St: tar.Header{PAXRecords: map[string]string{"k": "v"}}},
+		cpyOpts: []cpy.Option{cpy.Without(cpy.ImmutableNamed("archive/tar.Header"), cpy.ForType(tar.Header{}))},
+		verify: func(t *testing.T, dst, src interface{}) {
+			if m1, m2 := dst.(S).St.PAXRecords, src.(S).St.PAXRecords; reflect.ValueOf(m1).Pointer() == reflect.ValueOf(m2).Pointer() {
+				t.Errorf("S.St.PAXRecords are equal, want inequal")
+			}
+		},
+		reason: "named immutable rule for tar.Header is removed",
+	}, {
+		src: S{Ti: now},
+		cpyOpts: []cpy.Option{
+			cpy.Without(cpy.Transformer(func(t time.Time) time.Time { return t.Add(time.Hour) }), cpy.ForType(time.Time{})),
+			cpy.Shallow(time.Time{}),
+		},
+		verify: func(t *testing.T, dst, src interface{}) {
+			if t1, t2 := dst.(S).Ti, src.(S).Ti; !t1.Equal(t2) {
+				t.Errorf("S.Ti = %v, want %v", t1, t2)
+			}
+		},
+		reason: "transformer for time.Time is removed",
+	}, {
+		src:       S{Ma: M{a: 1}},
+		cpyOpts:   []cpy.Option{cpy.Forbid(M{})},
+		wantPanic: true,
+		reason:    "copying a forbidden type panics",
+	}, {
+		src:     S{Ma: M{a: 1}},
+		cpyOpts: []cpy.Option{cpy.Forbid(M{}), cpy.Shallow(M{})},
+		reason:  "latter shallow option takes precedence over a forbidden type",
+	}, {
+		src:     S{Ti: now, PTi: &now},
+		cpyOpts: []cpy.Option{cpy.Options{nil, cpy.Options{cpy.Forbid(M{}), cpy.Shallow(time.Time{})}}},
+		reason:  "options within nested lists are applied",
+	}, {
+		src: S{Ma: M{a: 1}},
+		cpyOpts: []cpy.Option{
+			cpy.Override(cpy.Options{cpy.Shallow(M{})}),
+			cpy.Forbid(M{}),
+		},
+		reason: "override applies to every option within a list",
+	}, {
+		src:     S{Ma: M{a: 1}},
+		cpyOpts: []cpy.Option{cpy.Shallow(M{}), cpy.Priority(-1, cpy.Forbid(M{}))},
+		reason:  "latter option of lower priority is only used as a fallback",
+	}, {
+		src:       S{Ma: M{a: 1}},
+		cpyOpts:   []cpy.Option{cpy.Priority(2, cpy.Forbid(M{})), cpy.Override(cpy.Shallow(M{}))},
+		wantPanic: true,
+		reason:    "former option of higher priority takes precedence over an override",
+	}, {
+		src:       S{Ma: M{a: 1}},
+		cpyOpts:   []cpy.Option{cpy.Forbid(M{}), cpy.Without(cpy.Options{cpy.Shallow(M{})}, cpy.ForType(M{}))},
+		wantPanic: true,
+		reason:    "rules selected within a list are removed",
+	}, {
+		src: S{Ma: M{a: 1}, M1a: M1{a: 2}},
+		cpyOpts: []cpy.Option{
+			cpy.Shallow(M{}, M1{}),
+			cpy.If(func(t reflect.Type) bool { return t == reflect.TypeOf(M1{}) }, cpy.Forbid(M{}, M1{})),
+		},
+		wantPanic: true,
+		reason:    "conditional option applies to type matching the condition",
+	}, {
+		src: S{Ma: M{a: 1}},
+		cpyOpts: []cpy.Option{
+			cpy.Shallow(M{}),
+			cpy.If(func(t reflect.Type) bool { return t == reflect.TypeOf(M1{}) }, cpy.Forbid(M{})),
+		},
+		cmpOpts: []cmp.Option{cmp.AllowUnexported(M{})},
+		reason:  "conditional option does not apply to type not matching the condition",
+	}, {
+		src: struct{ P struct{ X, Y, z int } }{struct{ X, Y, z int }{1, 2, 3}},
+		cpyOpts: []cpy.Option{
+			cpy.Func(func(p struct{ X, Y, z int }) struct{ X, Y, z int } { return p }),
+		},
+		cmpOpts: []cmp.Option{cmp.Exporter(func(reflect.Type) bool { return true })},
+		reason:  "copy function on unnamed type applies to anonymous struct field",
+	}, {
+		src: struct{ P Point }{Point{1, 2, 3}},
+		cpyOpts: []cpy.Option{
+			cpy.Func(func(p struct{ X, Y, z int }) struct{ X, Y, z int } { panic("want not called") }),
+		},
+		cmpOpts: []cmp.Option{cmpopts.IgnoreUnexported(Point{})},
+		verify: func(t *testing.T, dst, src interface{}) {
+			if got := dst.(struct{ P Point }).P; got != (Point{1, 2, 0}) {
+				t.Errorf("P = %v, want %v", got, Point{1, 2, 0})
+			}
+		},
+		reason: "copy function on unnamed type does not apply to named type",
+	}, {
+		src: struct {
+			P  Point
+			PP *Point
+		}{Point{1, 2, 3}, &Point{4, 5, 6}},
+		cpyOpts: []cpy.Option{
+			cpy.Structural(cpy.Func(func(p struct{ X, Y, z int }) struct{ X, Y, z int } { return p })),
+		},
+		cmpOpts: []cmp.Option{cmp.AllowUnexported(Point{})},
+		reason:  "structural copy function applies to named type",
+	}, {
+		src: struct{ P Point }{Point{1, 2, 3}},
+		cpyOpts: []cpy.Option{
+			cpy.Structural(cpy.Func(func(p *struct{ X, Y, z int }) *struct{ X, Y, z int } { q := *p; return &q })),
+		},
+		cmpOpts: []cmp.Option{cmp.AllowUnexported(Point{})},
+		reason:  "structural copy function on pointer applies to named type",
+	}, {
+		src: struct{ P Point }{Point{1, 2, 3}},
+		cpyOpts: []cpy.Option{
+			cpy.Func(func(p Point) Point { return p }),
+			cpy.Structural(cpy.Shallow(struct{ X, Y, z int }{})),
+			cpy.Structural(cpy.Func(func(p *struct{ X, Y, z int }) *struct{ X, Y, z int } { panic("want not called") })),
+		},
+		cmpOpts: []cmp.Option{cmp.AllowUnexported(Point{})},
+		reason:  "exact copy function takes precedence over a latter structural copy function",
+	}, {
+		src: struct {
+			A PointAlias
+			D PointDefined
+		}{PointAlias{1, 2, 3}, PointDefined{4, 5, 6}},
+		cpyOpts: []cpy.Option{cpy.Func(func(p Point) Point { return p })},
+		cmpOpts: []cmp.Option{cmp.AllowUnexported(Point{}), cmpopts.IgnoreUnexported(PointDefined{})},
+		verify: func(t *testing.T, dst, src interface{}) {
+			v := dst.(struct {
+				A PointAlias
+				D PointDefined
+			})
+			if v.A.z != 3 || v.D.z != 0 {
+				t.Errorf("(A.z, D.z) = (%v, %v), want (3, 0)", v.A.z, v.D.z)
+			}
+		},
+		reason: "copy function applies to type alias, but not to defined type",
+	}, {
+		src: struct {
+			A PointAlias
+			D PointDefined
+		}{PointAlias{1, 2, 3}, PointDefined{4, 5, 6}},
+		cpyOpts: []cpy.Option{cpy.Structural(cpy.Func(func(p Point) Point { return p }))},
+		cmpOpts: []cmp.Option{cmp.AllowUnexported(Point{}, PointDefined{})},
+		reason:  "structural copy function applies to defined type",
 	}, {
 		src: S{
 			B:    true,
@@ -155,6 +463,29 @@ func Test(t *testing.T) {
 			}
 		},
 		reason: "slices are deeply copied",
+	}, {
+		src: append(make([][2]float64, 0, 10), [2]float64{1, 2}, [2]float64{3, 4}),
+		verify: func(t *testing.T, dst, src interface{}) {
+			s1, s2 := dst.([][2]float64), src.([][2]float64)
+			if &s1[0] == &s2[0] {
+				t.Errorf("&s[0] are equal, want inequal")
+			}
+			if cap(s1) != cap(s2) {
+				t.Errorf("cap(s) = %d, want %d", cap(s1), cap(s2))
+			}
+		},
+		reason: "slices of pointer-free elements are copied in bulk",
+	}, {
+		src: S{Sl: []M1{}, Ma1: map[string]M1{}},
+		verify: func(t *testing.T, dst, src interface{}) {
+			if s := dst.(S).Sl; s == nil {
+				t.Errorf("S.Sl = nil, want non-nil")
+			}
+			if m1, m2 := dst.(S).Ma1, src.(S).Ma1; m1 == nil || reflect.ValueOf(m1).Pointer() == reflect.ValueOf(m2).Pointer() {
+				t.Errorf("S.Ma1 are equal or nil, want inequal and non-nil")
+			}
+		},
+		reason: "empty slices are shared, but empty maps are not",
 	}, {
 		src:     S{Ma1: map[string]M1{"one": {A: 1}, "two": {A: 2}}},
 		cpyOpts: []cpy.Option{cpy.IgnoreAllUnexported()},
@@ -276,6 +607,18 @@ func Test(t *testing.T) {
 			}),
 		},
 		reason: "copy function on Proto not called given copy functions on ProtoM1 and ProtoM2",
+	}, {
+		src: map[string]interface{}{
+			"protos": []Proto{&M{a: 1}, &M{a: 2}, M1{a: 3}, nil, &M2{a: 4}, &M{a: 5}},
+			"values": []interface{}{&M{a: 1}, 2, &M{a: 3}, "4", nil, M1{a: 5}, &M{a: 6}},
+			"mapped": map[int]interface{}{1: &M{a: 1}, 2: &M{a: 2}, 3: M1{a: 3}, 4: nil},
+		},
+		cpyOpts: []cpy.Option{
+			cpy.Func(func(m *M) *M { return &M{A: m.A, a: m.a} }),
+			cpy.Func(func(m M1) M1 { return M1{A: m.A, a: m.a} }),
+			cpy.Func(func(m *M2) *M2 { return &M2{A: m.A, a: m.a} }),
+		},
+		reason: "elements of interface collections with varying dynamic types are each copied according to their own type",
 	}, {
 		src: S{
 			Ma: M{a: 1},
@@ -285,26 +628,1008 @@ func Test(t *testing.T) {
 			cpy.Func(func(m Proto) Proto { panic("want not called") }),
 		},
 		reason: "copy function on concrete type takes precedence over interface type",
+	}, {
+		src: S{Ti: now, PTi: &now},
+		cpyOpts: []cpy.Option{
+			cpy.Func(func(t time.Time) time.Time { panic("want not called") }),
+			cpy.Shallow(time.Time{}),
+		},
+		reason: "latter shallow option takes precedence over a former copy function",
+	}, {
+		src: S{Ma: M{a: 1}},
+		cpyOpts: []cpy.Option{
+			cpy.Override(cpy.Func(func(m M) M { return M{A: m.A, a: m.a} })),
+			cpy.Func(func(m M) M { panic("want not called") }),
+		},
+		reason: "overriding copy function takes precedence over a latter copy function",
+	}, {
+		src: S{Ma: M{a: 1}},
+		cpyOpts: []cpy.Option{
+			cpy.Func(func(m M) M { panic("want not called") }),
+			cpy.Override(cpy.Func(func(m Proto) Proto { return &M{A: m.(*M).A, a: m.(*M).a} })),
+		},
+		reason: "overriding interface copy function takes precedence over a concrete copy function",
+	}, {
+		src: S{Ma: M{a: 1}, Mb: &M{a: 2}},
+		cpyOpts: []cpy.Option{
+			cpy.Func(func(m *M) *M { return &M{A: m.A, a: m.a} }),
+			cpy.Without(cpy.Func(func(m M) M { panic("want not called") }), cpy.ForType(M{})),
+		},
+		reason: "copy function on M is removed, leaving the copy function on *M",
+	}, {
+		src: S{Ma: M{a: 1}},
+		cpyOpts: []cpy.Option{
+			cpy.Func(func(m M) M { return M{A: m.A, a: m.a} }),
+			cpy.Without(cpy.Override(cpy.Func(func(m Proto) Proto { panic("want not called") })), cpy.ForType((*Proto)(nil))),
+		},
+		reason: "overriding interface copy function is removed",
+	}}
+	for _, tt := range tests {
+		for _, unsafe := range []bool{false, true} {
+			t.Run("", func(t *testing.T) {
+				defer func() {
+					gotPanic := recover() != nil
+					if gotPanic != tt.wantPanic {
+						t.Errorf("got panic=%v, want panic=%v", gotPanic, tt.wantPanic)
+					}
+				}()
+
+				cpyOpts := append(tt.cpyOpts[:len(tt.cpyOpts):len(tt.cpyOpts)], cpy.IgnoreAllUnexported())
+				if unsafe {
+					cpyOpts = append(cpyOpts, cpy.UnsafeFieldAccess())
+				}
+				copier := cpy.New(cpyOpts...)
+				dst := copier.Copy(tt.src)
+				cmpOpts := append(tt.cmpOpts[:len(tt.cmpOpts):len(tt.cmpOpts)], cmp.AllowUnexported(S{}, M{}, M1{}, M2{}))
+				if diff := cmp.Diff(dst, tt.src, cmpOpts...); diff != "" {
+					t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+				}
+				if tt.verify != nil {
+					tt.verify(t, dst, tt.src)
+				}
+			})
+		}
+	}
+}
+
+func TestNormalizeNumbers(t *testing.T) {
+	src := map[string]interface{}{
+		"int8":     int8(-8),
+		"uint16":   uint16(16),
+		"uint64":   uint64(math.MaxUint64),
+		"float32":  float32(32),
+		"float64":  64.5,
+		"nan":      math.NaN(),
+		"number1":  json.Number("100"),
+		"number2":  json.Number("1e3"),
+		"number3":  json.Number("1.5"),
+		"number4":  json.Number("invalid"),
+		"duration": time.Second,
+		"slice":    []interface{}{int32(1), 2.0},
+		"stringer": []fmt.Stringer{json.Number("5")},
+	}
+	want := map[string]interface{}{
+		"int8":     int64(-8),
+		"uint16":   int64(16),
+		"uint64":   uint64(math.MaxUint64),
+		"float32":  int64(32),
+		"float64":  64.5,
+		"nan":      math.NaN(),
+		"number1":  int64(100),
+		"number2":  int64(1000),
+		"number3":  1.5,
+		"number4":  json.Number("invalid"),
+		"duration": time.Second,
+		"slice":    []interface{}{int64(1), int64(2)},
+		"stringer": []fmt.Stringer{json.Number("5")},
+	}
+	copier := cpy.New(cpy.NormalizeNumbers(), cpy.IgnoreAllUnexported())
+	got := copier.Copy(src)
+	if diff := cmp.Diff(want, got, cmpopts.EquateNaNs()); diff != "" {
+		t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+type LegacyID string
+
+func (LegacyID) Legacy() {}
+
+type ID string
+
+type IDHolder struct {
+	ID  LegacyID
+	Any interface{}
+}
+
+func TestSubstitute(t *testing.T) {
+	src := map[string]interface{}{
+		"id":     LegacyID("a"),
+		"slice":  []interface{}{LegacyID("b"), 3},
+		"struct": IDHolder{ID: "c", Any: LegacyID("d")},
+		"legacy": []interface{ Legacy() }{LegacyID("e")},
+	}
+	want := map[string]interface{}{
+		"id":     ID("a"),
+		"slice":  []interface{}{ID("b"), 3},
+		"struct": IDHolder{ID: "c", Any: ID("d")},
+		"legacy": []interface{ Legacy() }{LegacyID("e")},
+	}
+	copier := cpy.New(cpy.Substitute(map[reflect.Type]reflect.Type{
+		reflect.TypeOf(LegacyID("")): reflect.TypeOf(ID("")),
+	}), cpy.IgnoreAllUnexported())
+	got := copier.Copy(src)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+type Store interface{ Get(string) string }
+
+type MemStore struct{ M map[string]string }
+
+func (s *MemStore) Get(k string) string { return s.M[k] }
+
+type CountingStore struct {
+	Store
+	N int
+}
+
+func (s *CountingStore) Get(k string) string { s.N++; return s.Store.Get(k) }
+
+func TestRebind(t *testing.T) {
+	src := struct {
+		Store Store
+		Any   interface{}
+	}{
+		Store: &MemStore{M: map[string]string{"k": "v"}},
+		Any:   &MemStore{M: map[string]string{"k": "v"}},
+	}
+	copier := cpy.New(cpy.Rebind(func(s *MemStore) Store {
+		return &CountingStore{Store: s}
+	}), cpy.IgnoreAllUnexported())
+	got := copier.Copy(src).(struct {
+		Store Store
+		Any   interface{}
+	})
+	cs, ok := got.Store.(*CountingStore)
+	if !ok {
+		t.Fatalf("Store = %T, want *CountingStore", got.Store)
+	}
+	if cs.Get("k"); cs.N != 1 || cs.Store == src.Store {
+		t.Errorf("CountingStore = %+v, want wrapper around copy of source", cs)
+	}
+	if _, ok := got.Any.(*MemStore); !ok {
+		t.Errorf("Any = %T, want *MemStore", got.Any)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var order []string
+	logger := func(name string) func(cpy.CopyFn) cpy.CopyFn {
+		return func(next cpy.CopyFn) cpy.CopyFn {
+			return func(src reflect.Value) reflect.Value {
+				order = append(order, name+" "+src.Type().String())
+				return next(src)
+			}
+		}
+	}
+	redact := cpy.Middleware(func(next cpy.CopyFn) cpy.CopyFn {
+		return func(src reflect.Value) reflect.Value {
+			if src.Kind() == reflect.String && src.String() == "secret" {
+				return reflect.ValueOf("REDACTED").Convert(src.Type())
+			}
+			return next(src)
+		}
+	})
+	copier := cpy.New(cpy.Middleware(logger("a")), cpy.Middleware(logger("b")), redact, cpy.IgnoreAllUnexported())
+	src := map[string]interface{}{"k": []string{"secret"}}
+	got := copier.Copy(src)
+	want := map[string]interface{}{"k": []string{"REDACTED"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+	}
+	wantOrder := []string{
+		"a map[string]interface {}", "b map[string]interface {}",
+		"a string", "b string",
+		"a interface {}", "b interface {}",
+		"a []string", "b []string",
+		"a string", "b string",
+	}
+	if diff := cmp.Diff(wantOrder, order); diff != "" {
+		t.Errorf("middleware order mismatch (-want +got):\n%s", diff)
+	}
+
+	// Fields are visited even if they would otherwise be block copied.
+	type W struct {
+		A, B int
+		P    *int
+	}
+	for _, unsafe := range []bool{false, true} {
+		opts := []cpy.Option{cpy.Middleware(logger("m")), cpy.IgnoreAllUnexported()}
+		if unsafe {
+			opts = append(opts, cpy.UnsafeFieldAccess())
+		}
+		one := 1
+		wantOrder := []string{"m cpy_test.W", "m int", "m int", "m *int", "m int"}
+		order = nil
+		cpy.New(opts...).Copy(W{A: 1, B: 2, P: &one})
+		if diff := cmp.Diff(wantOrder, order); diff != "" {
+			t.Errorf("middleware order with unsafe=%v mismatch (-want +got):\n%s", unsafe, diff)
+		}
+
+		// Derived copiers do not inherit struct layouts without middleware.
+		base := cpy.New(opts[1:]...)
+		base.Copy(W{A: 1, B: 2, P: &one})
+		order = nil
+		base.With(opts[0]).Copy(W{A: 1, B: 2, P: &one})
+		if diff := cmp.Diff(wantOrder, order); diff != "" {
+			t.Errorf("middleware order of With() with unsafe=%v mismatch (-want +got):\n%s", unsafe, diff)
+		}
+	}
+}
+
+func TestCopyInto(t *testing.T) {
+	copier := cpy.New(cpy.IgnoreAllUnexported())
+	src := &S{S: "hello", Pt: &S{S: "world"}}
+
+	dst := S{S: "stale", I: 5}
+	if err := copier.CopyInto(&dst, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if diff := cmp.Diff(*src, dst, cmp.AllowUnexported(S{}, M{}, M1{}, M2{})); diff != "" {
+		t.Errorf("CopyInto() mismatch (-want +got):\n%s", diff)
+	}
+	if dst.Pt == src.Pt {
+		t.Errorf("CopyInto() shares memory with the source")
+	}
+
+	// The source may alias the destination.
+	if err := copier.CopyInto(src, src); err != nil || src.Pt.S != "world" {
+		t.Errorf("CopyInto(src, src) = %v, want copy of itself", err)
+	}
+	if err := copier.CopyInto(&dst, (*S)(nil)); err != nil || dst.S != "" {
+		t.Errorf("CopyInto(nil) = %v, want zero value", err)
+	}
+
+	for _, tt := range []struct {
+		dst, src interface{}
+		wantErr  string
+	}{
+		{dst: dst, src: src, wantErr: "cpy.CopyInto: destination must be a non-nil pointer, got cpy_test.S"},
+		{dst: (*S)(nil), src: src, wantErr: "cpy.CopyInto: destination must be a non-nil pointer, got *cpy_test.S"},
+		{dst: &dst, src: nil, wantErr: "cpy.CopyInto: cannot copy untyped nil into *cpy_test.S"},
+		{dst: &dst, src: M{}, wantErr: "cpy.CopyInto: cannot copy cpy_test.M into *cpy_test.S"},
+	} {
+		if err := copier.CopyInto(tt.dst, tt.src); err == nil || err.Error() != tt.wantErr {
+			t.Errorf("CopyInto(%T, %T) error = %v, want %v", tt.dst, tt.src, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCopyE(t *testing.T) {
+	copier := cpy.New(cpy.Forbid(M{}), cpy.IgnoreAllUnexported())
+	if got, err := copier.CopyE(S{S: "hello"}); err != nil || got.(S).S != "hello" {
+		t.Errorf("CopyE() = (%v, %v), want copy", got, err)
+	}
+	got, err := copier.CopyE(S{Ma: M{A: 1}})
+	if err == nil || !strings.HasPrefix(err.Error(), "cpy: copying of cpy_test.M is forbidden by cpy.Forbid(cpy_test.M) at ") || got != nil {
+		t.Errorf("CopyE() = (%v, %v), want forbidden error", got, err)
+	}
+
+	copier = cpy.New(cpy.Middleware(func(next cpy.CopyFn) cpy.CopyFn {
+		return func(reflect.Value) reflect.Value { return reflect.ValueOf(0) }
+	}), cpy.IgnoreAllUnexported())
+	if _, err := copier.CopyE("hello"); err == nil || err.Error() != "cpy.Middleware: copy of string has mismatching type: 0" {
+		t.Errorf("CopyE() error = %v, want mismatching type error", err)
+	}
+
+	errBad := errors.New("bad value")
+	copier = cpy.New(cpy.Func(func(m *M) (*M, error) {
+		if m.A < 0 {
+			return nil, errBad
+		}
+		return &M{A: m.A}, nil
+	}), cpy.IgnoreAllUnexported())
+	if got, err := copier.CopyE(&M{A: 1}); err != nil || got.(*M).A != 1 {
+		t.Errorf("CopyE() = (%v, %v), want copy", got, err)
+	}
+	if _, err := copier.CopyE(&M{A: -1}); !errors.Is(err, errBad) || !strings.HasPrefix(err.Error(), "cpy: cpy.Func(func(*cpy_test.M) (*cpy_test.M, error)) at ") {
+		t.Errorf("CopyE() error = %v, want wrapped %v", err, errBad)
+	}
+
+	// Panics from user functions are not converted to errors.
+	copier = cpy.New(cpy.Func(func(*M) *M { panic("user panic") }), cpy.IgnoreAllUnexported())
+	func() {
+		defer func() {
+			if r := recover(); r != "user panic" {
+				t.Errorf("recover() = %v, want user panic", r)
+			}
+		}()
+		copier.CopyE(&M{A: 1})
+	}()
+}
+
+func TestCopyContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var n int
+	copier := cpy.New(cpy.Func(func(m *M) *M {
+		if n++; n == 10 {
+			cancel()
+		}
+		return &M{A: m.A}
+	}), cpy.IgnoreAllUnexported())
+	src := make([]*M, 10000)
+	for i := range src {
+		src[i] = &M{A: i}
+	}
+
+	if got, err := copier.CopyContext(context.Background(), src[:10]); err != nil || len(got.([]*M)) != 10 {
+		t.Errorf("CopyContext() = (%v, %v), want copy", got, err)
+	}
+	n = 0
+	if got, err := copier.CopyContext(ctx, src); !errors.Is(err, context.Canceled) || got != nil {
+		t.Errorf("CopyContext() = (%v, %v), want context.Canceled error", got, err)
+	}
+	if n >= len(src) {
+		t.Errorf("CopyContext() copied all %d elements, want abort", n)
+	}
+	if _, err := copier.CopyContext(ctx, src[:1]); !errors.Is(err, context.Canceled) {
+		t.Errorf("CopyContext() error = %v, want context.Canceled error", err)
+	}
+}
+
+func TestWith(t *testing.T) {
+	base := cpy.New(cpy.Shallow(time.Time{}), cpy.IgnoreAllUnexported())
+	src := S{Ti: now, Pt: &S{S: "hello"}, Ma: M{A: 1, a: 2}}
+	base.Copy(src) // warm up the caches
+
+	derived := base.With(cpy.Func(func(m M) M { return M{A: m.A, a: m.a} }))
+	if got := derived.Copy(src).(S); !got.Ti.Equal(now) || got.Ma.a != 2 {
+		t.Errorf("derived Copy() = %+v, want both options applied", got)
+	}
+	if got := base.Copy(src).(S); got.Ma.a != 0 {
+		t.Errorf("base Copy().Ma.a = %v, want 0", got.Ma.a)
+	}
+
+	var nodes int
+	traced := base.With(cpy.Trace(func(string, reflect.Type) func(cpy.Stats) {
+		return func(s cpy.Stats) { nodes = s.Nodes }
+	}))
+	if got := traced.Copy(src).(S); !got.Ti.Equal(now) || got.Pt == src.Pt || nodes == 0 {
+		t.Errorf("traced Copy() = %+v with %d nodes, want deep copy with nodes traced", got, nodes)
+	}
+}
+
+func TestSharedPlans(t *testing.T) {
+	type Leaf struct{ V int }
+	type Tree struct {
+		T    time.Time
+		Leaf *Leaf
+		Kids []*Tree
+	}
+	newCopier := func(opts ...cpy.Option) *cpy.Copier {
+		return cpy.New(append(opts, cpy.Shallow(time.Time{}), cpy.IgnoreAllUnexported())...)
+	}
+	src := &Tree{T: now, Leaf: &Leaf{1}, Kids: []*Tree{{Leaf: &Leaf{2}}}}
+	warm := newCopier()
+	warm.Copy(src)
+
+	// Copiers with equivalent options do not resolve every type anew.
+	construct := testing.AllocsPerRun(100, func() { newCopier() })
+	copies := testing.AllocsPerRun(100, func() { warm.Copy(src) })
+	if got := testing.AllocsPerRun(100, func() { newCopier().Copy(src) }); got > construct+copies {
+		t.Errorf("New().Copy() allocations = %v, want %v", got, construct+copies)
+	}
+
+	// Copiers with other options resolve types according to their options.
+	if got := newCopier(cpy.Shallow(&Leaf{})).Copy(src).(*Tree); got.Leaf != src.Leaf || got == src {
+		t.Errorf("Copy() with Shallow(*Leaf) = %+v, want shared Leaf", got)
+	}
+	if got := newCopier(cpy.Func(func(l *Leaf) *Leaf { return nil })).Copy(src).(*Tree); got.Leaf != nil {
+		t.Errorf("Copy() with Func(*Leaf) = %+v, want nil Leaf", got)
+	}
+	if got := newCopier().Copy(src).(*Tree); got.Leaf == src.Leaf || got.Kids[0].Leaf.V != 2 {
+		t.Errorf("Copy() = %+v, want deep copy", got)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	team1 := cpy.New(cpy.Func(func(m M) M { return M{A: 1} }), cpy.Shallow(time.Time{}), cpy.IgnoreAllUnexported())
+	team2 := cpy.New(cpy.Func(func(m M) M { return M{A: 2} }), cpy.IgnoreAllUnexported())
+	joined := cpy.Join(team1, team2)
+	got := joined.Copy(S{Ma: M{A: 3}, Ti: now}).(S)
+	if got.Ma.A != 2 || !got.Ti.Equal(now) {
+		t.Errorf("Copy() = %+v, want Func of team2 and Shallow of team1 applied", got)
+	}
+	if errs := joined.Conflicts(); len(errs) != 1 {
+		t.Errorf("Conflicts() = %v, want one conflict", errs)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	copier := cpy.New(
+		cpy.Func(func(m *M) *M { return m }), // shadowed by Shallow below
+		cpy.Func(func(m Proto) Proto { return m }),
+		cpy.Shallow(&M{}, time.Time{}),
+		cpy.Override(cpy.Func(func(t time.Time) time.Time { return t })),
+		cpy.IgnoreAllUnexported(),
+	)
+	var got []string
+	for _, err := range copier.Conflicts() {
+		// Elide the directory and line number of each source location.
+		got = append(got, regexp.MustCompile(`\S*/(\S+):\d+`).ReplaceAllString(err.Error(), "$1:LINE"))
+	}
+	want := []string{
+		"cpy.Shallow(time.Time) at copy_test.go:LINE is shadowed by cpy.Func(func(time.Time) time.Time) at copy_test.go:LINE",
+		"cpy.Func(func(*cpy_test.M) *cpy_test.M) at copy_test.go:LINE is shadowed by cpy.Shallow(*cpy_test.M) at copy_test.go:LINE",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Conflicts() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	copier := cpy.New(
+		cpy.Func(func(m Proto) Proto { return m }),
+		cpy.Shallow(&M{}),
+		cpy.Override(cpy.Func(func(t time.Time) time.Time { return t })),
+		cpy.Immutable(S{}),
+		cpy.IgnoreAllUnexported(),
+		cpy.NormalizeNumbers(),
+	)
+	// Elide the directory and line number of each source location.
+	got := regexp.MustCompile(`\S*/(\S+):\d+`).ReplaceAllString(copier.Describe(), "$1:LINE")
+	want := `Funcs (in order of precedence):
+	cpy.Func(func(time.Time) time.Time) at copy_test.go:LINE (priority 1)
+	cpy.Shallow(*cpy_test.M) at copy_test.go:LINE
+	cpy.Func(func(cpy_test.Proto) cpy_test.Proto) at copy_test.go:LINE
+Immutable types: cpy_test.S
+Unexported fields: ignored
+Enabled: NormalizeNumbers
+`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Describe() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRegisteredTypes(t *testing.T) {
+	copier := cpy.New(
+		cpy.Func(func(m Proto) Proto { return m }),
+		cpy.Shallow(&M{}),
+		cpy.Shallow(M1{}),
+		cpy.Override(cpy.Func(func(t time.Time) time.Time { return t })),
+		cpy.Forbid(M1{}),
+		cpy.IgnoreAllUnexported(),
+	)
+	typeString := cmp.Transformer("String", func(t reflect.Type) string { return t.String() })
+	wantTypes := []reflect.Type{reflect.TypeOf(time.Time{}), reflect.TypeOf(M1{}), reflect.TypeOf(&M{})}
+	if diff := cmp.Diff(wantTypes, copier.RegisteredTypes(), typeString); diff != "" {
+		t.Errorf("RegisteredTypes() mismatch (-want +got):\n%s", diff)
+	}
+	wantIfaces := []reflect.Type{reflect.TypeOf((*Proto)(nil)).Elem()}
+	if diff := cmp.Diff(wantIfaces, copier.RegisteredInterfaces(), typeString); diff != "" {
+		t.Errorf("RegisteredInterfaces() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewStrict(t *testing.T) {
+	if _, err := cpy.NewStrict(cpy.Shallow(time.Time{}), cpy.IgnoreAllUnexported()); err != nil {
+		t.Errorf("NewStrict() error: %v", err)
+	}
+	_, err := cpy.NewStrict(cpy.Shallow(M{}), cpy.Func(func(m M) M { return m }))
+	want := regexp.MustCompile(`^cpy.NewStrict: 2 problems:
+	cpy.IgnoreAllUnexported must be specified; this requirement may change in the future
+	cpy.Shallow\(cpy_test.M\) at .*copy_test.go:\d+ is shadowed by cpy.Func\(func\(cpy_test.M\) cpy_test.M\) at .*copy_test.go:\d+$`)
+	if err == nil || !want.MatchString(err.Error()) {
+		t.Errorf("NewStrict() error = %v, want match for %v", err, want)
+	}
+}
+
+func TestAllocs(t *testing.T) {
+	type Pair struct{ X, Y int }
+	type Wide struct {
+		A, B, C, D Pair
+		P          *Pair
+		L          []Pair
+		S          []*Pair
+	}
+	src := &Wide{
+		A: Pair{1, 2}, B: Pair{3, 4}, C: Pair{5, 6}, D: Pair{7, 8},
+		P: &Pair{9, 10},
+		L: []Pair{{1, 2}, {3, 4}, {5, 6}},
+		S: []*Pair{{1, 2}},
+	}
+	copier := cpy.New(cpy.IgnoreAllUnexported())
+	got := testing.AllocsPerRun(100, func() { copier.Copy(src) })
+	// Allocations are expected for the top-level *Wide,
+	// the Wide and two Pair values pointed at, and two slices
+	// (each needing a slice header and a backing array).
+	// Allocations are not expected for each individual field.
+	const want = 8
+	if got > want {
+		t.Errorf("Copy() allocations = %v, want %v", got, want)
+	}
+}
+
+func TestUnsafeFieldAccess(t *testing.T) {
+	src := &S{
+		B: true, I: -1, I8: -8, U16: +16, F64: 64.64, C128: 128i + 128, S: "hello",
+		Pt:  &S{S: "world", Ar: [32]*M1{5: {A: 5}}},
+		Sl:  []M1{{A: 1, a: 1}},
+		Ma:  M{A: 2, a: 2},
+		M1b: &M1{A: 3, a: 3},
+		Ti:  now,
+	}
+	want := cpy.New(cpy.IgnoreAllUnexported()).Copy(src)
+	got := cpy.New(cpy.IgnoreAllUnexported(), cpy.UnsafeFieldAccess()).Copy(src)
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(S{}, M{}, M1{}, M2{})); diff != "" {
+		t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+	}
+	if got.(*S).Pt == src.Pt || got.(*S).Pt.Ar[5] == src.Pt.Ar[5] {
+		t.Errorf("Copy() shares memory with the source")
+	}
+}
+
+func TestNonAddressable(t *testing.T) {
+	// Neither map values nor the dynamic values of interfaces are addressable,
+	// so copying them must stage them in newly allocated storage.
+	src := map[string]interface{}{
+		"map":   map[string]S{"a": {Ma: M{A: 1, a: 1}, Pt: &S{S: "a"}}},
+		"iface": []interface{}{M{A: 2, a: 2}, S{Ma: M{A: 3}, Pt: &S{S: "b"}}, [2]M{{A: 4}, {A: 5}}},
+	}
+	var calls int
+	copyM := cpy.Func(func(m *M) *M {
+		calls++
+		return &M{A: m.A, a: m.a}
+	})
+	for _, unsafe := range []bool{false, true} {
+		opts := []cpy.Option{copyM, cpy.IgnoreAllUnexported()}
+		if unsafe {
+			opts = append(opts, cpy.UnsafeFieldAccess())
+		}
+		calls = 0
+		got := cpy.New(opts...).Copy(src)
+		if diff := cmp.Diff(src, got, cmp.AllowUnexported(S{}, M{}, M1{}, M2{})); diff != "" {
+			t.Errorf("Copy(unsafe=%v) mismatch (-want +got):\n%s", unsafe, diff)
+		}
+		if calls != 5 {
+			t.Errorf("Copy(unsafe=%v) called copy function %d times, want 5", unsafe, calls)
+		}
+		if got.(map[string]interface{})["map"].(map[string]S)["a"].Pt == src["map"].(map[string]S)["a"].Pt {
+			t.Errorf("Copy(unsafe=%v) shares memory with the source", unsafe)
+		}
+	}
+}
+
+type embedded struct {
+	a int
+	p *int
+	S []string
+}
+
+type Embeds struct {
+	embedded
+	M
+	B bool
+}
+
+func TestAllowUnexportedPackages(t *testing.T) {
+	n := 5
+	src := &Embeds{embedded: embedded{a: 1, p: &n, S: []string{"a"}}, M: M{A: 2, a: 3}, B: true}
+	allowAll := cmp.Exporter(func(reflect.Type) bool { return true })
+	tests := []struct {
+		patterns []string
+		want     *Embeds
+	}{{
+		patterns: []string{"github.com/google/go-cpy/cpy_test"},
+		want:     src,
+	}, {
+		patterns: []string{"example.com/other", "github.com/google/go-cpy/..."},
+		want:     src,
+	}, {
+		patterns: []string{"github.com/google/go-cpy"},
+		want:     &Embeds{M: M{A: 2}, B: true},
+	}, {
+		patterns: []string{"github.com/google/go-cp/..."},
+		want:     &Embeds{M: M{A: 2}, B: true},
 	}}
 	for _, tt := range tests {
-		t.Run("", func(t *testing.T) {
-			defer func() {
-				gotPanic := recover() != nil
-				if gotPanic != tt.wantPanic {
-					t.Errorf("got panic=%v, want panic=%v", gotPanic, tt.wantPanic)
+		for _, unsafe := range []bool{false, true} {
+			opts := []cpy.Option{cpy.AllowUnexportedPackages(tt.patterns...), cpy.IgnoreAllUnexported()}
+			if unsafe {
+				opts = append(opts, cpy.UnsafeFieldAccess())
+			}
+			got := cpy.New(opts...).Copy(src).(*Embeds)
+			if diff := cmp.Diff(tt.want, got, allowAll); diff != "" {
+				t.Errorf("Copy(%q, unsafe=%v) mismatch (-want +got):\n%s", tt.patterns, unsafe, diff)
+			}
+			if got.p != nil && got.p == src.p {
+				t.Errorf("Copy(%q, unsafe=%v) shares memory with the source", tt.patterns, unsafe)
+			}
+		}
+	}
+}
+
+func TestCopyUnexported(t *testing.T) {
+	n := 5
+	src := &Embeds{embedded: embedded{a: 1, p: &n, S: []string{"a"}}, M: M{A: 2, a: 3}, B: true}
+	allowAll := cmp.Exporter(func(reflect.Type) bool { return true })
+	for _, unsafe := range []bool{false, true} {
+		opts := []cpy.Option{cpy.CopyUnexported(Embeds{}, embedded{}), cpy.IgnoreAllUnexported()}
+		if unsafe {
+			opts = append(opts, cpy.UnsafeFieldAccess())
+		}
+		got := cpy.New(opts...).Copy(src).(*Embeds)
+		want := &Embeds{embedded: embedded{a: 1, p: &n, S: []string{"a"}}, M: M{A: 2}, B: true}
+		if diff := cmp.Diff(want, got, allowAll); diff != "" {
+			t.Errorf("Copy(unsafe=%v) mismatch (-want +got):\n%s", unsafe, diff)
+		}
+		if got.p == src.p {
+			t.Errorf("Copy(unsafe=%v) shares memory with the source", unsafe)
+		}
+	}
+}
+
+func TestIgnoreUnexported(t *testing.T) {
+	for _, unsafe := range []bool{false, true} {
+		opts := []cpy.Option{cpy.IgnoreUnexported(M{})}
+		if unsafe {
+			opts = append(opts, cpy.UnsafeFieldAccess())
+		}
+		copier := cpy.New(opts...)
+		if got := copier.Copy(&M{A: 1, a: 2}).(*M); *got != (M{A: 1}) {
+			t.Errorf("Copy(unsafe=%v) = %v, want %v", unsafe, *got, M{A: 1})
+		}
+		if _, err := copier.CopyE(&M1{A: 1, a: 2}); err == nil || !strings.Contains(err.Error(), "unable to copy unexported field") {
+			t.Errorf("CopyE(unsafe=%v) error = %v, want unexported field error", unsafe, err)
+		}
+	}
+}
+
+func TestZeroTypes(t *testing.T) {
+	type Service struct {
+		Name  string
+		Mu    sync.Mutex
+		Cache map[string][]byte
+		Peers []*Service
+	}
+	src := &Service{Name: "a", Cache: map[string][]byte{"k": nil}, Peers: []*Service{{Name: "b", Cache: map[string][]byte{}}}}
+	src.Mu.Lock()
+	defer src.Mu.Unlock()
+
+	copier := cpy.New(cpy.ZeroTypes(sync.Mutex{}, map[string][]byte{}), cpy.IgnoreAllUnexported())
+	got := copier.Copy(src).(*Service)
+	if !got.Mu.TryLock() {
+		t.Errorf("Copy() copied locked mutex, want zero mutex")
+	}
+	if got.Name != "a" || got.Cache != nil || len(got.Peers) != 1 || got.Peers[0] == src.Peers[0] || got.Peers[0].Name != "b" || got.Peers[0].Cache != nil {
+		t.Errorf("Copy() = %+v, want copy without caches", got)
+	}
+	if h := copier.HandlerFor(reflect.TypeOf(sync.Mutex{})); h.Strategy != cpy.Ignore {
+		t.Errorf("HandlerFor(sync.Mutex).Strategy = %v, want %v", h.Strategy, cpy.Ignore)
+	}
+}
+
+func TestTransformer(t *testing.T) {
+	type (
+		Counter int
+		Stats   struct {
+			Name   string
+			Hits   Counter
+			Recent []time.Time
+		}
+	)
+	now := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	src := map[string]*Stats{"a": {Name: "a", Hits: 3, Recent: []time.Time{now}}, "b": {Name: "b"}}
+
+	for _, unsafe := range []bool{false, true} {
+		opts := []cpy.Option{
+			cpy.Shallow(time.Time{}),
+			cpy.Transformer(func(t time.Time) time.Time { return t.Truncate(time.Second) }),
+			cpy.Transformer(func(Counter) Counter { return -1 }),
+			cpy.Transformer(func(Counter) Counter { return 0 }), // takes precedence
+			cpy.IgnoreAllUnexported(),
+		}
+		if unsafe {
+			opts = append(opts, cpy.UnsafeFieldAccess())
+		}
+		got := cpy.New(opts...).Copy(src).(map[string]*Stats)
+		want := map[string]*Stats{"a": {Name: "a", Recent: []time.Time{now.Truncate(time.Second)}}, "b": {Name: "b"}}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Copy(unsafe=%v) mismatch (-want +got):\n%s", unsafe, diff)
+		}
+		if !src["a"].Recent[0].Equal(now) || src["a"].Hits != 3 {
+			t.Errorf("Copy(unsafe=%v) mutated source: %+v", unsafe, src["a"])
+		}
+	}
+}
+
+type Seq[V any] func(yield func(V) bool)
+type Seq2[K, V any] func(yield func(K, V) bool)
+
+type Stream struct {
+	Items Seq[*M]
+	Pairs Seq2[string, []int]
+}
+
+func TestIterators(t *testing.T) {
+	items := []*M{{A: 1}, {A: 2}, {A: 3}}
+	pairs := map[string][]int{"a": {1}, "b": {2, 3}}
+	src := Stream{
+		Items: func(yield func(*M) bool) {
+			for _, m := range items {
+				if !yield(m) {
+					return
+				}
+			}
+		},
+		Pairs: func(yield func(string, []int) bool) {
+			for _, k := range []string{"a", "b"} {
+				if !yield(k, pairs[k]) {
+					return
 				}
-			}()
+			}
+		},
+	}
+	collect := func(s Stream) (ms []*M, ps map[string][]int) {
+		s.Items(func(m *M) bool { ms = append(ms, m); return true })
+		ps = make(map[string][]int)
+		s.Pairs(func(k string, v []int) bool { ps[k] = v; return true })
+		return ms, ps
+	}
+
+	// Iterators are shared by default.
+	got := cpy.New(cpy.IgnoreAllUnexported()).Copy(src).(Stream)
+	if ms, _ := collect(got); ms[0] != items[0] {
+		t.Errorf("shared iterator yields different values")
+	}
+
+	got = cpy.New(cpy.Iterators(cpy.DropIterators), cpy.IgnoreAllUnexported()).Copy(src).(Stream)
+	if got.Items != nil || got.Pairs != nil {
+		t.Errorf("dropped iterators are non-nil")
+	}
+
+	got = cpy.New(cpy.Iterators(cpy.MaterializeIterators), cpy.IgnoreAllUnexported()).Copy(src).(Stream)
+	wantItems := []*M{{A: 1}, {A: 2}, {A: 3}}
+	wantPairs := map[string][]int{"a": {1}, "b": {2, 3}}
+	srcItem := items[0]
+	items[0], pairs["b"][0] = nil, 0 // mutations of the source are not observed by the copy
+	gotItems, gotPairs := collect(got)
+	if diff := cmp.Diff(wantItems, gotItems, cmp.AllowUnexported(M{})); diff != "" {
+		t.Errorf("materialized Items mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantPairs, gotPairs); diff != "" {
+		t.Errorf("materialized Pairs mismatch (-want +got):\n%s", diff)
+	}
+	if gotItems[0] == srcItem {
+		t.Errorf("materialized iterator shares memory with the source")
+	}
+	var n int
+	got.Items(func(*M) bool { n++; return false })
+	if n != 1 {
+		t.Errorf("materialized iterator yielded %d values after stopping, want 1", n)
+	}
+}
 
-			tt.cpyOpts = append(tt.cpyOpts, cpy.IgnoreAllUnexported())
-			copier := cpy.New(tt.cpyOpts...)
-			dst := copier.Copy(tt.src)
-			tt.cmpOpts = append(tt.cmpOpts, cmp.AllowUnexported(S{}, M{}, M1{}, M2{}))
-			if diff := cmp.Diff(dst, tt.src, tt.cmpOpts...); diff != "" {
-				t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+func TestConcurrent(t *testing.T) {
+	copier := cpy.New(cpy.Shallow(time.Time{}), cpy.IgnoreAllUnexported())
+	src := S{Pt: &S{S: "hello"}, Sl: []M1{{A: 1}}, Ma1: map[string]M1{"a": {A: 2}}, Ti: now}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if diff := cmp.Diff(src, copier.Copy(src), cmp.AllowUnexported(S{}, M{}, M1{}, M2{})); diff != "" {
+					t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+					return
+				}
 			}
-			if tt.verify != nil {
-				tt.verify(t, dst, tt.src)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTrace(t *testing.T) {
+	var got []string
+	copier := cpy.New(
+		cpy.Trace(func(op string, t reflect.Type) func(cpy.Stats) {
+			got = append(got, fmt.Sprintf("start %v %v", op, t))
+			return func(s cpy.Stats) {
+				got = append(got, fmt.Sprintf("end %v %v %+v", op, t, s))
 			}
-		})
+		}),
+		cpy.Trace(func(op string, t reflect.Type) func(cpy.Stats) {
+			got = append(got, "start without end")
+			return nil
+		}),
+		cpy.IgnoreAllUnexported(),
+	)
+	type Node struct {
+		Next *Node
+		Vals []int
+	}
+	copier.Copy(&Node{Next: &Node{Vals: []int{1, 2, 3}}})
+	want := []string{
+		"start Copy *cpy_test.Node",
+		"start without end",
+		"end Copy *cpy_test.Node {Nodes:7 MaxDepth:5 Bytes:88 Kinds:map[]}",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("trace mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCopyWithStats(t *testing.T) {
+	copier := cpy.New(cpy.IgnoreAllUnexported())
+	type Node struct {
+		Next *Node
+		Vals []int
+		Tags map[string]interface{}
+	}
+	_, got := copier.CopyWithStats(&Node{Next: &Node{Vals: []int{1, 2, 3}}, Tags: map[string]interface{}{"k": "v"}})
+	want := cpy.Stats{
+		Nodes:    11,
+		MaxDepth: 5,
+		Bytes:    2*int64(reflect.TypeOf(Node{}).Size()) + 3*8 + 16 + 16,
+		Kinds: map[reflect.Kind]int{
+			reflect.Ptr:    3, // including the nil Next pointer
+			reflect.Struct: 2,
+			reflect.Slice:  2, // elements are copied in bulk
+			reflect.Map:    3,
+			reflect.String: 1,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CopyWithStats() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var src interface{}
+	if err := json.Unmarshal([]byte(`{
+		"apiVersion": "v1",
+		"kind": "ConfigMap",
+		"metadata": {"name": "config", "labels": {}, "finalizers": []},
+		"data": {"replicas": 3, "enabled": true, "ports": [80, 443], "extra": null}
+	}`), &src); err != nil {
+		t.Fatalf("json.Unmarshal error: %v", err)
+	}
+	src.(map[string]interface{})["time"] = now
+
+	for _, opts := range [][]cpy.Option{
+		{cpy.IgnoreAllUnexported()},
+		{cpy.IgnoreAllUnexported(), cpy.Shallow(map[string]interface{}{})},
+	} {
+		got := cpy.New(opts...).Copy(src)
+		if diff := cmp.Diff(src, got, cmpopts.IgnoreTypes(time.Time{})); diff != "" {
+			t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	got := cpy.New(cpy.IgnoreAllUnexported()).Copy(src).(map[string]interface{})
+	got["data"].(map[string]interface{})["ports"].([]interface{})[0] = 8080
+	if p := src.(map[string]interface{})["data"].(map[string]interface{})["ports"].([]interface{})[0]; p != 80.0 {
+		t.Errorf("src.data.ports[0] = %v, want 80", p)
+	}
+}
+
+func TestJSONOptions(t *testing.T) {
+	upper := func(c *cpy.Copier, v reflect.Value) reflect.Value {
+		return reflect.ValueOf(strings.ToUpper(v.String()))
+	}
+	replace := func(c *cpy.Copier, v reflect.Value) reflect.Value {
+		out := reflect.New(v.Type()).Elem()
+		out.Set(reflect.ValueOf("z"))
+		return out
+	}
+	tests := []struct {
+		name string
+		opt  cpy.Option
+		src  interface{}
+		want interface{}
+	}{{
+		name: "Transformer(string)",
+		opt:  cpy.Transformer(strings.ToUpper),
+		src:  map[string]interface{}{"A": "x", "B": []interface{}{"y"}},
+		want: map[string]interface{}{"A": "X", "B": []interface{}{"Y"}},
+	}, {
+		name: "FuncIf(string)",
+		opt:  cpy.FuncIf(func(t reflect.Type) bool { return t.Kind() == reflect.String }, upper),
+		src:  []interface{}{"x", map[string]interface{}{"A": "y"}},
+		want: []interface{}{"X", map[string]interface{}{"A": "Y"}},
+	}, {
+		name: "Transformer(float64)",
+		opt:  cpy.Transformer(func(f float64) float64 { return 2 * f }),
+		src:  map[string]interface{}{"A": 1.0, "B": []interface{}{2.0}},
+		want: map[string]interface{}{"A": 2.0, "B": []interface{}{4.0}},
+	}, {
+		name: "Transformer(bool)",
+		opt:  cpy.Transformer(func(b bool) bool { return !b }),
+		src:  []interface{}{true, map[string]interface{}{"A": true}},
+		want: []interface{}{false, map[string]interface{}{"A": false}},
+	}, {
+		name: "KindFunc(interface)",
+		opt:  cpy.KindFunc(reflect.Interface, replace),
+		src:  map[string]interface{}{"A": "x", "B": []interface{}{"y"}},
+		want: map[string]interface{}{"A": "z", "B": "z"},
+	}, {
+		name: "Transformer([]interface{})",
+		opt:  cpy.Transformer(func(a []interface{}) []interface{} { return append(a, "end") }),
+		src:  map[string]interface{}{"A": []interface{}{"x"}},
+		want: map[string]interface{}{"A": []interface{}{"x", "end"}},
+	}, {
+		name: "Transformer(map[string]interface{})",
+		opt: cpy.Transformer(func(m map[string]interface{}) map[string]interface{} {
+			m["seen"] = true
+			return m
+		}),
+		src:  []interface{}{map[string]interface{}{"A": "x"}},
+		want: []interface{}{map[string]interface{}{"A": "x", "seen": true}},
+	}}
+	for _, tt := range tests {
+		got := cpy.New(tt.opt, cpy.IgnoreAllUnexported()).Copy(tt.src)
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("Copy() with %v mismatch (-want +got):\n%s", tt.name, diff)
+		}
+	}
+}
+
+type Tree[T any] struct {
+	Value    T
+	Children []*Tree[T]
+}
+
+type Even[T any] struct {
+	Value T
+	Next  *Odd[T]
+}
+
+type Odd[T any] struct {
+	Value T
+	Next  []Even[T]
+}
+
+func TestGenericTypes(t *testing.T) {
+	tests := []struct {
+		src     interface{}
+		cpyOpts []cpy.Option
+	}{{
+		src: &Tree[string]{Value: "root", Children: []*Tree[string]{
+			{Value: "left"},
+			{Value: "right", Children: []*Tree[string]{{Value: "leaf"}}},
+		}},
+	}, {
+		src: &Tree[*M1]{Value: &M1{A: 1}, Children: []*Tree[*M1]{{Value: &M1{A: 2}}}},
+	}, {
+		src:     &Tree[M]{Value: M{a: 1}, Children: []*Tree[M]{{Value: M{a: 2}}}},
+		cpyOpts: []cpy.Option{cpy.Shallow(M{})},
+	}, {
+		src: &Even[int]{Value: 0, Next: &Odd[int]{Value: 1, Next: []Even[int]{
+			{Value: 2}, {Value: 4, Next: &Odd[int]{Value: 5}},
+		}}},
+	}}
+	for _, tt := range tests {
+		copier := cpy.New(append(tt.cpyOpts, cpy.IgnoreAllUnexported())...)
+		got := copier.Copy(tt.src)
+		if diff := cmp.Diff(tt.src, got, cmp.AllowUnexported(M{}, M1{})); diff != "" {
+			t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+		}
+		if reflect.ValueOf(got).Pointer() == reflect.ValueOf(tt.src).Pointer() {
+			t.Errorf("Copy() returned the source pointer")
+		}
+	}
+
+	// Types are resolved by their instantiation, such that a copy function
+	// registered for one instantiation does not apply to another.
+	copier := cpy.New(
+		cpy.Func(func(*Tree[int]) *Tree[int] { return &Tree[int]{Value: -1} }),
+		cpy.IgnoreAllUnexported(),
+	)
+	gotInt := copier.Copy(&Tree[int]{Value: 1}).(*Tree[int])
+	gotUint := copier.Copy(&Tree[uint]{Value: 1}).(*Tree[uint])
+	if gotInt.Value != -1 || gotUint.Value != 1 {
+		t.Errorf("Copy() = (%v, %v), want (-1, 1)", gotInt.Value, gotUint.Value)
 	}
 }
@@ -0,0 +1,211 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpytest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/go-cpy/cpy"
+)
+
+// VerifyMutations copies src using c, mutates every mutable location in
+// the copy one at a time, and reports an error if any mutation alters src
+// (as compared to a snapshot of src taken before copying).
+// The error reports the path to the first location in the copy
+// whose mutation altered src.
+//
+// Mutable locations are those considered by Verify, where every value
+// stored in them is mutated in turn (e.g., incrementing a number,
+// extending a string, or clearing a pointer), as well as map entries,
+// which are deleted, and buffered channels, which are sent a value.
+// Every mutation is undone before the next one is performed.
+// Unlike Verify, VerifyMutations observes sharing regardless of how memory
+// is shared (e.g., a channel referenced by both src and the copy), but
+// mutations that are not observable in src (e.g., incrementing a NaN)
+// go undetected. Since src is compared against the snapshot after every
+// mutation, VerifyMutations is intended for small representative values.
+//
+// VerifyMutations must not be used with values that are concurrently
+// accessed, as it mutates values that the copy shares with src.
+func VerifyMutations(c *cpy.Copier, src interface{}) error {
+	want := snapshot(reflect.ValueOf(src))
+	var err error
+	mutate(reflect.ValueOf(c.Copy(src)), rootName(src), make(map[visit]bool), func(path string) bool {
+		if snapshot(reflect.ValueOf(src)) != want {
+			err = fmt.Errorf("cpytest: mutating the copy at %v alters the source", path)
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+// visit identifies a pointer, slice, map, or channel that has been visited.
+type visit struct {
+	p uintptr
+	t reflect.Type
+}
+
+// mutate mutates every mutable location reachable from v, calling check
+// after every mutation and undoing the mutation afterwards.
+// The walk stops once check reports false.
+func mutate(v reflect.Value, path string, seen map[visit]bool, check func(path string) bool) bool {
+	if !v.IsValid() {
+		return true
+	}
+	if v.CanSet() && !mutateValue(v, path, check) {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan:
+		if v.IsNil() || seen[visit{v.Pointer(), v.Type()}] {
+			return true
+		}
+		seen[visit{v.Pointer(), v.Type()}] = true
+	case reflect.Slice:
+		if v.Len() == 0 || seen[visit{v.Pointer(), v.Type()}] {
+			return true
+		}
+		seen[visit{v.Pointer(), v.Type()}] = true
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return mutate(v.Elem(), path, seen, check)
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if !mutate(v.Index(i), fmt.Sprintf("%v[%d]", path, i), seen, check) {
+				return false
+			}
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			e := v.MapIndex(k)
+			kpath := fmt.Sprintf("%v[%#v]", path, k)
+			v.SetMapIndex(k, reflect.Value{})
+			ok := check(kpath)
+			v.SetMapIndex(k, e)
+			if !ok || !mutate(e, kpath, seen, check) {
+				return false
+			}
+		}
+	case reflect.Chan:
+		if v.Len() < v.Cap() && v.Type().ChanDir()&reflect.BothDir == reflect.BothDir {
+			v.Send(reflect.Zero(v.Type().Elem()))
+			ok := check(path)
+			v.Recv()
+			return ok
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.PkgPath == "" {
+				if !mutate(v.Field(i), path+"."+f.Name, seen, check) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// mutateValue changes the value stored in the settable location v,
+// calls check, and restores the value.
+// Values of aggregate kinds are mutated through their elements instead.
+func mutateValue(v reflect.Value, path string, check func(path string) bool) bool {
+	old := reflect.New(v.Type()).Elem()
+	old.Set(v)
+	defer v.Set(old)
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(!v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(v.Int() + 1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(v.Uint() + 1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(v.Float() + 1)
+	case reflect.Complex64, reflect.Complex128:
+		v.SetComplex(v.Complex() + 1)
+	case reflect.String:
+		v.SetString(v.String() + "*")
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Chan, reflect.Func:
+		if v.IsNil() {
+			return true
+		}
+		v.Set(reflect.Zero(v.Type()))
+	default:
+		return true
+	}
+	return check(path)
+}
+
+// snapshot renders every value reachable from v through exported fields,
+// such that two snapshots differ if any such value was altered.
+func snapshot(v reflect.Value) string {
+	var sb strings.Builder
+	render(&sb, v, make(map[visit]bool))
+	return sb.String()
+}
+
+func render(sb *strings.Builder, v reflect.Value, seen map[visit]bool) {
+	if !v.IsValid() {
+		sb.WriteString("<invalid>")
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Func, reflect.Slice, reflect.UnsafePointer:
+		if v.IsNil() {
+			sb.WriteString("nil")
+			return
+		}
+		// Render the identity of references to observe them being replaced.
+		fmt.Fprintf(sb, "%v(%#x)", v.Type(), v.Pointer())
+		if k := v.Kind(); k == reflect.Func || k == reflect.UnsafePointer || seen[visit{v.Pointer(), v.Type()}] {
+			return
+		}
+		seen[visit{v.Pointer(), v.Type()}] = true
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		sb.WriteString("{")
+		render(sb, v.Elem(), seen)
+		sb.WriteString("}")
+	case reflect.Array, reflect.Slice:
+		fmt.Fprintf(sb, "[%d]{", v.Len())
+		for i := 0; i < v.Len(); i++ {
+			render(sb, v.Index(i), seen)
+			sb.WriteString(",")
+		}
+		sb.WriteString("}")
+	case reflect.Map:
+		var entries []string
+		for iter := v.MapRange(); iter.Next(); {
+			var esb strings.Builder
+			fmt.Fprintf(&esb, "%#v:", iter.Key())
+			render(&esb, iter.Value(), seen)
+			entries = append(entries, esb.String())
+		}
+		sort.Strings(entries)
+		fmt.Fprintf(sb, "{%v}", strings.Join(entries, ","))
+	case reflect.Chan:
+		fmt.Fprintf(sb, "[%d]", v.Len())
+	case reflect.Struct:
+		sb.WriteString("{")
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.PkgPath == "" {
+				sb.WriteString(f.Name + ":")
+				render(sb, v.Field(i), seen)
+				sb.WriteString(",")
+			}
+		}
+		sb.WriteString("}")
+	default:
+		fmt.Fprintf(sb, "%#v", v)
+	}
+}
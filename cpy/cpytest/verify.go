@@ -0,0 +1,169 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cpytest provides utilities for testing uses of package cpy.
+package cpytest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/google/go-cpy/cpy"
+)
+
+// Verify copies src using c and reports an error if the copy is not
+// isolated from src, such that mutating the copy could alter src.
+// The error reports the path to the first mutable location in the copy
+// that shares memory with src.
+//
+// A location is mutable if it can be assigned to by users of the type,
+// namely pointed-at values, slice elements, and map entries reachable
+// through exported fields. Unexported fields, strings, functions,
+// and channels are not considered.
+//
+// Verify is intended for use in tests to check whether a given set of
+// options (e.g., Shallow types) is safe for the values being copied.
+// It only compares the memory of the copy and of src and thus misses
+// sharing that it does not consider (e.g., a channel referenced by both);
+// VerifyMutations observes sharing by mutating the copy instead.
+func Verify(c *cpy.Copier, src interface{}) error {
+	var srcMem memory
+	srcMem.walk(reflect.ValueOf(src), "", nil)
+	srcMem.index()
+
+	var err error
+	var dstMem memory
+	dstMem.walk(reflect.ValueOf(c.Copy(src)), rootName(src), func(path string, r region) bool {
+		if srcMem.overlaps(r) {
+			err = fmt.Errorf("cpytest: copy shares mutable memory with the source at %v", path)
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+func rootName(v interface{}) string {
+	if v == nil {
+		return "nil"
+	}
+	return reflect.TypeOf(v).String()
+}
+
+// region is a range of memory or a map.
+type region struct {
+	start, end uintptr // valid for memory ranges
+	mapPtr     uintptr // valid for maps
+}
+
+// memory is the set of mutable regions reachable from a value.
+type memory struct {
+	regions []region         // memory ranges sorted by start
+	maxEnds []uintptr        // maxEnds[i] is the maximum end within regions[:i+1]
+	maps    map[uintptr]bool // set of map pointers
+	visited map[region]bool
+}
+
+// walk records every mutable region reachable from v.
+// If visit is non-nil, it is called for every region and
+// the walk stops once visit reports false.
+func (m *memory) walk(v reflect.Value, path string, visit func(string, region) bool) bool {
+	if !v.IsValid() {
+		return true
+	}
+	record := func(r region) (ok, seen bool) {
+		if m.visited == nil {
+			m.visited = make(map[region]bool)
+			m.maps = make(map[uintptr]bool)
+		}
+		if m.visited[r] {
+			return true, true
+		}
+		m.visited[r] = true
+		if r.mapPtr != 0 {
+			m.maps[r.mapPtr] = true
+		} else if r.end > r.start {
+			m.regions = append(m.regions, r)
+		}
+		return visit == nil || visit(path, r), false
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return true
+		}
+		r := region{start: v.Pointer(), end: v.Pointer() + v.Type().Elem().Size()}
+		if ok, seen := record(r); !ok || seen {
+			return ok
+		}
+		return m.walk(v.Elem(), path, visit)
+	case reflect.Interface:
+		return m.walk(v.Elem(), path, visit)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !m.walk(v.Index(i), fmt.Sprintf("%v[%d]", path, i), visit) {
+				return false
+			}
+		}
+	case reflect.Slice:
+		if v.Cap() == 0 {
+			return true
+		}
+		r := region{start: v.Pointer(), end: v.Pointer() + uintptr(v.Cap())*v.Type().Elem().Size()}
+		if ok, seen := record(r); !ok || seen {
+			return ok
+		}
+		for i := 0; i < v.Len(); i++ {
+			if !m.walk(v.Index(i), fmt.Sprintf("%v[%d]", path, i), visit) {
+				return false
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return true
+		}
+		if ok, seen := record(region{mapPtr: v.Pointer()}); !ok || seen {
+			return ok
+		}
+		for iter := v.MapRange(); iter.Next(); {
+			if !m.walk(iter.Value(), fmt.Sprintf("%v[%#v]", path, iter.Key()), visit) {
+				return false
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.PkgPath == "" {
+				if !m.walk(v.Field(i), path+"."+f.Name, visit) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// index prepares m for calls to overlaps.
+func (m *memory) index() {
+	sort.Slice(m.regions, func(i, j int) bool { return m.regions[i].start < m.regions[j].start })
+	m.maxEnds = make([]uintptr, len(m.regions))
+	for i, r := range m.regions {
+		m.maxEnds[i] = r.end
+		if i > 0 && m.maxEnds[i-1] > r.end {
+			m.maxEnds[i] = m.maxEnds[i-1]
+		}
+	}
+}
+
+// overlaps reports whether r overlaps with any region in m.
+func (m *memory) overlaps(r region) bool {
+	if r.mapPtr != 0 {
+		return m.maps[r.mapPtr]
+	}
+	// Find the regions that start before r ends,
+	// and check whether any of them end after r starts.
+	i := sort.Search(len(m.regions), func(i int) bool { return m.regions[i].start >= r.end })
+	return i > 0 && m.maxEnds[i-1] > r.start
+}
@@ -0,0 +1,99 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpytest_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cpy/cpy"
+	"github.com/google/go-cpy/cpy/cpytest"
+)
+
+type T struct {
+	P  *int
+	L  []int
+	M  map[string][]int
+	I  interface{}
+	Ti time.Time
+	N  *T
+}
+
+func TestVerify(t *testing.T) {
+	n := 5
+	tests := []struct {
+		opts     []cpy.Option
+		src      interface{}
+		wantPath string // empty if no error is expected
+	}{{
+		opts: []cpy.Option{cpy.Shallow(time.Time{})},
+		src:  &T{P: &n, L: []int{1}, M: map[string][]int{"key": {2}}, I: &T{}},
+	}, {
+		opts:     []cpy.Option{cpy.Shallow(map[string][]int{})},
+		src:      &T{M: map[string][]int{"key": {2}}},
+		wantPath: "*cpytest_test.T.M",
+	}, {
+		opts:     []cpy.Option{cpy.Func(func(s []int) []int { return s[:1] })},
+		src:      &T{M: map[string][]int{"key": {2, 3}}},
+		wantPath: `*cpytest_test.T.M["key"]`,
+	}, {
+		opts:     []cpy.Option{cpy.Immutable(T{})},
+		src:      []*T{{L: []int{1}}},
+		wantPath: "[]*cpytest_test.T[0]",
+	}}
+	for _, tt := range tests {
+		copier := cpy.New(append(tt.opts, cpy.IgnoreAllUnexported())...)
+		err := cpytest.Verify(copier, tt.src)
+		switch {
+		case tt.wantPath == "" && err != nil:
+			t.Errorf("Verify() error: %v", err)
+		case tt.wantPath != "" && (err == nil || !strings.HasSuffix(err.Error(), " at "+tt.wantPath)):
+			t.Errorf("Verify() error = %v, want error at %v", err, tt.wantPath)
+		}
+	}
+}
+
+func TestVerifyMutations(t *testing.T) {
+	type Queue struct {
+		Name  string
+		Items chan int
+	}
+	n := 5
+	tests := []struct {
+		opts     []cpy.Option
+		src      interface{}
+		wantPath string // empty if no error is expected
+	}{{
+		opts: []cpy.Option{cpy.Shallow(time.Time{})},
+		src:  &T{P: &n, L: []int{1}, M: map[string][]int{"key": {2}}, I: &T{}, Ti: time.Unix(1, 0)},
+	}, {
+		opts:     []cpy.Option{cpy.Shallow(map[string][]int{})},
+		src:      &T{M: map[string][]int{"key": {2}}},
+		wantPath: `*cpytest_test.T.M["key"]`,
+	}, {
+		opts:     []cpy.Option{cpy.Func(func(s []int) []int { return s[:1] })},
+		src:      &T{M: map[string][]int{"key": {2, 3}}},
+		wantPath: `*cpytest_test.T.M["key"][0]`,
+	}, {
+		opts:     []cpy.Option{cpy.Immutable(T{})},
+		src:      []*T{{L: []int{1}}},
+		wantPath: "[]*cpytest_test.T[0].L",
+	}, {
+		// Channels are shared with the copy, which Verify does not consider.
+		src:      &Queue{Name: "jobs", Items: make(chan int, 1)},
+		wantPath: "*cpytest_test.Queue.Items",
+	}}
+	for _, tt := range tests {
+		copier := cpy.New(append(tt.opts, cpy.IgnoreAllUnexported())...)
+		err := cpytest.VerifyMutations(copier, tt.src)
+		switch {
+		case tt.wantPath == "" && err != nil:
+			t.Errorf("VerifyMutations() error: %v", err)
+		case tt.wantPath != "" && (err == nil || !strings.HasSuffix(err.Error(), " at "+tt.wantPath+" alters the source")):
+			t.Errorf("VerifyMutations() error = %v, want error at %v", err, tt.wantPath)
+		}
+	}
+}
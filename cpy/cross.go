@@ -0,0 +1,463 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// MatchFields specifies that Copier.CopyInto may copy a value into
+// a destination of a different type, such as a domain model into
+// a data transfer object.
+//
+// Values of different types are copied as follows:
+//
+// • Values of a type assignable to the destination type (e.g., a concrete
+// value into an interface) are copied as by Copy and then assigned.
+//
+// • Structs are copied field by field, where every exported field of the
+// destination is populated from the exported field of the source with
+// the same name. Destination fields without a matching source field are
+// left as zero and source fields without a matching destination field
+// are not copied. Embedded fields are matched by the name of their type.
+// A field may be matched by a different name using a struct tag
+// of the form `cpy:"name=CustomerID"` on either side, in which case
+// the field is matched by the tag name instead of its Go name
+// (see TagName). A field tagged `cpy:"-"` is never matched.
+// Fields may also be matched by the names in tags of other keys
+// (see MatchTags).
+//
+// • Maps with string keys (e.g., a map[string]interface{} decoded from JSON
+// or YAML) are copied into structs, where every exported field of the
+// destination is populated from the entry whose key is the name that
+// the field is matched by. Entries without a matching field are not copied.
+//
+// • Pointers, slices, arrays of the same length, and maps are copied by
+// allocating a new value of the destination type and copying every element
+// of the source into the corresponding element of the destination.
+//
+// • Pointers are copied into values of the type they point to
+// if permitted by FlattenPointers, and values into new pointers
+// if permitted by BoxValues.
+//
+// • Values held in interfaces are copied according to their dynamic type.
+// A value is copied into an interface that its type does not implement
+// by copying it into a type registered with RegisterTypes.
+//
+// CopyInto reports an error for all other combinations of types
+// unless the values are converted as permitted by ConvertTypes.
+//
+// Example usage:
+//
+//	copier := cpy.New(cpy.MatchFields(), cpy.IgnoreAllUnexported())
+//	var dto api.Order
+//	if err := copier.CopyInto(&dto, order); err != nil {
+//		return err
+//	}
+func MatchFields() Option {
+	return option{matchFields: true}
+}
+
+// FlattenPointers specifies that Copier.CopyInto may copy a pointer into
+// a value of the type that it points to when copying across types with
+// MatchFields (e.g., a *string field into a string field), which collapses
+// indirection that the destination does not need. A nil pointer leaves the
+// destination as zero. Pointers of multiple levels (e.g., **T) are flattened
+// into as many levels as needed, and pointers that form a cycle through
+// flattened pointers are reported as an error wrapping ErrCycle.
+//
+// Example usage:
+//
+//	copier := cpy.New(cpy.MatchFields(), cpy.FlattenPointers(), cpy.IgnoreAllUnexported())
+//	var order domain.Order // with a string Note field
+//	err := copier.CopyInto(&order, wireOrder) // with a *string Note field
+func FlattenPointers() Option {
+	return option{flattenPointers: true}
+}
+
+// BoxValues specifies that Copier.CopyInto may copy a value into a newly
+// allocated pointer to a value of the destination type when copying across
+// types with MatchFields (e.g., a string field into a *string field),
+// which is the inverse of FlattenPointers. Every value is boxed,
+// including zero values (e.g., an empty string or a nil slice),
+// such that the destination pointer is never nil.
+//
+// Example usage:
+//
+//	copier := cpy.New(cpy.MatchFields(), cpy.BoxValues(), cpy.IgnoreAllUnexported())
+//	var req api.UpdateRequest // with a *int64 Quota field
+//	err := copier.CopyInto(&req, settings) // with an int64 Quota field
+func BoxValues() Option {
+	return option{boxValues: true}
+}
+
+// PointerModels bundles the options for copying API models that represent
+// every optional field as a pointer (e.g., *string or *int64 fields), such
+// as the request and response types of generated cloud SDKs. It specifies:
+//
+// • MatchFields and FlattenPointers, such that Copier.CopyInto may copy
+// a model into a type with plain value fields (e.g., a domain type),
+//
+// • that the unexported fields of struct types declared in packages
+// matching one of the patterns (e.g., the metadata and serialization
+// markers that SDKs embed in every model) are ignored, as by
+// IgnoreUnexported.
+//
+// Copy needs no further options for such models, since it copies a pointer
+// to a scalar by allocating a new value and storing into it.
+// Patterns have the same form as for AllowUnexportedPackages,
+// and it panics if any pattern is invalid.
+// Unexported fields of types in all other packages are still reported,
+// unless ignored by other options.
+//
+// Example usage:
+//
+//	copier := cpy.New(cpy.PointerModels("github.com/aws/aws-sdk-go-v2/..."))
+//	out := copier.Copy(resp).(*s3.GetObjectOutput)
+//	var obj domain.Object // with a string Key field
+//	err := copier.CopyInto(&obj, resp) // with a *string Key field
+func PointerModels(patterns ...string) Option {
+	for _, p := range patterns {
+		if p == "" || p == "..." {
+			panic(fmt.Sprintf("cpy.PointerModels: invalid pattern %q", p))
+		}
+	}
+	return Options{MatchFields(), FlattenPointers(), option{ignoredPackages: append([]string(nil), patterns...)}}
+}
+
+// MatchTags specifies that Copier.CopyInto matches fields when copying
+// between struct types (see MatchFields) by the name in the struct tag
+// of the first of the provided keys that a field has, which is the part of
+// the tag before the first comma (e.g., "customer_id" for both
+// `db:"customer_id"` and `json:"customer_id,omitempty"`).
+// Fields without any of these tags or with an empty name in them
+// are matched by their Go name, and fields named "-" are never matched.
+// A name in a cpy tag (e.g., `cpy:"name=CustomerID"`) takes precedence.
+// If multiple MatchTags options are provided, the keys of the latter
+// are consulted first.
+//
+// Example usage:
+//
+//	cpy.MatchTags("db", "json")
+//
+// This option specifies that fields of a storage model tagged by column
+// name are copied into fields of an API response tagged by JSON name,
+// which avoids keeping Go names consistent across naming conventions.
+func MatchTags(keys ...string) Option {
+	for _, key := range keys {
+		if key == "" || strings.ContainsAny(key, " \t\n\"`:") {
+			panic(fmt.Sprintf("cpy.MatchTags: invalid tag key %q", key))
+		}
+	}
+	return option{matchTags: keys}
+}
+
+// ConvertTypes specifies that Copier.CopyInto may convert values between
+// different types that Go permits converting between when copying across
+// types with MatchFields, which is useful to migrate values between
+// near-identical generations of a struct. The permitted conversions are:
+//
+// • between numeric types (e.g., int32 into int64 or float64 into int),
+// following the rules of a Go conversion such that values may be truncated,
+//
+// • between types of the same kind with identical underlying types
+// (e.g., a named string type into string), and
+//
+// • between strings and slices of bytes or runes.
+//
+// Values are deep copied before being converted,
+// so the result never shares memory with the source.
+// Conversions from integers to strings are never performed.
+func ConvertTypes() Option {
+	return option{convertTypes: true}
+}
+
+// RegisterTypes registers the types of the provided values as concrete
+// types that Copier.CopyInto may copy values into when it copies a value
+// into an interface that the type of the value does not implement
+// (see MatchFields), such as an interface field of a data transfer object.
+// Similar to how gob decodes values into types registered with gob.Register,
+// a value is copied into the registered type that implements the interface
+// and has the same name as the type of the value, ignoring its package,
+// where pointer types are only registered for pointers to types of that name.
+// If multiple registered types qualify, the latter takes precedence.
+// The provided values must be of a named type or a pointer to one;
+// otherwise it will panic.
+//
+// Example usage:
+//
+//	cpy.RegisterTypes(&api.Circle{}, &api.Square{})
+//
+// This option specifies that a *shapes.Circle held in a shapes.Shape
+// is copied into an *api.Circle when copied into an api.Shape.
+func RegisterTypes(values ...interface{}) Option {
+	var opt option
+	for _, v := range values {
+		t := reflect.TypeOf(v)
+		if t == nil || baseName(t) == "" {
+			panic(fmt.Sprintf("cpy.RegisterTypes: type %v must be a named type or a pointer to one", t))
+		}
+		opt.registeredTypes = append(opt.registeredTypes, t)
+	}
+	return opt
+}
+
+// baseName returns the name of t (or of the type that t points to)
+// without its package, or "" if it is unnamed.
+func baseName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// concreteType returns the registered type that values of type st are
+// copied into when copied into the interface dt, or nil if there is none.
+func (c *Copier) concreteType(dt, st reflect.Type) reflect.Type {
+	k := [2]reflect.Type{dt, st}
+	v, ok := c.concreteTypesCache.Load(k)
+	if !ok {
+		v, _ = c.concreteTypesCache.LoadOrStore(k, c.concreteTypeSlow(dt, st))
+	}
+	t, _ := v.(reflect.Type)
+	return t
+}
+func (c *Copier) concreteTypeSlow(dt, st reflect.Type) reflect.Type {
+	for _, t := range c.registeredTypes {
+		if t.Implements(dt) && baseName(t) == baseName(st) && (t.Kind() == reflect.Ptr) == (st.Kind() == reflect.Ptr) {
+			return t
+		}
+	}
+	return nil
+}
+
+// convertible reports whether values of type st may be converted
+// into type dt (see ConvertTypes).
+func convertible(dt, st reflect.Type) bool {
+	switch {
+	case isNumeric(dt.Kind()) && isNumeric(st.Kind()),
+		isComplex(dt.Kind()) && isComplex(st.Kind()):
+		return true
+	case dt.Kind() == reflect.String && st.Kind() == reflect.Slice,
+		dt.Kind() == reflect.Slice && st.Kind() == reflect.String:
+		return st.ConvertibleTo(dt)
+	default:
+		return dt.Kind() == st.Kind() && st.ConvertibleTo(dt)
+	}
+}
+
+func isNumeric(k reflect.Kind) bool { return reflect.Int <= k && k <= reflect.Float64 }
+func isComplex(k reflect.Kind) bool { return k == reflect.Complex64 || k == reflect.Complex128 }
+
+// fieldPair is a pair of fields of a destination and a source struct
+// whose values are copied from one to the other.
+type fieldPair struct {
+	dst, src int
+}
+
+// fieldPairs returns the fields of the source struct st that are copied
+// into fields of the destination struct dt.
+func (c *Copier) fieldPairs(dt, st reflect.Type) []fieldPair {
+	k := [2]reflect.Type{dt, st}
+	v, ok := c.fieldPairsCache.Load(k)
+	if !ok {
+		v, _ = c.fieldPairsCache.LoadOrStore(k, c.fieldPairsSlow(dt, st))
+	}
+	return v.([]fieldPair)
+}
+func (c *Copier) fieldPairsSlow(dt, st reflect.Type) []fieldPair {
+	srcFields := make(map[string]int)
+	for _, i := range loadStructFields(st).exported {
+		f := st.Field(i)
+		if name, ok := c.matchName(f); ok && c.parseTag(f).mode != tagSkip && c.parseTag(f).mode != tagRedact {
+			srcFields[name] = i
+		}
+	}
+	var pairs []fieldPair
+	for _, i := range loadStructFields(dt).exported {
+		f := dt.Field(i)
+		name, ok := c.matchName(f)
+		if !ok || c.parseTag(f).mode == tagSkip {
+			continue
+		}
+		if j, ok := srcFields[name]; ok {
+			pairs = append(pairs, fieldPair{dst: i, src: j})
+		}
+	}
+	return pairs
+}
+
+// matchName returns the name that field f is matched by, which is the name
+// in its tag if any, the name in the first tag of a key provided to MatchTags
+// if any, or its Go name otherwise. It reports false if f is never matched.
+func (c *Copier) matchName(f reflect.StructField) (string, bool) {
+	if name := c.parseTag(f).name; name != "" {
+		return name, true
+	}
+	for _, key := range c.matchTags {
+		tag, ok := f.Tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		switch name, _, _ := strings.Cut(tag, ","); name {
+		case "-":
+			return "", false
+		case "":
+			continue // e.g., `json:",omitempty"`
+		default:
+			return name, true
+		}
+	}
+	return f.Name, true
+}
+
+// copyAcrossRoot copies the root value src into dst,
+// which must be a settable zero value of a possibly different type.
+func (c *Copier) copyAcrossRoot(dst, src reflect.Value) {
+	s := &state{Copier: c, root: src.Type()}
+	if c.preserveAliasing {
+		s.memo = getMemo()
+		defer putMemo(s.memo)
+	}
+	if len(c.middleware) > 0 {
+		s.next = s.chain()
+	}
+	if len(c.traces) > 0 {
+		defer s.trace("CopyInto", src.Type())()
+	}
+	s.copyAcross(dst, src)
+}
+
+// copyAcross copies src into dst, which must be a settable zero value
+// of a possibly different type (see MatchFields).
+// It panics with a copyError if src cannot be copied into dst.
+func (s *state) copyAcross(dst, src reflect.Value) {
+	src = readable(src)
+	dt, st := dst.Type(), src.Type()
+	if st == dt || st.AssignableTo(dt) {
+		dst.Set(s.copy(src))
+		return
+	}
+	if st.Kind() == reflect.Interface {
+		if !src.IsNil() {
+			s.copyAcross(dst, src.Elem())
+		}
+		return
+	}
+	switch {
+	case dt.Kind() == reflect.Interface && s.concreteType(dt, st) != nil:
+		v := reflect.New(s.concreteType(dt, st)).Elem()
+		s.copyAcross(v, src)
+		dst.Set(v)
+	case dt.Kind() == reflect.Ptr && st.Kind() == reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		k := memoKey{src.UnsafePointer(), dt}
+		if p, ok := s.copied(k); ok {
+			dst.Set(p)
+			return
+		}
+		if s.cyclic(k) {
+			s.copyCycle(dst, src)
+			return
+		}
+		p := reflect.New(dt.Elem())
+		s.record(k, p) // record before copying to handle cycles
+		s.push(PathStep{Type: st.Elem(), Index: -1})
+		s.copyAcross(p.Elem(), src.Elem())
+		s.pop()
+		s.unrecord(k)
+		dst.Set(p)
+	case s.flattenPointers && st.Kind() == reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		// Flattened pointers cannot be shared within the copy,
+		// so cycles must be detected even if aliasing is preserved.
+		k := memoKey{src.UnsafePointer(), dt}
+		if s.ptrs.contains(k) {
+			s.copyCycle(dst, src)
+			return
+		}
+		s.ptrs.push(k)
+		s.push(PathStep{Type: st.Elem(), Index: -1})
+		s.copyAcross(dst, src.Elem())
+		s.pop()
+		s.ptrs.pop(k)
+	case s.boxValues && dt.Kind() == reflect.Ptr:
+		p := reflect.New(dt.Elem())
+		s.copyAcross(p.Elem(), src)
+		dst.Set(p)
+	case dt.Kind() == reflect.Slice && st.Kind() == reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		sl := reflect.MakeSlice(dt, src.Len(), src.Len())
+		s.copyElemsAcross(sl, src)
+		dst.Set(sl)
+	case dt.Kind() == reflect.Array && st.Kind() == reflect.Array && dt.Len() == st.Len():
+		s.copyElemsAcross(dst, src)
+	case dt.Kind() == reflect.Map && st.Kind() == reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		m := reflect.MakeMapWithSize(dt, src.Len())
+		for iter := src.MapRange(); iter.Next(); {
+			k := reflect.New(dt.Key()).Elem()
+			s.copyAcross(k, iter.Key())
+			v := reflect.New(dt.Elem()).Elem()
+			s.push(PathStep{Type: st.Elem(), Index: -1, Key: iter.Key()})
+			s.copyAcross(v, iter.Value())
+			s.pop()
+			m.SetMapIndex(k, v)
+		}
+		dst.Set(m)
+	case dt.Kind() == reflect.Struct && st.Kind() == reflect.Struct:
+		for _, p := range s.fieldPairs(dt, st) {
+			f := st.Field(p.src)
+			s.push(PathStep{Type: f.Type, Field: f.Name, Index: -1})
+			s.copyAcross(dst.Field(p.dst), src.Field(p.src))
+			s.pop()
+		}
+	case dt.Kind() == reflect.Struct && st.Kind() == reflect.Map && st.Key().Kind() == reflect.String:
+		if src.IsNil() {
+			return
+		}
+		for _, i := range loadStructFields(dt).exported {
+			f := dt.Field(i)
+			name, ok := s.matchName(f)
+			if !ok || s.parseTag(f).mode == tagSkip {
+				continue
+			}
+			k := reflect.ValueOf(name).Convert(st.Key())
+			v := src.MapIndex(k)
+			if !v.IsValid() {
+				continue
+			}
+			s.push(PathStep{Type: st.Elem(), Index: -1, Key: k})
+			s.copyAcross(dst.Field(i), v)
+			s.pop()
+		}
+	case s.convertTypes && convertible(dt, st):
+		dst.Set(s.copy(src).Convert(dt))
+	case len(s.path) > 0:
+		panic(errorf("cpy.CopyInto: cannot copy %v into %v at %v", st, dt, s.path))
+	default:
+		panic(errorf("cpy.CopyInto: cannot copy %v into %v", st, dt))
+	}
+}
+
+// copyElemsAcross copies every element of the array or slice src into dst,
+// which must be of the same length.
+func (s *state) copyElemsAcross(dst, src reflect.Value) {
+	for i := 0; i < src.Len(); i++ {
+		s.push(PathStep{Type: src.Type().Elem(), Index: i})
+		s.copyAcross(dst.Index(i), src.Index(i))
+		s.pop()
+	}
+}
@@ -0,0 +1,415 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/go-cpy/cpy"
+)
+
+type (
+	Invoice struct {
+		ID       int
+		Customer *Customer
+		Items    []Item
+		Tags     map[string]Item
+		internal string
+	}
+	Customer struct {
+		Name  string
+		Email string
+	}
+	Item struct {
+		SKU   string
+		Count int
+	}
+
+	InvoiceDTO struct {
+		ID       int
+		Customer *CustomerDTO
+		Items    []ItemDTO
+		Tags     map[string]ItemDTO
+		Note     string
+	}
+	CustomerDTO struct {
+		Name string
+	}
+	ItemDTO struct {
+		SKU   string
+		Count int
+	}
+)
+
+func TestMatchFields(t *testing.T) {
+	c := cpy.New(cpy.MatchFields(), cpy.IgnoreAllUnexported())
+
+	src := &Invoice{
+		ID:       1,
+		Customer: &Customer{Name: "Gopher", Email: "gopher@example.com"},
+		Items:    []Item{{"A", 1}, {"B", 2}},
+		Tags:     map[string]Item{"gift": {"C", 3}},
+		internal: "secret",
+	}
+	var got InvoiceDTO
+	if err := c.CopyInto(&got, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	want := InvoiceDTO{
+		ID:       1,
+		Customer: &CustomerDTO{Name: "Gopher"},
+		Items:    []ItemDTO{{"A", 1}, {"B", 2}},
+		Tags:     map[string]ItemDTO{"gift": {"C", 3}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CopyInto() mismatch (-want +got):\n%s", diff)
+	}
+
+	type Bad struct{ Items string }
+	err := c.CopyInto(new(Bad), src)
+	if err == nil || !strings.Contains(err.Error(), "cannot copy []cpy_test.Item into string at .Items") {
+		t.Errorf("CopyInto() error = %v, want mismatched field error", err)
+	}
+
+	if err := cpy.New(cpy.IgnoreAllUnexported()).CopyInto(new(InvoiceDTO), src); err == nil {
+		t.Errorf("CopyInto() without MatchFields succeeded, want error")
+	}
+}
+
+func TestMatchFieldsTag(t *testing.T) {
+	type (
+		Account struct {
+			ID     int
+			Holder string `cpy:"name=Owner"`
+			Secret string `cpy:"-"`
+		}
+		AccountDTO struct {
+			Number int `cpy:"name=ID"`
+			Owner  string
+			Secret string
+		}
+	)
+	src := Account{ID: 1, Holder: "Gopher", Secret: "hunter2"}
+	want := AccountDTO{Number: 1, Owner: "Gopher"}
+
+	var got AccountDTO
+	if err := cpy.New(cpy.MatchFields(), cpy.IgnoreAllUnexported()).CopyInto(&got, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CopyInto() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMatchTags(t *testing.T) {
+	type (
+		Row struct {
+			CustomerID int    `db:"customer_id"`
+			FullName   string `db:"name" json:"full_name"`
+			Password   string `db:"-"`
+			Note       string
+		}
+		Response struct {
+			ID       int    `json:"customer_id,omitempty"`
+			Name     string `cpy:"name=name" json:"display_name"`
+			Password string
+			Note     string `json:",omitempty"`
+		}
+	)
+	src := Row{CustomerID: 1, FullName: "Gopher", Password: "hunter2", Note: "note"}
+	want := Response{ID: 1, Name: "Gopher", Note: "note"}
+
+	var got Response
+	c := cpy.New(cpy.MatchFields(), cpy.MatchTags("db", "json"), cpy.IgnoreAllUnexported())
+	if err := c.CopyInto(&got, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CopyInto() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMatchFieldsMap(t *testing.T) {
+	type (
+		Backend struct {
+			Host string
+			Port int
+		}
+		Config struct {
+			Name     string     `json:"name"`
+			Backends []*Backend `json:"backends"`
+			Limits   map[string]int
+			Secret   string `cpy:"-"`
+		}
+	)
+	var src map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"name": "frontend",
+		"backends": [{"Host": "a", "Port": 80}, null],
+		"Limits": {"rps": 100},
+		"Secret": "hunter2",
+		"Unknown": true
+	}`), &src); err != nil {
+		t.Fatal(err)
+	}
+	want := Config{
+		Name:     "frontend",
+		Backends: []*Backend{{Host: "a", Port: 80}, nil},
+		Limits:   map[string]int{"rps": 100},
+	}
+
+	c := cpy.New(cpy.MatchFields(), cpy.MatchTags("json"), cpy.BoxValues(), cpy.ConvertTypes(), cpy.IgnoreAllUnexported())
+	var got Config
+	if err := c.CopyInto(&got, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CopyInto() mismatch (-want +got):\n%s", diff)
+	}
+
+	src["backends"] = []interface{}{map[string]interface{}{"Port": "80"}}
+	err := c.CopyInto(new(Config), src)
+	if err == nil || !strings.Contains(err.Error(), `at ["backends"][0]["Port"]`) {
+		t.Errorf("CopyInto() error = %v, want error at the path of the mismatched entry", err)
+	}
+}
+
+func TestPointerModels(t *testing.T) {
+	type (
+		Metadata struct{ values map[string]string }
+		Owner    struct {
+			ID      *string
+			noSerde struct{}
+		}
+		Output struct {
+			Key      *string
+			Size     *int64
+			Owner    *Owner
+			Tags     []*string
+			Metadata Metadata
+			noSerde  struct{}
+		}
+		Object struct {
+			Key   string
+			Size  int64
+			Owner struct{ ID string }
+			Tags  []string
+		}
+	)
+	key, id, tag, size := "key", "owner", "tag", int64(42)
+	src := &Output{Key: &key, Size: &size, Owner: &Owner{ID: &id}, Tags: []*string{&tag}}
+	c := cpy.New(cpy.PointerModels(reflect.TypeOf(Output{}).PkgPath()))
+
+	got := c.Copy(src).(*Output)
+	if diff := cmp.Diff(src, got, cmpopts.IgnoreUnexported(Output{}, Owner{}, Metadata{})); diff != "" {
+		t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+	}
+	if got.Key == src.Key || got.Size == src.Size || got.Owner.ID == src.Owner.ID || got.Tags[0] == src.Tags[0] {
+		t.Errorf("Copy() shares pointers with the source")
+	}
+
+	var obj Object
+	if err := c.CopyInto(&obj, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	want := Object{Key: "key", Size: 42, Owner: struct{ ID string }{"owner"}, Tags: []string{"tag"}}
+	if diff := cmp.Diff(want, obj); diff != "" {
+		t.Errorf("CopyInto() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := cpy.New(cpy.PointerModels("example.com/sdk/...")).CopyE(src); err == nil {
+		t.Errorf("CopyE() of unexported fields outside the packages succeeded, want error")
+	}
+}
+
+func TestFlattenPointers(t *testing.T) {
+	type (
+		Wire struct {
+			Note  *string
+			Count **int
+			Tags  []*string
+			Next  *Wire
+			Empty *string
+		}
+		Model struct {
+			Note  string
+			Count int
+			Tags  []string
+			Next  *Model
+			Empty string
+		}
+	)
+	note, tag, count := "note", "tag", 3
+	pcount := &count
+	src := &Wire{Note: &note, Count: &pcount, Tags: []*string{&tag, nil}, Next: &Wire{Note: &note}}
+	want := Model{Note: "note", Count: 3, Tags: []string{"tag", ""}, Next: &Model{Note: "note"}}
+
+	c := cpy.New(cpy.MatchFields(), cpy.FlattenPointers(), cpy.IgnoreAllUnexported())
+	var got Model
+	if err := c.CopyInto(&got, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CopyInto() mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := cpy.New(cpy.MatchFields(), cpy.IgnoreAllUnexported()).CopyInto(new(Model), src); err == nil {
+		t.Errorf("CopyInto() without FlattenPointers succeeded, want error")
+	}
+
+	type (
+		Node      struct{ Kids []*Node }
+		NodeValue struct{ Kids []NodeValue }
+	)
+	cyclic := &Node{}
+	cyclic.Kids = []*Node{{}, cyclic}
+	for _, c := range []*cpy.Copier{c, c.With(cpy.PreserveAliasing())} {
+		err := c.CopyInto(new(NodeValue), cyclic)
+		if !errors.Is(err, cpy.ErrCycle) || !strings.Contains(err.Error(), "at .Kids[1]") {
+			t.Errorf("CopyInto() error = %v, want error wrapping ErrCycle", err)
+		}
+	}
+}
+
+func TestBoxValues(t *testing.T) {
+	type (
+		Settings struct {
+			Quota int64
+			Name  string
+			Tags  []string
+			Limit *int64
+		}
+		Request struct {
+			Quota *int64
+			Name  **string
+			Tags  *[]*string
+			Limit *int64
+		}
+	)
+	quota, name, tag := int64(10), "name", "tag"
+	pname := &name
+	src := Settings{Quota: 10, Name: "name", Tags: []string{"tag"}, Limit: &quota}
+	want := Request{Quota: &quota, Name: &pname, Tags: &[]*string{&tag}, Limit: &quota}
+
+	c := cpy.New(cpy.MatchFields(), cpy.BoxValues(), cpy.IgnoreAllUnexported())
+	var got Request
+	if err := c.CopyInto(&got, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CopyInto() mismatch (-want +got):\n%s", diff)
+	}
+	if got.Limit == src.Limit {
+		t.Errorf("CopyInto() shares memory with the source")
+	}
+
+	var zero Request
+	if err := c.CopyInto(&zero, Settings{}); err != nil || zero.Quota == nil || *zero.Quota != 0 {
+		t.Errorf("CopyInto(Settings{}) = %+v, %v, want boxed zero values", zero, err)
+	}
+
+	if err := cpy.New(cpy.MatchFields(), cpy.IgnoreAllUnexported()).CopyInto(new(Request), src); err == nil {
+		t.Errorf("CopyInto() without BoxValues succeeded, want error")
+	}
+}
+
+type (
+	Shape  interface{ Kind() string }
+	Circle struct{ Radius float64 }
+	Square struct{ Side float64 }
+
+	DrawingDTO struct {
+		Main   Shape
+		Shapes []Shape
+	}
+)
+
+func (*Circle) Kind() string { return "circle" }
+func (Square) Kind() string  { return "square" }
+
+func TestRegisterTypes(t *testing.T) {
+	c := cpy.New(cpy.MatchFields(), cpy.RegisterTypes(&Circle{}, Square{}), cpy.IgnoreAllUnexported())
+	want := DrawingDTO{
+		Main:   &Circle{Radius: 1},
+		Shapes: []Shape{&Circle{Radius: 2}, Square{Side: 3}, nil},
+	}
+
+	// Types of the same name in the source, which do not implement Shape.
+	type (
+		Circle   struct{ Radius float64 }
+		Square   struct{ Side float64 }
+		Triangle struct{ Base float64 }
+		Drawing  struct {
+			Main   interface{}
+			Shapes []interface{}
+		}
+	)
+	src := Drawing{
+		Main:   &Circle{Radius: 1},
+		Shapes: []interface{}{&Circle{Radius: 2}, Square{Side: 3}, nil},
+	}
+	var got DrawingDTO
+	if err := c.CopyInto(&got, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CopyInto() mismatch (-want +got):\n%s", diff)
+	}
+	if got.Main == src.Main {
+		t.Errorf("CopyInto() shares memory with the source")
+	}
+
+	for _, v := range []interface{}{Circle{Radius: 1}, &Triangle{Base: 1}} {
+		err := c.CopyInto(new(DrawingDTO), Drawing{Main: v})
+		if err == nil || !strings.Contains(err.Error(), "into cpy_test.Shape at .Main") {
+			t.Errorf("CopyInto(%T) error = %v, want unregistered type error", v, err)
+		}
+	}
+}
+
+func TestConvertTypes(t *testing.T) {
+	type (
+		Level  string
+		Bytes  []byte
+		ItemV1 struct {
+			Count int32
+			Level Level
+			Data  []byte
+			Text  string
+			Ratio float32
+		}
+		ItemV2 struct {
+			Count int64
+			Level string
+			Data  string
+			Text  Bytes
+			Ratio float64
+		}
+	)
+	src := ItemV1{Count: 3, Level: "high", Data: []byte("data"), Text: "text", Ratio: 0.5}
+	want := ItemV2{Count: 3, Level: "high", Data: "data", Text: Bytes("text"), Ratio: 0.5}
+
+	var got ItemV2
+	if err := cpy.New(cpy.MatchFields(), cpy.ConvertTypes(), cpy.IgnoreAllUnexported()).CopyInto(&got, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CopyInto() mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := cpy.New(cpy.MatchFields(), cpy.IgnoreAllUnexported()).CopyInto(&got, src); err == nil {
+		t.Errorf("CopyInto() without ConvertTypes succeeded, want error")
+	}
+	type IntToString struct{ Count string }
+	if err := cpy.New(cpy.MatchFields(), cpy.ConvertTypes(), cpy.IgnoreAllUnexported()).CopyInto(new(IntToString), src); err == nil {
+		t.Errorf("CopyInto() converted integer to string, want error")
+	}
+}
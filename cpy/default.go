@@ -0,0 +1,49 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import "sync/atomic"
+
+// defaultCopier holds the *Copier used by the package-level functions.
+var defaultCopier atomic.Value // *Copier
+
+func init() {
+	defaultCopier.Store(New(IgnoreAllUnexported()))
+}
+
+// Default returns the Copier used by Copy and by Clone,
+// which extends it with the options provided to it.
+// Unless changed by SetDefault, it is a Copier initialized with
+// only the IgnoreAllUnexported option.
+func Default() *Copier {
+	return defaultCopier.Load().(*Copier)
+}
+
+// SetDefault sets the Copier used by Copy and by Clone.
+// It is intended to be called once during program initialization,
+// but is safe to call concurrently with copies,
+// which use either the previous or the new Copier.
+//
+// Example usage:
+//
+//	func main() {
+//		cpy.SetDefault(cpy.New(
+//			cpy.Immutable(time.Time{}),
+//			cpy.IgnoreAllUnexported(),
+//		))
+//		...
+//	}
+func SetDefault(c *Copier) {
+	if c == nil {
+		panic("cpy.SetDefault: Copier must not be nil")
+	}
+	defaultCopier.Store(c)
+}
+
+// Copy copies v using the default Copier.
+// It is equivalent to Default().Copy(v).
+func Copy(v interface{}) interface{} {
+	return Default().Copy(v)
+}
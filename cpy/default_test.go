@@ -0,0 +1,30 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cpy/cpy"
+)
+
+func TestDefault(t *testing.T) {
+	prev := cpy.Default()
+	defer cpy.SetDefault(prev)
+
+	src := S{Ti: now, Pt: &S{S: "hello"}}
+	if got := cpy.Copy(src).(S); !got.Ti.IsZero() || got.Pt == src.Pt || got.Pt.S != "hello" {
+		t.Errorf("Copy() = %+v, want deep copy ignoring unexported fields", got)
+	}
+
+	cpy.SetDefault(cpy.New(cpy.Shallow(time.Time{}), cpy.IgnoreAllUnexported()))
+	if got := cpy.Copy(src).(S); !got.Ti.Equal(now) {
+		t.Errorf("Copy().Ti = %v, want %v", got.Ti, now)
+	}
+	if got := cpy.Clone(src); !got.Ti.Equal(now) {
+		t.Errorf("Clone().Ti = %v, want %v", got.Ti, now)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import "reflect"
+
+// isIterator reports whether t is an iterator function type of the form
+// "func(yield func(V) bool)" or "func(yield func(K, V) bool)".
+func isIterator(t reflect.Type) bool {
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 0 || t.IsVariadic() {
+		return false
+	}
+	yt := t.In(0)
+	return yt.Kind() == reflect.Func && (yt.NumIn() == 1 || yt.NumIn() == 2) &&
+		yt.NumOut() == 1 && yt.Out(0).Kind() == reflect.Bool && !yt.IsVariadic()
+}
+
+// copyIterator copies the non-nil iterator function src into dst
+// according to the iterator policy, which must not be ShareIterators.
+func (s *state) copyIterator(dst, src reflect.Value) {
+	if s.iterators != MaterializeIterators {
+		return // leave dst as nil
+	}
+
+	// Collect every value yielded by the source and deep copy them afterwards
+	// so that the state is not captured by (and escape through) yield.
+	yt := src.Type().In(0)
+	cont := []reflect.Value{reflect.ValueOf(true).Convert(yt.Out(0))}
+	var seq [][]reflect.Value
+	yield := reflect.MakeFunc(yt, func(in []reflect.Value) []reflect.Value {
+		seq = append(seq, append([]reflect.Value(nil), in...))
+		return cont
+	})
+	src.Call([]reflect.Value{yield})
+	for _, vs := range seq {
+		for i, v := range vs {
+			vs[i] = s.copy(v)
+		}
+	}
+
+	// Yield the copied values in order until the consumer stops.
+	dst.Set(reflect.MakeFunc(src.Type(), func(in []reflect.Value) []reflect.Value {
+		for _, vs := range seq {
+			if !in[0].Call(vs)[0].Bool() {
+				break
+			}
+		}
+		return nil
+	}))
+}
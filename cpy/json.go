@@ -0,0 +1,78 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+var (
+	jsonObjectType = reflect.TypeOf(map[string]interface{}(nil))
+	jsonArrayType  = reflect.TypeOf([]interface{}(nil))
+)
+
+// canCopyJSONFast reports whether trees of map[string]interface{} and
+// []interface{} (e.g., as produced by encoding/json or as used by
+// "unstructured" Kubernetes objects) can be copied without reflection.
+// This is only possible if no options affect how such trees are copied,
+// including options for the interface{} type of their elements.
+func (c *Copier) canCopyJSONFast() bool {
+	if c.normalizeNumbers || len(c.substitutes) > 0 || len(c.rebinds) > 0 || len(c.middleware) > 0 || c.trackPaths {
+		return false
+	}
+	for _, t := range []reflect.Type{
+		jsonObjectType, jsonArrayType, jsonArrayType.Elem(),
+		reflect.TypeOf(""), reflect.TypeOf(float64(0)), reflect.TypeOf(int64(0)),
+		reflect.TypeOf(false), reflect.TypeOf(json.Number("")),
+	} {
+		// Any Func, matcher (e.g., KindFunc), or Transformer
+		// results in type information other than a plain one.
+		if ti := c.typeInfo(t); ti.fnc.IsValid() || ti.inner != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// copyJSON copies v, which is expected to be a tree of
+// map[string]interface{}, []interface{}, and JSON scalar values.
+// Values of any other type are copied using reflection.
+func (s *state) copyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		s.count(reflect.Interface)
+		return v
+	case string, float64, int64, bool, json.Number:
+		s.count(reflect.TypeOf(v).Kind())
+		return v
+	case map[string]interface{}:
+		s.enter(reflect.Map)
+		defer s.leave()
+		if v == nil {
+			return v
+		}
+		s.alloc(int64(len(v)) * int64(jsonObjectType.Key().Size()+jsonObjectType.Elem().Size()))
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = s.copyJSON(e)
+		}
+		return m
+	case []interface{}:
+		s.enter(reflect.Slice)
+		defer s.leave()
+		if cap(v) == 0 {
+			return v // see the reflect.Slice case in copyValue
+		}
+		s.alloc(int64(cap(v)) * int64(jsonArrayType.Elem().Size()))
+		a := make([]interface{}, len(v), cap(v))
+		for i, e := range v {
+			a[i] = s.copyJSON(e)
+		}
+		return a
+	default:
+		return s.copy(reflect.ValueOf(v)).Interface()
+	}
+}
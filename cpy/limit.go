@@ -0,0 +1,87 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrLimitExceeded is wrapped by the errors that Copier.Copy panics with
+// (or that Copier.CopyE returns) when a copy exceeds a limit
+// (see MaxDepth, MaxNodes, and MaxBytes).
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// MaxDepth specifies that a copy is aborted once it recurses more than
+// n levels deep, where the root value has a depth of one (see Stats).
+// Copier.Copy then panics with an error wrapping ErrLimitExceeded,
+// which Copier.CopyE returns instead. This guards against deeply nested
+// values that would otherwise overflow the stack.
+// If multiple MaxDepth options are provided, the latter takes precedence.
+// It panics if n is not positive.
+//
+// Example usage:
+//
+//	cpy.MaxDepth(1000)
+func MaxDepth(n int) Option {
+	if n <= 0 {
+		panic(fmt.Sprintf("cpy.MaxDepth: limit must be positive: %d", n))
+	}
+	return option{maxDepth: n}
+}
+
+// MaxNodes specifies that a copy is aborted once it visits more than
+// n values, which are counted as for Stats.Nodes.
+// Copier.Copy then panics with an error wrapping ErrLimitExceeded,
+// which Copier.CopyE returns instead. This protects against copying
+// unexpectedly large values (e.g., built from untrusted input).
+// If multiple MaxNodes options are provided, the latter takes precedence.
+// It panics if n is not positive.
+func MaxNodes(n int) Option {
+	if n <= 0 {
+		panic(fmt.Sprintf("cpy.MaxNodes: limit must be positive: %d", n))
+	}
+	return option{maxNodes: n}
+}
+
+// MaxBytes specifies that a copy is aborted before it allocates more than
+// n bytes of new storage, which is estimated as for Stats.Bytes.
+// Copier.Copy then panics with an error wrapping ErrLimitExceeded,
+// which Copier.CopyE returns instead. Storage allocated by functions
+// provided through options is not accounted for.
+// If multiple MaxBytes options are provided, the latter takes precedence.
+// It panics if n is not positive.
+//
+// Example usage:
+//
+//	cpy.MaxNodes(1e6), cpy.MaxBytes(64<<20)
+//
+// These options specify that copying values of more than a million
+// elements or of more than 64 MiB fails instead of exhausting resources.
+func MaxBytes(n int64) Option {
+	if n <= 0 {
+		panic(fmt.Sprintf("cpy.MaxBytes: limit must be positive: %d", n))
+	}
+	return option{maxBytes: n}
+}
+
+// alloc records an allocation of n bytes of new storage,
+// which must be called before allocating the storage.
+func (s *state) alloc(n int64) {
+	s.stats.Bytes += n
+	if s.maxBytes > 0 && s.stats.Bytes > s.maxBytes {
+		panic(s.limitError("cpy.MaxBytes", "byte", s.maxBytes))
+	}
+}
+
+// limitError returns an error for the limit of the option op on the
+// quantity what (e.g., "depth") being exceeded by the current value.
+func (s *state) limitError(op, what string, limit interface{}) *copyError {
+	msg := fmt.Sprintf("%v: %v limit of %v exceeded", op, what, limit)
+	if len(s.path) > 0 {
+		msg += fmt.Sprintf(" at %v", s.path)
+	}
+	return &copyError{msg: msg, err: ErrLimitExceeded}
+}
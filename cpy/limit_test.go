@@ -0,0 +1,69 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cpy/cpy"
+)
+
+type ListNode struct {
+	Value int
+	Next  *ListNode
+}
+
+func makeList(n int) *ListNode {
+	var head *ListNode
+	for i := n; i > 0; i-- {
+		head = &ListNode{Value: i, Next: head}
+	}
+	return head
+}
+
+func TestMaxDepth(t *testing.T) {
+	c := cpy.New(cpy.MaxDepth(10), cpy.IgnoreAllUnexported())
+	if _, err := c.CopyE(makeList(4)); err != nil {
+		t.Errorf("CopyE() error: %v", err)
+	}
+	_, err := c.CopyE(makeList(100))
+	if !errors.Is(err, cpy.ErrLimitExceeded) || !strings.Contains(err.Error(), "cpy.MaxDepth: depth limit of 10 exceeded") {
+		t.Errorf("CopyE() error = %v, want error wrapping ErrLimitExceeded", err)
+	}
+}
+
+func TestMaxNodesBytes(t *testing.T) {
+	list := makeList(50)
+	_, stats := cpy.New(cpy.IgnoreAllUnexported()).CopyWithStats(list)
+
+	tests := []struct {
+		opt     cpy.Option
+		wantErr string
+	}{
+		{opt: cpy.MaxNodes(stats.Nodes)},
+		{opt: cpy.MaxNodes(stats.Nodes - 1), wantErr: "cpy.MaxNodes: node limit of"},
+		{opt: cpy.MaxBytes(stats.Bytes)},
+		{opt: cpy.MaxBytes(stats.Bytes - 1), wantErr: "cpy.MaxBytes: byte limit of"},
+		{opt: cpy.MaxBytes(1 << 20)},
+	}
+	for _, tt := range tests {
+		_, err := cpy.New(tt.opt, cpy.IgnoreAllUnexported()).CopyE(list)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("CopyE() error: %v", err)
+		case tt.wantErr != "" && (!errors.Is(err, cpy.ErrLimitExceeded) || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("CopyE() error = %v, want %v error", err, tt.wantErr)
+		}
+	}
+
+	// Storage is not allocated beyond the limit.
+	big := make([]int, 1<<20)
+	_, err := cpy.New(cpy.MaxBytes(1<<10), cpy.IgnoreAllUnexported()).CopyE(big)
+	if !errors.Is(err, cpy.ErrLimitExceeded) {
+		t.Errorf("CopyE() error = %v, want ErrLimitExceeded", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Methods specifies that values of types with a copy method of one of
+// the provided names are copied by calling that method instead of
+// being traversed. A copy method takes no arguments and returns a copy of
+// its receiver, either as a value of the receiver type or, for a method
+// with a pointer receiver, as a pointer to such a value
+// (e.g., a generated "func (in *T) DeepCopy() *T").
+// If a type has copy methods of multiple names, the earlier name is used.
+// A copy method returning nil declines to copy the value,
+// in which case the value is copied according to the default behavior.
+// Copy methods are trusted to return a deep copy that shares
+// no mutable memory with the receiver.
+//
+// It follows the same precedence as KindFunc.
+//
+// Example usage:
+//
+//	cpy.Methods("DeepCopy", "Clone")
+//
+// This option specifies that every type with a DeepCopy or Clone method
+// (e.g., Kubernetes API types) is copied by calling that method.
+func Methods(names ...string) Option {
+	if len(names) == 0 {
+		panic("cpy.Methods: at least one method name must be provided")
+	}
+	return option{matchers: []matcher{{
+		name: fmt.Sprintf("cpy.Methods(%v)", strings.Join(names, ", ")),
+		cond: func(t reflect.Type) bool {
+			_, _, ok := copyMethod(t, names)
+			return ok
+		},
+		fn: func(c *Copier, v reflect.Value) reflect.Value {
+			name, addr, _ := copyMethod(v.Type(), names)
+			recv := v
+			if addr {
+				recv = makeAddr(v)
+			}
+			out := recv.MethodByName(name).Call(nil)[0]
+			if out.Type() == v.Type() {
+				return out
+			}
+			if out.IsNil() {
+				return reflect.Value{} // decline to copy
+			}
+			return out.Elem()
+		},
+		site: callerSite(),
+	}}}
+}
+
+// copyMethod returns the name of the first method of t among names
+// that returns a copy of a value of type t, and reports whether the method
+// must be called on a pointer to the value.
+func copyMethod(t reflect.Type, names []string) (name string, addr, ok bool) {
+	if t.Kind() == reflect.Interface {
+		return "", false, false
+	}
+	for _, name := range names {
+		if m, ok := t.MethodByName(name); ok && returnsCopy(m.Type, t) {
+			return name, false, true
+		}
+		if t.Kind() == reflect.Ptr {
+			continue
+		}
+		if m, ok := reflect.PtrTo(t).MethodByName(name); ok && returnsCopy(m.Type, t) {
+			return name, true, true
+		}
+	}
+	return "", false, false
+}
+
+// returnsCopy reports whether the method type mt (including its receiver)
+// takes no arguments and returns a value of type t or a pointer to it.
+func returnsCopy(mt, t reflect.Type) bool {
+	return mt.NumIn() == 1 && mt.NumOut() == 1 && (mt.Out(0) == t || mt.Out(0) == reflect.PtrTo(t))
+}
+
+// SelfCopier is implemented by types that control how their values
+// are copied, analogous to json.Marshaler. Library authors may implement it
+// to make their types safe to copy without every user providing a Func.
+//
+// CopySelf returns a copy of the receiver, which must be a value of the same
+// type as the receiver (e.g., a *T for a method with a pointer receiver,
+// which is also used to copy values of type T). The Copier performing the copy is provided
+// to deep copy the elements of the value. CopySelf may return nil to decline
+// to copy the value, in which case the value is copied according to the
+// default behavior.
+//
+// Values of types implementing SelfCopier (either directly or through
+// a pointer receiver) are copied by calling CopySelf, unless a Func, Shallow,
+// Forbid, KindFunc, FuncIf, or ShallowIf option applies to the type.
+//
+// Example usage:
+//
+//	func (r *Registry) CopySelf(c *cpy.Copier) interface{} {
+//		r.mu.Lock()
+//		defer r.mu.Unlock()
+//		return &Registry{entries: cpy.CloneWith(c, r.entries)}
+//	}
+type SelfCopier interface {
+	CopySelf(c *Copier) interface{}
+}
+
+var selfCopierType = reflect.TypeOf((*SelfCopier)(nil)).Elem()
+
+// selfCopierRule returns a rule that copies values of type t by calling
+// CopySelf, or nil if neither t nor *t implements SelfCopier.
+func selfCopierRule(t reflect.Type) *rule {
+	addr := false
+	switch {
+	case t.Kind() == reflect.Interface:
+		return nil
+	case t.Implements(selfCopierType):
+	case t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(selfCopierType):
+		addr = true
+	default:
+		return nil
+	}
+	ft := reflect.FuncOf([]reflect.Type{copierType, t}, []reflect.Type{t, boolType}, false) // func(*Copier, T) (T, bool)
+	fnc := reflect.MakeFunc(ft, func(in []reflect.Value) []reflect.Value {
+		recv := in[1]
+		if addr {
+			recv = makeAddr(recv)
+		}
+		out := recv.Interface().(SelfCopier).CopySelf(in[0].Interface().(*Copier))
+		if out == nil {
+			return []reflect.Value{reflect.Zero(t), reflect.ValueOf(false)}
+		}
+		v := reflect.ValueOf(out)
+		if addr && v.Type() == recv.Type() && !v.IsNil() {
+			v = v.Elem() // pointer receiver returned a *T for a T
+		}
+		if v.Type() != t {
+			panic(errorf("cpy.SelfCopier: CopySelf of %v returned %T", t, out))
+		}
+		return []reflect.Value{v, reflect.ValueOf(true)}
+	})
+	return &rule{fnc: fnc, typ: t, name: fmt.Sprintf("cpy.SelfCopier(%v)", t), strategy: Custom}
+}
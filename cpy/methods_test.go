@@ -0,0 +1,92 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/go-cpy/cpy"
+)
+
+// Pod has a generated deep copy method with a pointer receiver.
+type Pod struct {
+	Labels map[string]string
+	copies *int
+}
+
+func (in *Pod) DeepCopy() *Pod {
+	*in.copies++
+	out := &Pod{Labels: make(map[string]string), copies: in.copies}
+	for k, v := range in.Labels {
+		out.Labels[k] = v
+	}
+	return out
+}
+
+// Set has a copy method with a value receiver.
+type Set struct{ items []string }
+
+func (s Set) Clone() Set { return Set{items: append([]string(nil), s.items...)} }
+
+func TestMethods(t *testing.T) {
+	type Deployment struct {
+		Template Pod
+		Pods     []*Pod
+		Set      Set
+	}
+	var copies int
+	src := Deployment{
+		Template: Pod{Labels: map[string]string{"app": "web"}, copies: &copies},
+		Pods:     []*Pod{{Labels: map[string]string{"app": "db"}, copies: &copies}},
+		Set:      Set{items: []string{"a"}},
+	}
+	got := cpy.New(cpy.Methods("DeepCopy", "Clone"), cpy.IgnoreAllUnexported()).Copy(src).(Deployment)
+	if copies != 2 {
+		t.Errorf("DeepCopy called %d times, want 2", copies)
+	}
+	if got.Template.Labels["app"] != "web" || got.Pods[0].Labels["app"] != "db" || got.Pods[0] == src.Pods[0] {
+		t.Errorf("Copy() = %+v, want deep copy of %+v", got, src)
+	}
+	if len(got.Set.items) != 1 || &got.Set.items[0] == &src.Set.items[0] {
+		t.Errorf("Copy().Set = %v, want copy by Clone", got.Set)
+	}
+}
+
+// Registry controls its own copying by implementing cpy.SelfCopier.
+type Registry struct {
+	mu      sync.Mutex
+	Entries map[string]int
+	Copied  bool // whether the registry was copied by CopySelf
+}
+
+func (r *Registry) CopySelf(c *cpy.Copier) interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Registry{Entries: cpy.CloneWith(c, r.Entries), Copied: true}
+}
+
+func TestSelfCopier(t *testing.T) {
+	type Service struct {
+		Registry  Registry
+		Fallbacks []*Registry
+	}
+	src := &Service{
+		Registry:  Registry{Entries: map[string]int{"a": 1}},
+		Fallbacks: []*Registry{{Entries: map[string]int{"b": 2}}},
+	}
+	got := cpy.New(cpy.IgnoreAllUnexported()).Copy(src).(*Service)
+	if !got.Registry.Copied || !got.Fallbacks[0].Copied {
+		t.Errorf("Copy() did not call CopySelf")
+	}
+	if got.Registry.Entries["a"] != 1 || got.Fallbacks[0].Entries["b"] != 2 {
+		t.Errorf("Copy() = %+v, want copy of %+v", got, src)
+	}
+	got.Registry.Entries["a"] = 3
+	got.Fallbacks[0].Entries["b"] = 4
+	if src.Registry.Entries["a"] != 1 || src.Fallbacks[0].Entries["b"] != 2 {
+		t.Errorf("Copy() shares memory with the source")
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Action specifies how to proceed with a value that cannot be copied.
+type Action int
+
+const (
+	// Abort specifies that Copier.Copy panics with the error,
+	// which is the behavior without OnError.
+	Abort Action = iota
+
+	// SkipValue specifies that the value is not copied and the destination
+	// is left as is, which is the zero value unless copying into an existing
+	// destination with ReuseDestination.
+	SkipValue
+
+	// ZeroValue specifies that the value is not copied
+	// and the destination is set to the zero value.
+	ZeroValue
+
+	// ShareValue specifies that the value is shallow copied,
+	// such that the copy shares memory with the source.
+	ShareValue
+)
+
+func (a Action) String() string {
+	switch a {
+	case Abort:
+		return "Abort"
+	case SkipValue:
+		return "SkipValue"
+	case ZeroValue:
+		return "ZeroValue"
+	case ShareValue:
+		return "ShareValue"
+	default:
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+}
+
+// OnError specifies a function that is called for every non-zero value
+// that cannot be copied and decides how to proceed with that value.
+// Such values are unexported fields that may neither be ignored nor copied
+// (see IgnoreAllUnexported and AllowUnexportedPackages),
+// values of types forbidden by Forbid, and pointers that form a cycle
+// (see ErrCycle).
+// Errors reported by copy functions provided through Func are not passed
+// to fn and always abort the copy. If multiple OnError options are
+// provided, the latter option takes precedence.
+//
+// The function fn is called with an error describing the problem
+// and must be safe for concurrent use if the Copier is.
+// Since fn decides how unexported fields are handled,
+// IgnoreAllUnexported need not be specified alongside OnError.
+//
+// Example usage:
+//
+//	cpy.OnError(func(err error) cpy.Action {
+//		log.Printf("skipping value: %v", err)
+//		return cpy.SkipValue
+//	})
+//
+// This option specifies that values that cannot be copied are logged
+// and left as zero in the copy instead of causing a panic.
+func OnError(fn func(err error) Action) Option {
+	if fn == nil {
+		panic("cpy.OnError: function must not be nil")
+	}
+	return option{onError: fn}
+}
+
+// forbiddenError returns the error for a value of type t
+// forbidden by the Forbid option with the provided name and site.
+func forbiddenError(t reflect.Type, name, site string) *copyError {
+	return errorf("cpy: copying of %v is forbidden by %v at %v", t, name, site)
+}
+
+// OnUnexported specifies a function that decides how every unexported
+// field is copied that is not copied according to AllowUnexportedPackages
+// or CopyUnexported, where parent is the struct type declaring the field.
+// The decision takes precedence over IgnoreAllUnexported, IgnoreUnexported,
+// and OnError, where Abort causes Copier.Copy to panic
+// when encountering a non-zero value of the field.
+// The function fn is called at most once per field and
+// must be safe for concurrent use if the Copier is.
+// Since fn decides how unexported fields are handled,
+// IgnoreAllUnexported need not be specified alongside OnUnexported.
+//
+// Example usage:
+//
+//	cpy.OnUnexported(func(parent reflect.Type, field reflect.StructField) cpy.Action {
+//		switch {
+//		case strings.HasPrefix(parent.PkgPath(), "example.com/vendor/"):
+//			return cpy.ShareValue
+//		case field.Type == reflect.TypeOf(sync.Mutex{}):
+//			return cpy.ZeroValue
+//		default:
+//			return cpy.Abort
+//		}
+//	})
+//
+// This option specifies that unexported fields of vendored types are shared,
+// mutexes are reset, and all other unexported fields are reported.
+func OnUnexported(fn func(parent reflect.Type, field reflect.StructField) Action) Option {
+	if fn == nil {
+		panic("cpy.OnUnexported: function must not be nil")
+	}
+	return option{onUnexported: fn}
+}
+
+// handleError proceeds with copying src into dst, which cannot be copied
+// because of err, according to the action decided by the OnError function.
+func (s *state) handleError(err *copyError, dst, src reflect.Value) {
+	s.apply(s.onError(err), "cpy.OnError", err, dst, src)
+}
+
+// apply proceeds with copying src into dst, which cannot be copied
+// because of err, according to the action a decided by the option op.
+func (s *state) apply(a Action, op string, err *copyError, dst, src reflect.Value) {
+	switch a {
+	case Abort:
+		panic(err)
+	case SkipValue:
+	case ZeroValue:
+		dst.Set(reflect.Zero(dst.Type()))
+	case ShareValue:
+		dst.Set(src)
+	default:
+		panic(errorf("%v: invalid action %v for error: %v", op, a, err))
+	}
+}
+
+// handlesStruct reports whether struct t must be copied by
+// copyStructHandled, which is the case if it has fields with tags
+// controlling how they are copied or if it has unexported fields that are
+// neither ignored nor copied, but handled by OnError or OnUnexported.
+func (c *Copier) handlesStruct(t reflect.Type) bool {
+	if c.fieldTags(t) != nil {
+		return true
+	}
+	switch {
+	case c.onUnexported != nil:
+	case c.onError == nil || c.ignoresUnexported(t):
+		return false
+	}
+	return len(loadStructFields(t).unexported) > len(c.allowedFields(t))
+}
+
+// unexportedActions returns the actions decided by OnUnexported
+// for all fields of struct t, indexed by field.
+// Only unexported fields that are not copied have a decision.
+func (c *Copier) unexportedActions(t reflect.Type) []Action {
+	v, ok := c.unexportedActionsCache.Load(t)
+	if !ok {
+		v, _ = c.unexportedActionsCache.LoadOrStore(t, c.unexportedActionsSlow(t))
+	}
+	return v.([]Action)
+}
+func (c *Copier) unexportedActionsSlow(t reflect.Type) []Action {
+	actions := make([]Action, t.NumField())
+	allowed := c.allowedFields(t)
+	for _, i := range loadStructFields(t).unexported {
+		if len(allowed) > 0 && allowed[0] == i {
+			allowed = allowed[1:]
+			continue
+		}
+		actions[i] = c.onUnexported(t, t.Field(i))
+	}
+	return actions
+}
+
+// copyStructHandled copies the fields of the addressable struct src into
+// dst, where every field with a tag is copied according to the tag and
+// every non-zero unexported field that may neither be ignored nor copied
+// is handled according to the OnUnexported or OnError function.
+// If reuse is set, the storage of dst is reused (see ReuseDestination).
+func (s *state) copyStructHandled(dst, src reflect.Value, reuse bool) {
+	t := src.Type()
+	tags := s.fieldTags(t)
+	copyField := func(i int, df, sf reflect.Value) {
+		if s.trackPaths {
+			f := t.Field(i)
+			s.push(PathStep{Type: f.Type, Field: f.Name, Index: -1})
+			defer s.pop()
+		}
+		switch {
+		case tags != nil && s.copyTagged(df, sf, tags[i]):
+		case reuse:
+			s.copyReuse(df, sf)
+		default:
+			s.copyTo(df, sf)
+		}
+		if tags != nil && tags[i].pathEnd && len(s.fieldFuncs) > 0 {
+			s.applyFieldFunc(df, tags[i])
+		}
+	}
+	fs, allowed := loadStructFields(t), s.allowedFields(t)
+	for _, i := range fs.exported {
+		copyField(i, dst.Field(i), src.Field(i))
+	}
+	for _, i := range fs.unexported {
+		df, sf := readable(dst.Field(i)), readable(src.Field(i)) // settable since dst is addressable
+		switch {
+		case len(allowed) > 0 && allowed[0] == i:
+			allowed = allowed[1:]
+			copyField(i, df, sf)
+		case sf.IsZero():
+			df.Set(sf)
+		case s.onUnexported != nil:
+			s.apply(s.unexportedActions(t)[i], "cpy.OnUnexported", unexportedFieldError(t, i), df, sf)
+		case s.ignoresUnexported(t):
+			df.Set(reflect.Zero(df.Type()))
+		case s.onError != nil:
+			s.handleError(unexportedFieldError(t, i), df, sf)
+		default:
+			panic(unexportedFieldError(t, i))
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy_test
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cpy/cpy"
+)
+
+type Account struct {
+	Name   string
+	secret *string
+	Card   *Card
+}
+
+func TestOnError(t *testing.T) {
+	secret, oldSecret := "hunter2", "old"
+	src := &Account{Name: "gopher", secret: &secret, Card: &Card{Number: "1234"}}
+	var errs []string
+	onError := func(a cpy.Action) cpy.Option {
+		return cpy.OnError(func(err error) cpy.Action {
+			errs = append(errs, err.Error())
+			return a
+		})
+	}
+
+	got := cpy.New(onError(cpy.SkipValue)).Copy(src).(*Account)
+	if got.Name != "gopher" || got.secret != nil || got.Card == src.Card || got.Card.Number != "1234" {
+		t.Errorf("Copy() with SkipValue = %+v, want copy without secret", got)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0], "unable to copy unexported field") || !strings.Contains(errs[0], ".secret") {
+		t.Errorf("OnError() errors = %q, want unexported field error", errs)
+	}
+
+	got = cpy.New(onError(cpy.ShareValue)).Copy(src).(*Account)
+	if got.secret != src.secret || got.Card == src.Card {
+		t.Errorf("Copy() with ShareValue = %+v, want copy with shared secret", got)
+	}
+
+	if _, err := cpy.New(onError(cpy.Abort)).CopyE(src); err == nil || !strings.Contains(err.Error(), ".secret") {
+		t.Errorf("CopyE() with Abort error = %v, want unexported field error", err)
+	}
+
+	got = cpy.New(onError(cpy.ZeroValue), cpy.Forbid(&Card{})).Copy(src).(*Account)
+	if got.Card != nil || got.secret != nil || got.Name != "gopher" {
+		t.Errorf("Copy() with ZeroValue = %+v, want copy without card and secret", got)
+	}
+	if all := strings.Join(errs, "\n"); !strings.Contains(all, "forbidden by cpy.Forbid(*cpy_test.Card)") {
+		t.Errorf("OnError() errors = %q, want forbidden error", errs)
+	}
+
+	for _, tt := range []struct {
+		action cpy.Action
+		want   *string
+	}{
+		{cpy.SkipValue, &oldSecret},
+		{cpy.ZeroValue, nil},
+	} {
+		dst := Account{secret: &oldSecret}
+		if err := cpy.New(onError(tt.action), cpy.ReuseDestination()).CopyInto(&dst, src); err != nil {
+			t.Fatalf("CopyInto() error: %v", err)
+		}
+		if dst.secret != tt.want || dst.Name != "gopher" {
+			t.Errorf("CopyInto() with %v and ReuseDestination = %+v, want secret %v", tt.action, dst, tt.want)
+		}
+	}
+}
+
+func TestOnUnexported(t *testing.T) {
+	type Conn struct {
+		Addr  string
+		mu    sync.Mutex
+		token *string
+		pool  *[]int
+	}
+	token := "secret"
+	src := &Conn{Addr: "localhost", token: &token, pool: &[]int{1}}
+	var calls int
+	copier := cpy.New(cpy.OnUnexported(func(parent reflect.Type, f reflect.StructField) cpy.Action {
+		calls++
+		switch f.Name {
+		case "mu":
+			return cpy.ZeroValue
+		case "token":
+			return cpy.ShareValue
+		default:
+			return cpy.Abort
+		}
+	}))
+
+	src.mu.Lock()
+	if _, err := copier.CopyE(src); err == nil || !strings.Contains(err.Error(), "Conn.pool") {
+		t.Errorf("CopyE() error = %v, want unexported field error for pool", err)
+	}
+	src.pool = nil
+	got := copier.Copy(src).(*Conn)
+	if got.Addr != "localhost" || got.token != src.token || !got.mu.TryLock() {
+		t.Errorf("Copy() = %+v, want copy with shared token and unlocked mutex", got)
+	}
+	if calls != 3 {
+		t.Errorf("OnUnexported called %d times, want 3", calls)
+	}
+
+	plan := copier.Plan(reflect.TypeOf(Conn{})).String()
+	for _, want := range []string{".mu sync.Mutex: ignore by cpy.OnUnexported", ".token *string: share by cpy.OnUnexported", ".pool *[]int: fail"} {
+		if !strings.Contains(plan, want) {
+			t.Errorf("Plan() = %v, want line %q", plan, want)
+		}
+	}
+}
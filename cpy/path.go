@@ -0,0 +1,354 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Path is the sequence of steps from the root value to a value being copied.
+// It is passed to copy functions that accept a Path (see Func).
+//
+// Values held in interfaces are reached without a step,
+// and map keys are copied with the path of the map itself.
+// Values yielded by a materialized iterator are copied with
+// the path of the iterator.
+type Path []PathStep
+
+// PathStep is a step from a value to an element of it.
+type PathStep struct {
+	// Type is the type of the element.
+	Type reflect.Type
+
+	// Field is the name of the struct field for a step to a field.
+	// It is empty otherwise.
+	Field string
+
+	// Index is the index of the element for a step to an element
+	// of an array or slice. It is -1 otherwise.
+	Index int
+
+	// Key is the map key for a step to a map value.
+	// It is invalid otherwise.
+	Key reflect.Value
+}
+
+// String renders the step as ".Name" for a struct field, "[3]" for an
+// array or slice element, "[key]" for a map value, or "*" for the value
+// a pointer points to.
+func (ps PathStep) String() string {
+	switch {
+	case ps.Field != "":
+		return "." + ps.Field
+	case ps.Index >= 0:
+		return fmt.Sprintf("[%d]", ps.Index)
+	case ps.Key.IsValid():
+		return fmt.Sprintf("[%#v]", readable(ps.Key).Interface())
+	default:
+		return "*"
+	}
+}
+
+// String renders the path as the concatenation of all steps
+// (e.g., ".Config.Secrets[\"db\"]").
+func (p Path) String() string {
+	var sb strings.Builder
+	for _, ps := range p {
+		sb.WriteString(ps.String())
+	}
+	return sb.String()
+}
+
+// push records a step to an element of the current value.
+// It must only be called if paths are tracked.
+func (s *state) push(ps PathStep) {
+	s.path = append(s.path, ps)
+}
+
+// pop removes the step most recently recorded by push.
+func (s *state) pop() {
+	s.path = s.path[:len(s.path)-1]
+}
+
+// SkipPaths specifies that the fields at the provided paths are skipped
+// and left as zero in the copy. A path consists of the name of a named
+// struct type followed by the names of fields, all separated by dots
+// (e.g., "Request.Header.Cookies"), and denotes the last field reached from
+// every value of that type by following the fields in order.
+// Pointers to structs are followed implicitly.
+// The type name is not qualified by the package name.
+// It panics if a path has fewer than two names.
+//
+// SkipPaths takes precedence over all other options and struct tags
+// for the skipped fields. Tracking paths slows down every copy made by
+// the Copier.
+//
+// Example usage:
+//
+//	cpy.SkipPaths("Request.Cache", "Request.Options.OnDone")
+//
+// This option specifies that the cache and the completion callback of
+// every Request are not carried over into the copy.
+func SkipPaths(paths ...string) Option {
+	return option{skipPaths: parseFieldPaths("cpy.SkipPaths", paths)}
+}
+
+// OnlyPaths specifies that only the fields at the provided paths
+// are copied from values of the types at the start of the paths,
+// while all other fields of such values are left as zero in the copy.
+// Paths are of the same form as for SkipPaths. The last field of a path
+// is copied according to the other options, while every field before
+// it is copied by only copying the next field of the path
+// (e.g., "Request.Header.Cookies" copies only the Cookies of the Header
+// of every Request). Values of other types are copied as usual
+// unless they are reached through one of the provided paths.
+// SkipPaths takes precedence over OnlyPaths.
+//
+// Example usage:
+//
+//	cpy.OnlyPaths("Account.ID", "Account.Audit")
+//
+// This option specifies that copies of every Account only contain
+// its identifier and audit log, which is cheaper than copying the
+// entire account and requires no separate type for the projection.
+func OnlyPaths(paths ...string) Option {
+	return option{onlyPaths: parseFieldPaths("cpy.OnlyPaths", paths)}
+}
+
+// FieldFunc specifies that the copy of the field at the provided path
+// (of the same form as for SkipPaths) is rewritten by the function fn,
+// which must be a function "func(T) T", where T is the type of the field.
+// The function is called with the copy of the field after it has been
+// copied according to the other options, including for zero values,
+// and its result is stored in the copy instead. Its result must not share
+// memory with the source unless the field may be shared.
+// It is never called for fields skipped by SkipPaths or OnlyPaths
+// or redacted by RedactTag.
+// If multiple FieldFunc options apply to the same field,
+// the latter takes precedence.
+//
+// Example usage:
+//
+//	cpy.FieldFunc("User.Email", func(s string) string {
+//		if i := strings.IndexByte(s, '@'); i > 0 {
+//			return s[:1] + "***" + s[i:]
+//		}
+//		return s
+//	})
+//
+// This option specifies that the email address of every User is masked
+// without providing a Func that copies every other field of the User.
+func FieldFunc(path string, fn interface{}) Option {
+	v := reflect.ValueOf(fn)
+	if !v.IsValid() || v.Kind() != reflect.Func || v.Type().NumIn() != 1 || v.Type().NumOut() != 1 ||
+		v.Type().In(0) != v.Type().Out(0) || v.Type().IsVariadic() || v.IsNil() {
+		panic(fmt.Sprintf("cpy.FieldFunc: function %T must be a func(T) T", fn))
+	}
+	p := parseFieldPaths("cpy.FieldFunc", []string{path})[0]
+	return option{fieldFuncs: []fieldFunc{{path: p, fn: v, site: callerSite()}}}
+}
+
+// fieldFunc is a function provided to FieldFunc.
+type fieldFunc struct {
+	path fieldPath
+	fn   reflect.Value // func(T) T
+	site string
+}
+
+// applyFieldFunc rewrites the copy dst of the current field with the tag
+// according to the FieldFunc options. Paths must be tracked.
+func (s *state) applyFieldFunc(dst reflect.Value, tag fieldTag) {
+	if tag.mode == tagRedact || s.atPath(s.skipPaths) || (tag.onlyPath && s.excluded()) {
+		return
+	}
+	for _, ff := range s.fieldFuncs {
+		if !s.path.endsWith(ff.path, s.root) {
+			continue
+		}
+		if ft := ff.fn.Type(); ft.In(0) != dst.Type() {
+			panic(errorf("cpy.FieldFunc: function %v at %v cannot rewrite field %v of type %v", ft, ff.site, s.path, dst.Type()))
+		}
+		dst.Set(ff.fn.Call([]reflect.Value{dst})[0])
+		return
+	}
+}
+
+// fieldPath is a parsed path provided to SkipPaths, OnlyPaths, or FieldFunc.
+type fieldPath struct {
+	typ    string   // name of the struct type at the start of the path
+	fields []string // names of the fields following from typ
+}
+
+func (p fieldPath) String() string {
+	return p.typ + "." + strings.Join(p.fields, ".")
+}
+
+// parseFieldPaths parses the provided paths for the option op.
+func parseFieldPaths(op string, paths []string) []fieldPath {
+	var fps []fieldPath
+	for _, path := range paths {
+		names := strings.Split(path, ".")
+		if len(names) < 2 {
+			panic(fmt.Sprintf("%v: invalid path %q; want a type name followed by field names", op, path))
+		}
+		for _, name := range names {
+			if name == "" || strings.ContainsAny(name, " *[]") {
+				panic(fmt.Sprintf("%v: invalid path %q; want a type name followed by field names", op, path))
+			}
+		}
+		fps = append(fps, fieldPath{typ: names[0], fields: names[1:]})
+	}
+	return fps
+}
+
+// atPath reports whether the current value is the last field of one of
+// the provided paths. Paths must be tracked.
+func (s *state) atPath(paths []fieldPath) bool {
+	for _, p := range paths {
+		if s.path.endsWith(p, s.root) {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether the current value is a field of a value at
+// the start or in the middle of a path provided to OnlyPaths,
+// but not the next field of any such path. Paths must be tracked.
+func (s *state) excluded() bool {
+	field := s.path[len(s.path)-1].Field
+	parent := s.path[:len(s.path)-1]
+	for len(parent) > 0 && parent[len(parent)-1].isIndirect() {
+		parent = parent[:len(parent)-1]
+	}
+	var inside bool
+	for _, p := range s.onlyPaths {
+		for m := range p.fields {
+			if parent.endsWith(fieldPath{typ: p.typ, fields: p.fields[:m]}, s.root) {
+				if p.fields[m] == field {
+					return false
+				}
+				inside = true
+			}
+		}
+	}
+	return inside
+}
+
+// endsWith reports whether the path starting at a value of type root
+// ends with the fields of fp starting at a value of type fp.typ,
+// where steps to the values that pointers point to are ignored.
+func (p Path) endsWith(fp fieldPath, root reflect.Type) bool {
+	j := len(p) - 1
+	for k := len(fp.fields) - 1; k >= 0; k-- {
+		for j >= 0 && p[j].isIndirect() && k < len(fp.fields)-1 {
+			j--
+		}
+		if j < 0 || p[j].Field != fp.fields[k] {
+			return false
+		}
+		j--
+	}
+	t := root
+	if j >= 0 {
+		t = p[j].Type
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name() == fp.typ
+}
+
+// isIndirect reports whether ps is a step to the value a pointer points to.
+func (ps PathStep) isIndirect() bool {
+	return ps.Field == "" && ps.Index < 0 && !ps.Key.IsValid()
+}
+
+// FilterPath specifies that the option opt only applies to values
+// whose path from the root value satisfies the filter f
+// (e.g., only to values beneath a specific field), where the path
+// is passed as in a copy function that accepts a Path (see Func).
+// The option must only consist of options providing copy functions
+// (e.g., Func, Shallow, Forbid, ZeroTypes, KindFunc, or ShallowIf);
+// otherwise it will panic.
+//
+// Options wrapped by FilterPath take precedence over all other
+// options for values at a matching path, regardless of Priority.
+// Among options wrapped by FilterPath, the latter option takes precedence.
+// Tracking paths slows down every copy made by the Copier.
+//
+// Example usage:
+//
+//	cpy.FilterPath(func(p cpy.Path) bool {
+//		return len(p) > 0 && p[0].Field == "Cache"
+//	}, cpy.ShallowIf(func(reflect.Type) bool { return true }))
+//
+// This option specifies that everything within the Cache field
+// of the root value is shallow copied, while all other values
+// are deep copied as usual.
+func FilterPath(f func(Path) bool, opt Option) Option {
+	if f == nil {
+		panic("cpy.FilterPath: filter must not be nil")
+	}
+	return mapOptions(opt, func(opt option) option {
+		if !opt.onlyRules() {
+			panic("cpy.FilterPath: option must only consist of options providing copy functions")
+		}
+		rules := make([]rule, len(opt.rules))
+		for i, r := range opt.rules {
+			r.paths = append(r.paths[:len(r.paths):len(r.paths)], f)
+			rules[i] = r
+		}
+		matchers := make([]matcher, len(opt.matchers))
+		for i, m := range opt.matchers {
+			m.paths = append(m.paths[:len(m.paths):len(m.paths)], f)
+			matchers[i] = m
+		}
+		opt.rules, opt.matchers = rules, matchers
+		return opt
+	})
+}
+
+// filteredTypeInfoSlow returns the type information for every rule
+// wrapped by FilterPath that applies to values of type vt.
+func (c *Copier) filteredTypeInfoSlow(vt reflect.Type) []*typeInfo {
+	var tis []*typeInfo
+	for i := range c.pathRules {
+		if r := &c.pathRules[i]; r.matches(vt) {
+			tis = append(tis, &typeInfo{fnc: r.fnc, rule: r})
+		}
+	}
+	for _, m := range c.pathMatchers {
+		if m.cond(vt) {
+			r := m.ruleFor(vt)
+			r.paths = m.paths
+			tis = append(tis, &typeInfo{fnc: r.fnc, rule: r})
+		}
+	}
+	return tis
+}
+
+// matches reports whether r applies to values of type vt
+// according to the same criteria as for unfiltered rules.
+func (r *rule) matches(vt reflect.Type) bool {
+	if !r.applies(vt) {
+		return false
+	}
+	for _, t := range []reflect.Type{vt, reflect.PtrTo(vt)} {
+		switch {
+		case r.typ.Kind() == reflect.Interface:
+			if strictImplements(t, r.typ) {
+				return true
+			}
+		case t == r.typ || (r.structural && sameUnderlying(t, r.typ)):
+			if t == vt || !r.inPlace {
+				return true
+			}
+		}
+	}
+	return false
+}
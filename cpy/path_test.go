@@ -0,0 +1,259 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cpy/cpy"
+)
+
+type Secrets struct{ Keys []string }
+
+func TestPath(t *testing.T) {
+	type Root struct {
+		Config struct{ Secrets *Secrets }
+		Cache  map[string]*Secrets
+		List   []interface{}
+	}
+	src := &Root{Cache: map[string]*Secrets{"db": {Keys: []string{"b"}}}, List: []interface{}{&Secrets{Keys: []string{"c"}}}}
+	src.Config.Secrets = &Secrets{Keys: []string{"a"}}
+
+	for _, unsafe := range []bool{false, true} {
+		var paths []string
+		opts := []cpy.Option{
+			cpy.Func(func(p cpy.Path, s *Secrets) (*Secrets, bool) {
+				paths = append(paths, p.String())
+				return s, p[1].Field == "Cache" // only share cached secrets
+			}),
+			cpy.IgnoreAllUnexported(),
+		}
+		if unsafe {
+			opts = append(opts, cpy.UnsafeFieldAccess())
+		}
+		dst := cpy.New(opts...).Copy(src).(*Root)
+
+		// The function also applies to the Secrets value that a declined
+		// *Secrets points to, such that it is called a second time.
+		want := []string{`*.Config.Secrets`, `*.Config.Secrets*`, `*.Cache["db"]`, `*.List[0]`, `*.List[0]*`}
+		if diff := cmp.Diff(want, paths); diff != "" {
+			t.Errorf("paths mismatch (-want +got):\n%s", diff)
+		}
+		if dst.Config.Secrets == src.Config.Secrets || dst.List[0] == src.List[0] {
+			t.Errorf("Config.Secrets or List[0] shared, want deep copied")
+		}
+		if dst.Cache["db"] != src.Cache["db"] {
+			t.Errorf("Cache[\"db\"] deep copied, want shared")
+		}
+	}
+}
+
+type (
+	Request struct {
+		URL     string
+		Cache   map[string]string
+		Options *RequestOptions
+		Retry   []Request
+	}
+	RequestOptions struct {
+		Timeout int
+		OnDone  func()
+	}
+)
+
+func TestSkipPaths(t *testing.T) {
+	src := &Request{
+		URL:     "/a",
+		Cache:   map[string]string{"k": "v"},
+		Options: &RequestOptions{Timeout: 5, OnDone: func() {}},
+		Retry:   []Request{{URL: "/b", Cache: map[string]string{"k": "v"}}},
+	}
+	for _, unsafe := range []bool{false, true} {
+		opts := []cpy.Option{cpy.SkipPaths("Request.Cache", "Request.Options.OnDone"), cpy.IgnoreAllUnexported()}
+		if unsafe {
+			opts = append(opts, cpy.UnsafeFieldAccess())
+		}
+		got := cpy.New(opts...).Copy(src).(*Request)
+		want := &Request{URL: "/a", Options: &RequestOptions{Timeout: 5}, Retry: []Request{{URL: "/b"}}}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	// Fields of the same name are only skipped at the provided paths.
+	type Other struct{ Cache map[string]string }
+	got := cpy.New(cpy.SkipPaths("Request.Cache"), cpy.IgnoreAllUnexported()).Copy(Other{Cache: map[string]string{"k": "v"}}).(Other)
+	if got.Cache == nil {
+		t.Errorf("Copy() skipped Other.Cache, want copied")
+	}
+
+	for _, path := range []string{"Request", "Request..Cache", ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("SkipPaths(%q) did not panic", path)
+				}
+			}()
+			cpy.SkipPaths(path)
+		}()
+	}
+}
+
+func TestOnlyPaths(t *testing.T) {
+	src := []*Request{{
+		URL:     "/a",
+		Cache:   map[string]string{"k": "v"},
+		Options: &RequestOptions{Timeout: 5, OnDone: func() {}},
+		Retry:   []Request{{URL: "/b", Cache: map[string]string{"k": "v"}}},
+	}}
+	got := cpy.New(cpy.OnlyPaths("Request.URL", "Request.Options.Timeout", "Request.Retry"), cpy.IgnoreAllUnexported()).Copy(src).([]*Request)
+	want := []*Request{{
+		URL:     "/a",
+		Options: &RequestOptions{Timeout: 5},
+		Retry:   []Request{{URL: "/b"}},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+	}
+
+	got = cpy.New(cpy.OnlyPaths("Request.URL", "Request.Cache"), cpy.SkipPaths("Request.Cache"), cpy.IgnoreAllUnexported()).Copy(src).([]*Request)
+	want = []*Request{{URL: "/a"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Copy() with SkipPaths mismatch (-want +got):\n%s", diff)
+	}
+
+	// Values of other types are copied as usual.
+	opts := &RequestOptions{Timeout: 5}
+	if got := cpy.New(cpy.OnlyPaths("Request.Options.Timeout"), cpy.IgnoreAllUnexported()).Copy(opts); !cmp.Equal(got, opts) {
+		t.Errorf("Copy() = %+v, want %+v", got, opts)
+	}
+}
+
+func TestFieldFunc(t *testing.T) {
+	type User struct {
+		Name  string
+		Email string
+		Tags  []string
+	}
+	mask := func(s string) string {
+		if i := strings.IndexByte(s, '@'); i > 0 {
+			return s[:1] + "***" + s[i:]
+		}
+		return s
+	}
+	src := []User{{Name: "gopher", Email: "gopher@example.com", Tags: []string{"a"}}, {Name: "nobody"}}
+	got := cpy.New(cpy.FieldFunc("User.Email", mask), cpy.FieldFunc("User.Tags", func(tags []string) []string {
+		return append(tags, "copied")
+	}), cpy.IgnoreAllUnexported()).Copy(src).([]User)
+	want := []User{
+		{Name: "gopher", Email: "g***@example.com", Tags: []string{"a", "copied"}},
+		{Name: "nobody", Tags: []string{"copied"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+	}
+	if len(src[0].Tags) != 1 {
+		t.Errorf("FieldFunc mutated source: %v", src[0].Tags)
+	}
+
+	got = cpy.New(cpy.FieldFunc("User.Email", mask), cpy.SkipPaths("User.Email"), cpy.IgnoreAllUnexported()).Copy(src).([]User)
+	if got[0].Email != "" {
+		t.Errorf("Copy() applied FieldFunc to skipped field: %q", got[0].Email)
+	}
+
+	_, err := cpy.New(cpy.FieldFunc("User.Name", func(int) int { return 0 }), cpy.IgnoreAllUnexported()).CopyE(src)
+	if err == nil || !strings.Contains(err.Error(), "cannot rewrite field") {
+		t.Errorf("CopyE() error = %v, want mismatched type error", err)
+	}
+}
+
+func TestFilterPath(t *testing.T) {
+	type Store struct {
+		Cache map[string]*Secrets
+		Data  map[string]*Secrets
+	}
+	src := &Store{
+		Cache: map[string]*Secrets{"a": {Keys: []string{"a"}}},
+		Data:  map[string]*Secrets{"b": {Keys: []string{"b"}}},
+	}
+	inCache := func(p cpy.Path) bool {
+		for _, ps := range p {
+			if ps.Field == "Cache" {
+				return true
+			}
+		}
+		return false
+	}
+	c := cpy.New(
+		cpy.FilterPath(inCache, cpy.ShallowIf(func(reflect.Type) bool { return true })),
+		cpy.IgnoreAllUnexported(),
+	)
+	got := c.Copy(src).(*Store)
+	if diff := cmp.Diff(src, got); diff != "" {
+		t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+	}
+	if reflect.ValueOf(got.Cache).Pointer() != reflect.ValueOf(src.Cache).Pointer() {
+		t.Errorf("Copy() deep copied Cache, want shared")
+	}
+	if got.Data["b"] == src.Data["b"] {
+		t.Errorf("Copy() shared Data, want deep copied")
+	}
+
+	// Filtered options take precedence over unfiltered options.
+	c = cpy.New(
+		cpy.FilterPath(inCache, cpy.Func(func(s *Secrets) *Secrets { return &Secrets{Keys: []string{"filtered"}} })),
+		cpy.Shallow(&Secrets{}),
+		cpy.IgnoreAllUnexported(),
+	)
+	got = c.Copy(src).(*Store)
+	if got.Cache["a"].Keys[0] != "filtered" || got.Data["b"] != src.Data["b"] {
+		t.Errorf("Copy() = %+v, want filtered Func for Cache and Shallow for Data", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("FilterPath(IgnoreAllUnexported) did not panic")
+		}
+	}()
+	cpy.FilterPath(inCache, cpy.IgnoreAllUnexported())
+}
+
+func TestFilteredOptions(t *testing.T) {
+	all := func(reflect.Type) bool { return true }
+	mustPanic := func(name string, f func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%v did not panic", name)
+			}
+		}()
+		f()
+	}
+	for i, opt := range []cpy.Option{
+		cpy.IgnoreAllUnexported(),
+		cpy.Immutable(time.Time{}),
+		cpy.Middleware(func(next cpy.CopyFn) cpy.CopyFn { return next }),
+		cpy.TagName("clone"),
+		cpy.Transformer(strings.ToUpper),
+		cpy.Placeholders("[REDACTED]"),
+		cpy.MaxNodes(1),
+		cpy.PreserveAliasing(),
+		cpy.Options{cpy.Shallow(time.Time{}), cpy.ReuseDestination()},
+	} {
+		mustPanic(fmt.Sprintf("If(option %d)", i), func() { cpy.If(all, opt) })
+		mustPanic(fmt.Sprintf("FilterPath(option %d)", i), func() { cpy.FilterPath(func(cpy.Path) bool { return true }, opt) })
+	}
+
+	shareMaps := cpy.KindFunc(reflect.Map, func(c *cpy.Copier, v reflect.Value) reflect.Value { return v })
+	rules := cpy.Options{cpy.Priority(2, cpy.Shallow(time.Time{})), cpy.Structural(cpy.Func(func(s *Secrets) *Secrets { return s })), cpy.Forbid(map[int]int{})}
+	cpy.If(all, rules)
+	cpy.FilterPath(func(cpy.Path) bool { return true }, cpy.Options{rules, shareMaps})
+	mustPanic("If(KindFunc)", func() { cpy.If(all, shareMaps) })
+}
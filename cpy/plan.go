@@ -0,0 +1,387 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Strategy is the way in which a Copier copies values of a type.
+type Strategy int
+
+const (
+	// Share specifies that values are shallow copied as a whole.
+	// This is used for types that need no deep copy (e.g., int or
+	// a struct of only strings), immutable types, and types matching Shallow.
+	Share Strategy = iota
+
+	// Deep specifies that values are copied by allocating new storage and
+	// recursively copying every element according to its own plan.
+	Deep
+
+	// Custom specifies that values are copied by calling a copy function
+	// provided by Func.
+	Custom
+
+	// Dynamic specifies that values are interfaces, which are copied
+	// according to the plan for the dynamic type of the value.
+	Dynamic
+
+	// Ignore specifies that values are not copied and left as zero
+	// (e.g., unexported fields or iterators dropped by DropIterators).
+	Ignore
+
+	// Fail specifies that Copier.Copy panics when copying non-zero values
+	// (e.g., because of Forbid or an unexported field that may not be ignored).
+	Fail
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case Share:
+		return "share"
+	case Deep:
+		return "deep"
+	case Custom:
+		return "custom"
+	case Dynamic:
+		return "dynamic"
+	case Ignore:
+		return "ignore"
+	case Fail:
+		return "fail"
+	default:
+		return fmt.Sprintf("Strategy(%d)", int(s))
+	}
+}
+
+// Plan describes how a Copier copies values of a type.
+// A Plan is the root of a tree, where every child describes how
+// an element of the parent value (e.g., a struct field) is copied.
+//
+// A Plan only describes the static structure of a type.
+// For example, it does not describe values held in interfaces
+// or note that zero values are always left as is.
+type Plan struct {
+	// Step is the step from the parent value to this value, which is either
+	// ".Name" for a struct field, "*" for the value a pointer points to,
+	// "[]" for elements of an array or slice, "{key}" for keys of a map,
+	// "{value}" for values of a map, or empty for the root.
+	// The values yielded by a materialized iterator use the same steps
+	// as the elements of a slice or a map.
+	Step string
+
+	// Type is the type of the value.
+	Type reflect.Type
+
+	// Strategy is how the value is copied.
+	Strategy Strategy
+
+	// Option describes the option that determined the strategy
+	// and where it was created (e.g., "cpy.Shallow(time.Time) at main.go:12").
+	// It is empty if the strategy is the default for the type.
+	Option string
+
+	// Recursive reports whether the plan for Type is already described by
+	// an ancestor, in which case Children is empty.
+	Recursive bool
+
+	// Children are the plans for the elements of a value copied with Deep.
+	Children []*Plan
+}
+
+// Plan returns a description of how values of type t are copied.
+// It does not panic for types that Copy would panic on,
+// but reports the affected values with the Fail strategy.
+func (c *Copier) Plan(t reflect.Type) *Plan {
+	return c.plan("", t, make(map[reflect.Type]bool))
+}
+func (c *Copier) plan(step string, t reflect.Type, visiting map[reflect.Type]bool) *Plan {
+	h := c.HandlerFor(t)
+	return c.planElems(&Plan{Step: step, Type: t, Strategy: h.Strategy, Option: h.Option}, visiting)
+}
+
+// planElems populates the children of p if it is copied with Deep.
+func (c *Copier) planElems(p *Plan, visiting map[reflect.Type]bool) *Plan {
+	t := p.Type
+	switch {
+	case p.Strategy != Deep:
+		return p
+	case visiting[t]:
+		p.Recursive = true
+		return p
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		p.Children = []*Plan{c.plan("*", t.Elem(), visiting)}
+	case reflect.Array, reflect.Slice:
+		p.Children = []*Plan{c.plan("[]", t.Elem(), visiting)}
+	case reflect.Map:
+		p.Children = []*Plan{c.plan("{key}", t.Key(), visiting), c.plan("{value}", t.Elem(), visiting)}
+	case reflect.Func: // see MaterializeIterators
+		if yt := t.In(0); yt.NumIn() == 1 {
+			p.Children = []*Plan{c.plan("[]", yt.In(0), visiting)}
+		} else {
+			p.Children = []*Plan{c.plan("{key}", yt.In(0), visiting), c.plan("{value}", yt.In(1), visiting)}
+		}
+	case reflect.Struct:
+		allowed := make(map[int]bool)
+		for _, i := range c.allowedFields(t) {
+			allowed[i] = true
+		}
+		tags := c.fieldTags(t)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			var tag fieldTag
+			if tags != nil && (f.PkgPath == "" || allowed[i]) {
+				tag = tags[i]
+			}
+			switch {
+			case tag.mode == tagSkip:
+				p.Children = append(p.Children, &Plan{Step: "." + f.Name, Type: f.Type, Strategy: Ignore, Option: `cpy:"-"`})
+			case tag.mode == tagRedact:
+				p.Children = append(p.Children, &Plan{Step: "." + f.Name, Type: f.Type, Strategy: Ignore, Option: "cpy.RedactTag"})
+			case tag.mode == tagShallow:
+				p.Children = append(p.Children, &Plan{Step: "." + f.Name, Type: f.Type, Strategy: Share, Option: `cpy:"shallow"`})
+			case tag.mode == tagDeep:
+				child := &Plan{Step: "." + f.Name, Type: f.Type, Strategy: c.defaultStrategy(f.Type, tag.deep.plain), Option: `cpy:"deep"`}
+				if tag.deepElem != nil {
+					et := f.Type.Elem()
+					elem := &Plan{Step: "*", Type: et, Strategy: c.defaultStrategy(et, tag.deepElem.plain), Option: `cpy:"deep"`}
+					child.Children = []*Plan{c.planElems(elem, visiting)}
+				} else {
+					child = c.planElems(child, visiting)
+				}
+				p.Children = append(p.Children, child)
+			case f.PkgPath == "" || allowed[i]:
+				p.Children = append(p.Children, c.plan("."+f.Name, f.Type, visiting))
+			case c.onUnexported != nil:
+				child := &Plan{Step: "." + f.Name, Type: f.Type, Option: "cpy.OnUnexported"}
+				switch c.unexportedActions(t)[i] {
+				case ShareValue:
+					child.Strategy = Share
+				case SkipValue, ZeroValue:
+					child.Strategy = Ignore
+				default:
+					child.Strategy, child.Option = Fail, ""
+				}
+				p.Children = append(p.Children, child)
+			case c.ignoresUnexported(t):
+				p.Children = append(p.Children, &Plan{Step: "." + f.Name, Type: f.Type, Strategy: Ignore})
+			default:
+				p.Children = append(p.Children, &Plan{Step: "." + f.Name, Type: f.Type, Strategy: Fail})
+			}
+		}
+	}
+	return p
+}
+
+// Check reports whether values of type t can be fully deep copied by c
+// without performing an actual copy, which is useful to assert in a test
+// that a type remains copyable as it evolves.
+// It reports an error describing every value within t that is either
+// not copied (e.g., an ignored unexported field or a dropped iterator),
+// causes Copier.Copy to panic (e.g., because of Forbid), or is shared
+// with the source by default (i.e., channels, functions, and unsafe pointers
+// not handled by an option).
+//
+// Check only considers the static structure of t (see Plan),
+// so values held in interfaces are not checked.
+func (c *Copier) Check(t reflect.Type) error {
+	var msgs []string
+	c.Plan(t).Walk(func(path string, p *Plan) {
+		path = t.String() + path
+		switch {
+		case p.Strategy == Fail && p.Option != "":
+			msgs = append(msgs, fmt.Sprintf("%v: copying is forbidden by %v", path, p.Option))
+		case p.Strategy == Fail:
+			msgs = append(msgs, fmt.Sprintf("%v: copying unexported field panics", path))
+		case p.Strategy == Ignore && p.Type.Kind() == reflect.Func:
+			msgs = append(msgs, fmt.Sprintf("%v: iterator is dropped", path))
+		case p.Strategy == Ignore:
+			msgs = append(msgs, fmt.Sprintf("%v: unexported field is ignored", path))
+		case p.Strategy == Share && p.Option == "":
+			msgs = checkShared(msgs, path, p.Type)
+		}
+	})
+	switch len(msgs) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("cpy.Check: %v", msgs[0])
+	default:
+		return fmt.Errorf("cpy.Check: %d problems:\n\t%v", len(msgs), strings.Join(msgs, "\n\t"))
+	}
+}
+
+// Precompile eagerly resolves and caches all information that c needs
+// to copy values of the types of vs and all types reachable from them,
+// such that the first copy of such values does not pay for resolving them
+// (e.g., in a latency-sensitive request path).
+// Types of values held in interfaces are not reachable
+// and must be provided explicitly.
+//
+// Example usage:
+//
+//	var copier = cpy.New(cpy.IgnoreAllUnexported())
+//
+//	func init() {
+//		copier.Precompile(Request{}, Response{})
+//	}
+func (c *Copier) Precompile(vs ...interface{}) {
+	seen := make(map[reflect.Type]bool)
+	for _, v := range vs {
+		if v == nil {
+			panic("cpy.Precompile: cannot precompile untyped nil")
+		}
+		c.precompile(reflect.TypeOf(v), seen)
+	}
+}
+func (c *Copier) precompile(t reflect.Type, seen map[reflect.Type]bool) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	if ti := c.typeInfo(t); ti.plain || ti.rule != nil {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Array, reflect.Slice:
+		c.precompile(t.Elem(), seen)
+	case reflect.Map:
+		c.precompile(t.Key(), seen)
+		c.precompile(t.Elem(), seen)
+	case reflect.Func:
+		if isIterator(t) && c.iterators == MaterializeIterators {
+			for yt, i := t.In(0), 0; i < yt.NumIn(); i++ {
+				c.precompile(yt.In(i), seen)
+			}
+		}
+	case reflect.Struct:
+		fs, allowed := loadStructFields(t), c.allowedFields(t)
+		switch {
+		case c.handlesStruct(t):
+			if c.onUnexported != nil {
+				c.unexportedActions(t)
+			}
+		case len(fs.unexported) > len(allowed) && !c.ignoresUnexported(t):
+			return // copying panics
+		case c.unsafeFieldAccess || len(allowed) > 0:
+			c.structLayout(t)
+		}
+		for _, i := range append(fs.exported[:len(fs.exported):len(fs.exported)], allowed...) {
+			c.precompile(t.Field(i).Type, seen)
+		}
+	}
+}
+
+// checkShared appends a message for every channel, function, or
+// unsafe pointer within t, which is shared by default.
+func checkShared(msgs []string, path string, t reflect.Type) []string {
+	switch t.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		msgs = append(msgs, fmt.Sprintf("%v: %v is shared instead of copied", path, t.Kind()))
+	case reflect.Array:
+		msgs = checkShared(msgs, path+"[]", t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			msgs = checkShared(msgs, path+"."+t.Field(i).Name, t.Field(i).Type)
+		}
+	}
+	return msgs
+}
+
+// Handler describes how a Copier copies values of a type,
+// not considering how the elements of such values are copied (see Plan).
+type Handler struct {
+	// Strategy is how values of the type are copied.
+	Strategy Strategy
+
+	// Option describes the Func, Shallow, or Forbid option that handles
+	// the type and where it was created. It is empty if the type is
+	// copied according to the default behavior.
+	Option string
+
+	// InputType is the input type of the copy function provided by Option,
+	// which may differ from the type itself (e.g., it may be a pointer to
+	// the type or an interface type implemented by the type).
+	// It is nil if Option is empty.
+	InputType reflect.Type
+}
+
+// HandlerFor reports how values of type t are copied by c, which is
+// useful to debug which of multiple options operating on t takes precedence.
+func (c *Copier) HandlerFor(t reflect.Type) Handler {
+	ti := c.typeInfo(t)
+	for ti.inner != nil {
+		ti = ti.inner // see Transformer and FilterPath
+	}
+	switch {
+	case ti.rule != nil:
+		return Handler{Strategy: ti.rule.strategy, Option: ti.rule.String(), InputType: ti.rule.typ}
+	default:
+		return Handler{Strategy: c.defaultStrategy(t, ti.plain)}
+	}
+}
+
+// defaultStrategy returns the strategy for type t if no option handles it,
+// where plain reports whether t is shallow copyable.
+func (c *Copier) defaultStrategy(t reflect.Type, plain bool) Strategy {
+	switch {
+	case plain:
+		return Share
+	case t.Kind() == reflect.Interface:
+		return Dynamic
+	case t.Kind() == reflect.Func && c.iterators == DropIterators:
+		return Ignore
+	default:
+		return Deep
+	}
+}
+
+// Walk calls f for p and every plan beneath it in depth-first order,
+// where path is the concatenation of all steps from p
+// (e.g., ".Payments[]*.Card").
+func (p *Plan) Walk(f func(path string, p *Plan)) {
+	p.walk("", f)
+}
+func (p *Plan) walk(path string, f func(string, *Plan)) {
+	path += p.Step
+	f(path, p)
+	for _, c := range p.Children {
+		c.walk(path, f)
+	}
+}
+
+// String renders the plan as an indented tree with one line per value.
+// The output is intended for humans and is not stable.
+func (p *Plan) String() string {
+	var sb strings.Builder
+	p.format(&sb, 0)
+	return sb.String()
+}
+func (p *Plan) format(sb *strings.Builder, depth int) {
+	sb.WriteString(strings.Repeat("\t", depth))
+	if p.Step != "" {
+		sb.WriteString(p.Step + " ")
+	}
+	fmt.Fprintf(sb, "%v: %v", p.Type, p.Strategy)
+	if p.Option != "" {
+		fmt.Fprintf(sb, " by %v", p.Option)
+	}
+	if p.Recursive {
+		sb.WriteString(" (recursive)")
+	}
+	sb.WriteString("\n")
+	for _, c := range p.Children {
+		c.format(sb, depth+1)
+	}
+}
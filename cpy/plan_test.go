@@ -0,0 +1,146 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy_test
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cpy/cpy"
+)
+
+type Order struct {
+	ID       int
+	Payments []*Payment
+	Tags     map[string]interface{}
+	Next     *Order
+	note     string
+}
+
+type Payment struct {
+	Card    Card
+	Created time.Time
+}
+
+type Card struct{ Number, Holder string }
+
+func TestPlan(t *testing.T) {
+	copier := cpy.New(cpy.Immutable(time.Time{}), cpy.IgnoreAllUnexported())
+	got := copier.Plan(reflect.TypeOf(Order{})).String()
+	want := strings.Join([]string{
+		"cpy_test.Order: deep",
+		"\t.ID int: share",
+		"\t.Payments []*cpy_test.Payment: deep",
+		"\t\t[] *cpy_test.Payment: deep",
+		"\t\t\t* cpy_test.Payment: share",
+		"\t.Tags map[string]interface {}: deep",
+		"\t\t{key} string: share",
+		"\t\t{value} interface {}: dynamic",
+		"\t.Next *cpy_test.Order: deep",
+		"\t\t* cpy_test.Order: deep (recursive)",
+		"\t.note string: ignore",
+		"",
+	}, "\n")
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Plan.String() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Assert that no payment information is shared with the source.
+	copier = cpy.New(cpy.Shallow(Card{}), cpy.IgnoreAllUnexported())
+	var shared []string
+	copier.Plan(reflect.TypeOf(Order{})).Walk(func(path string, p *cpy.Plan) {
+		if strings.HasPrefix(path, ".Payments") && p.Option != "" {
+			shared = append(shared, path+": "+p.Strategy.String())
+		}
+	})
+	if diff := cmp.Diff([]string{".Payments[]*.Card: share"}, shared); diff != "" {
+		t.Errorf("Plan.Walk() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	copier := cpy.New(cpy.Immutable(time.Time{}), cpy.IgnoreAllUnexported())
+	if err := copier.Check(reflect.TypeOf(Payment{})); err != nil {
+		t.Errorf("Check(%T) error: %v", Payment{}, err)
+	}
+
+	type Conn struct {
+		Addr   string
+		Closed chan struct{}
+		Order  *Order
+	}
+	err := copier.Check(reflect.TypeOf(Conn{}))
+	want := `cpy.Check: 2 problems:
+	cpy_test.Conn.Closed: chan is shared instead of copied
+	cpy_test.Conn.Order*.note: unexported field is ignored`
+	if err == nil || err.Error() != want {
+		t.Errorf("Check(Conn) error = %v, want %v", err, want)
+	}
+
+	copier = cpy.New(cpy.Forbid(Card{}), cpy.Immutable(time.Time{}), cpy.IgnoreAllUnexported())
+	err = copier.Check(reflect.TypeOf([]Payment{}))
+	wantRE := regexp.MustCompile(`^cpy.Check: \[\]cpy_test.Payment\[\].Card: copying is forbidden by cpy.Forbid\(cpy_test.Card\) at .*plan_test.go:\d+$`)
+	if err == nil || !wantRE.MatchString(err.Error()) {
+		t.Errorf("Check([]Payment) error = %v, want match for %v", err, wantRE)
+	}
+}
+
+func TestHandlerFor(t *testing.T) {
+	copier := cpy.New(
+		cpy.Func(func(m Proto) Proto { return m }),
+		cpy.Func(func(m ProtoM1) ProtoM1 { return m }),
+		cpy.Shallow(time.Time{}),
+		cpy.IgnoreAllUnexported(),
+	)
+	tests := []struct {
+		typ          reflect.Type
+		wantStrategy cpy.Strategy
+		wantOption   string
+		wantInput    reflect.Type
+	}{
+		{reflect.TypeOf(M1{}), cpy.Custom, "cpy.Func(func(cpy_test.ProtoM1) cpy_test.ProtoM1)", reflect.TypeOf((*ProtoM1)(nil)).Elem()},
+		{reflect.TypeOf(M{}), cpy.Custom, "cpy.Func(func(cpy_test.Proto) cpy_test.Proto)", reflect.TypeOf((*Proto)(nil)).Elem()},
+		{reflect.TypeOf(time.Time{}), cpy.Share, "cpy.Shallow(time.Time)", reflect.TypeOf(time.Time{})},
+		{reflect.TypeOf(0), cpy.Share, "", nil},
+		{reflect.TypeOf([]int{}), cpy.Deep, "", nil},
+		{reflect.TypeOf((*interface{})(nil)).Elem(), cpy.Dynamic, "", nil},
+	}
+	for _, tt := range tests {
+		got := copier.HandlerFor(tt.typ)
+		option, _, _ := strings.Cut(got.Option, " at ")
+		if got.Strategy != tt.wantStrategy || option != tt.wantOption || got.InputType != tt.wantInput {
+			t.Errorf("HandlerFor(%v) = {%v, %q, %v}, want {%v, %q, %v}",
+				tt.typ, got.Strategy, option, got.InputType, tt.wantStrategy, tt.wantOption, tt.wantInput)
+		}
+	}
+}
+
+func TestPrecompile(t *testing.T) {
+	var mu sync.Mutex
+	resolved := make(map[reflect.Type]bool)
+	copier := cpy.New(cpy.IgnoreAllUnexported(), cpy.ShallowIf(func(t reflect.Type) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		resolved[t] = true
+		return t == reflect.TypeOf(time.Time{})
+	}))
+	copier.Precompile(Order{})
+	for _, v := range []interface{}{Order{}, []*Payment{}, Card{}, time.Time{}} {
+		if typ := reflect.TypeOf(v); !resolved[typ] {
+			t.Errorf("Precompile() did not resolve %v", typ)
+		}
+	}
+
+	resolved = make(map[reflect.Type]bool)
+	copier.Copy(&Order{ID: 1, Payments: []*Payment{{Card: Card{Number: "1234"}}}})
+	if len(resolved) > 0 {
+		t.Errorf("Copy() resolved types after Precompile(): %v", resolved)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TypeProfiler accumulates the cost of copying values of each type
+// across every call to Copier.Copy for Copiers configured with ProfileTypes
+// or ProfilePaths.
+// A TypeProfiler is safe for concurrent use by multiple goroutines.
+type TypeProfiler struct {
+	mu    sync.Mutex
+	types map[profileKey]*TypeStats
+}
+
+// profileKey identifies the values that statistics are accumulated for.
+type profileKey struct {
+	t      reflect.Type
+	prefix string
+}
+
+// TypeStats is the accumulated cost of copying values of a type.
+type TypeStats struct {
+	Type reflect.Type
+
+	// Prefix is the prefix of the path to the values of Type for statistics
+	// recorded by ProfilePaths (e.g., ".Payments[].Card"), which is empty
+	// for values of the root type and for statistics recorded by ProfileTypes.
+	Prefix string
+
+	// Values is the number of values of Type that were copied.
+	Values int
+
+	// Time is the wall time spent copying values of Type, excluding
+	// time spent copying nested values (which is attributed to their types).
+	Time time.Duration
+
+	// Bytes is an estimate of the bytes of new storage allocated for
+	// the copies of values of Type (e.g., the array of a slice or
+	// the value a pointer points to), excluding storage for their elements.
+	Bytes int64
+}
+
+// ProfileTypes specifies that the cost of copying every value is
+// recorded in p by the type of the value.
+// It is implemented in terms of Middleware, such that the time recorded
+// includes time spent in middleware provided later to New.
+//
+// Example usage:
+//
+//	var p cpy.TypeProfiler
+//	copier := cpy.New(cpy.ProfileTypes(&p), cpy.IgnoreAllUnexported())
+//	copier.Copy(v)
+//	for _, s := range p.Stats() {
+//		fmt.Println(s.Type, s.Values, s.Time)
+//	}
+func ProfileTypes(p *TypeProfiler) Option {
+	if p == nil {
+		panic("cpy.ProfileTypes: profiler must not be nil")
+	}
+	return Middleware(func(next CopyFn) CopyFn { return p.wrap(next, nil) })
+}
+
+// ProfilePaths is identical to ProfileTypes, except that the cost of
+// copying every value is recorded by both the type of the value and the
+// prefix of its path from the root value of at most depth steps.
+// Steps to elements of arrays, slices, and maps are rendered as "[]"
+// regardless of their index or key, while steps to the values that pointers
+// point to are omitted, such that values are attributed to their location
+// within the root type (e.g., ".Payments[].Card" for depth 3).
+// It panics if depth is not positive. Tracking paths slows down every copy
+// made by the Copier.
+//
+// Example usage:
+//
+//	var p cpy.TypeProfiler
+//	copier := cpy.New(cpy.ProfilePaths(&p, 2), cpy.IgnoreAllUnexported())
+//	copier.Copy(v)
+//	for _, s := range p.Stats() {
+//		fmt.Println(s.Prefix, s.Type, s.Time)
+//	}
+func ProfilePaths(p *TypeProfiler, depth int) Option {
+	if p == nil {
+		panic("cpy.ProfilePaths: profiler must not be nil")
+	}
+	if depth <= 0 {
+		panic(fmt.Sprintf("cpy.ProfilePaths: depth %d must be positive", depth))
+	}
+	return option{middleware: []middlewareFunc{func(path *Path, next CopyFn) CopyFn {
+		return p.wrap(next, func() string { return path.prefix(depth) })
+	}}, trackPaths: true}
+}
+
+// prefix renders the first n steps of p (see ProfilePaths).
+func (p Path) prefix(n int) string {
+	var sb strings.Builder
+	for _, ps := range p {
+		switch {
+		case ps.isIndirect():
+			continue
+		case n == 0:
+			return sb.String()
+		case ps.Field != "":
+			sb.WriteString("." + ps.Field)
+		default:
+			sb.WriteString("[]")
+		}
+		n--
+	}
+	return sb.String()
+}
+
+// wrap is called once for every call to Copier.Copy,
+// such that the returned function only records a single call.
+// If prefix is non-nil, it returns the path prefix of the current value.
+func (p *TypeProfiler) wrap(next CopyFn, prefix func() string) CopyFn {
+	var (
+		nested []time.Duration // time spent in nested values for each active value
+		local  = make(map[profileKey]*TypeStats)
+	)
+	return func(src reflect.Value) reflect.Value {
+		k := profileKey{t: src.Type()}
+		if prefix != nil {
+			k.prefix = prefix()
+		}
+		start := time.Now()
+		nested = append(nested, 0)
+		dst := next(src)
+		elapsed := time.Since(start)
+
+		ts := local[k]
+		if ts == nil {
+			ts = &TypeStats{Type: k.t, Prefix: k.prefix}
+			local[k] = ts
+		}
+		ts.Values++
+		ts.Time += elapsed - nested[len(nested)-1]
+		ts.Bytes += allocatedBytes(dst, src)
+
+		nested = nested[:len(nested)-1]
+		if n := len(nested); n > 0 {
+			nested[n-1] += elapsed
+		} else {
+			p.merge(local) // top-level value is copied
+			local = make(map[profileKey]*TypeStats)
+		}
+		return dst
+	}
+}
+
+func (p *TypeProfiler) merge(local map[profileKey]*TypeStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.types == nil {
+		p.types = make(map[profileKey]*TypeStats)
+	}
+	for k, ts := range local {
+		if ts2 := p.types[k]; ts2 != nil {
+			ts2.Values += ts.Values
+			ts2.Time += ts.Time
+			ts2.Bytes += ts.Bytes
+		} else {
+			p.types[k] = ts
+		}
+	}
+}
+
+// allocatedBytes estimates the bytes of new storage allocated for
+// dst as a copy of src, which is zero if dst is shared with src.
+func allocatedBytes(dst, src reflect.Value) int64 {
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if !dst.IsNil() && dst.Pointer() != src.Pointer() {
+			return int64(dst.Type().Elem().Size())
+		}
+	case reflect.Slice:
+		if dst.Cap() > 0 && dst.Pointer() != src.Pointer() {
+			return int64(dst.Cap()) * int64(dst.Type().Elem().Size())
+		}
+	case reflect.Map:
+		if !dst.IsNil() && dst.Pointer() != src.Pointer() {
+			return int64(dst.Len()) * int64(dst.Type().Key().Size()+dst.Type().Elem().Size())
+		}
+	}
+	return 0
+}
+
+// Stats returns the accumulated statistics for every type copied
+// (and every path prefix if recorded by ProfilePaths),
+// sorted by decreasing time.
+func (p *TypeProfiler) Stats() []TypeStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]TypeStats, 0, len(p.types))
+	for _, ts := range p.types {
+		stats = append(stats, *ts)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Time != stats[j].Time {
+			return stats[i].Time > stats[j].Time
+		}
+		if stats[i].Prefix != stats[j].Prefix {
+			return stats[i].Prefix < stats[j].Prefix
+		}
+		return stats[i].Type.String() < stats[j].Type.String()
+	})
+	return stats
+}
+
+// Reset discards all accumulated statistics.
+func (p *TypeProfiler) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.types = nil
+}
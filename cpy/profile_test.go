@@ -0,0 +1,87 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cpy/cpy"
+)
+
+func TestProfileTypes(t *testing.T) {
+	var p cpy.TypeProfiler
+	copier := cpy.New(cpy.ProfileTypes(&p), cpy.IgnoreAllUnexported())
+	src := &Order{ID: 1, Payments: []*Payment{{Card: Card{Number: "1"}}, {}}}
+	for i := 0; i < 3; i++ {
+		copier.Copy(src)
+	}
+
+	type stats struct {
+		Values int
+		Bytes  int64
+	}
+	got := make(map[string]stats)
+	for _, s := range p.Stats() {
+		if s.Time < 0 {
+			t.Errorf("%v: Time = %v, want non-negative", s.Type, s.Time)
+		}
+		got[s.Type.String()] = stats{s.Values, s.Bytes}
+	}
+	ptrSize := int64(reflect.TypeOf(uintptr(0)).Size())
+	// The nil Next field and the zero Payment are visited,
+	// but elements of zero values are not.
+	want := map[string]stats{
+		"*cpy_test.Order":         {6, 3 * int64(reflect.TypeOf(Order{}).Size())},
+		"cpy_test.Order":          {3, 0},
+		"int":                     {3, 0},
+		"[]*cpy_test.Payment":     {3, 3 * 2 * ptrSize},
+		"*cpy_test.Payment":       {6, 6 * int64(reflect.TypeOf(Payment{}).Size())},
+		"cpy_test.Payment":        {6, 0},
+		"cpy_test.Card":           {3, 0},
+		"time.Time":               {3, 0},
+		"map[string]interface {}": {3, 0},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Stats() mismatch (-want +got):\n%s", diff)
+	}
+
+	p.Reset()
+	if got := p.Stats(); len(got) != 0 {
+		t.Errorf("Stats() after Reset = %v, want empty", got)
+	}
+}
+
+func TestProfilePaths(t *testing.T) {
+	var p cpy.TypeProfiler
+	copier := cpy.New(cpy.ProfilePaths(&p, 2), cpy.IgnoreAllUnexported())
+	src := &Order{ID: 1, Payments: []*Payment{{Card: Card{Number: "1"}}, {}}}
+	for i := 0; i < 3; i++ {
+		copier.Copy(src)
+	}
+
+	got := make(map[string]int)
+	for _, s := range p.Stats() {
+		got[s.Prefix+" "+s.Type.String()] += s.Values
+	}
+	// Values beyond the depth are attributed to the prefix at the depth,
+	// while fields of the zero Payment are not visited.
+	want := map[string]int{
+		" *cpy_test.Order":              3,
+		" cpy_test.Order":               3,
+		".ID int":                       3,
+		".Payments []*cpy_test.Payment": 3,
+		".Payments[] *cpy_test.Payment": 6,
+		".Payments[] cpy_test.Payment":  6,
+		".Payments[] cpy_test.Card":     3,
+		".Payments[] time.Time":         3,
+		".Tags map[string]interface {}": 3,
+		".Next *cpy_test.Order":         3,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Stats() mismatch (-want +got):\n%s", diff)
+	}
+}
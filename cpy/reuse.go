@@ -0,0 +1,198 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"reflect"
+)
+
+// ReuseDestination specifies that Copier.CopyInto reuses the storage
+// already allocated by the destination instead of allocating new storage,
+// which reduces the pressure on the garbage collector when repeatedly
+// copying into the same destination (e.g., to snapshot state periodically).
+//
+// The destination is walked alongside the source, where:
+//
+// • a non-nil pointer is reused by copying into the value it points to,
+//
+// • a slice is reused by copying into its elements
+// if its capacity is sufficient to hold all elements of the source,
+//
+// • a non-nil map is reused by deleting all entries not present in the
+// source and copying into the values of the remaining entries, and
+//
+// • arrays and structs are reused by copying into each of their elements.
+//
+// All other values (e.g., values held in interfaces or values handled by
+// a Func) are copied anew as by Copy. The result is equal to that of
+// CopyInto without ReuseDestination, except that no memory reachable from
+// the destination is released. Since the destination is modified in place,
+// the memory it references must not be referenced from elsewhere
+// (e.g., by the source or by previous results that are still in use).
+// Middleware disables reuse entirely.
+//
+// Example usage:
+//
+//	var copier = cpy.New(cpy.ReuseDestination(), cpy.IgnoreAllUnexported())
+//
+//	func (g *Game) Snapshot() {
+//		if err := copier.CopyInto(&g.snapshot, &g.state); err != nil {
+//			panic(err)
+//		}
+//	}
+func ReuseDestination() Option {
+	return option{reuse: true}
+}
+
+// copyReuseRoot copies the root value src into dst,
+// which must be a settable value of the same type.
+func (c *Copier) copyReuseRoot(dst, src reflect.Value) {
+	if len(c.traces) > 0 || len(c.middleware) > 0 || c.preserveAliasing {
+		s := &state{Copier: c, root: src.Type()}
+		if c.preserveAliasing {
+			s.memo = getMemo()
+			defer putMemo(s.memo)
+		}
+		if len(c.middleware) > 0 {
+			s.next = s.chain()
+		}
+		if len(c.traces) > 0 {
+			defer s.trace("CopyInto", src.Type())()
+		}
+		s.copyReuse(dst, src)
+		return
+	}
+	s := state{Copier: c, root: src.Type()} // avoid allocating state when not tracing
+	s.copyReuse(dst, src)
+}
+
+// copyReuse copies src into dst, which must be a settable value of
+// the same type, reusing the storage that dst references if possible
+// (see ReuseDestination).
+func (s *state) copyReuse(dst, src reflect.Value) {
+	src = readable(src)
+	t := src.Type()
+	ti := s.typeInfo(t)
+	if ti.rule != nil && ti.rule.strategy == Fail && s.onError != nil && !src.IsZero() {
+		s.handleError(forbiddenError(ti.rule.typ, ti.rule.name, ti.rule.site), dst, src)
+		return
+	}
+	if ti.plain || ti.fnc.IsValid() || ti.inner != nil || s.next != nil || src.IsZero() || !reusable(dst, src) {
+		dst.Set(s.copyWith(src, ti))
+		return
+	}
+
+	s.enter(t.Kind())
+	defer s.leave()
+	switch t.Kind() {
+	case reflect.Ptr:
+		k := memoKey{src.UnsafePointer(), t}
+		if p, ok := s.copied(k); ok {
+			dst.Set(p)
+			break
+		}
+		if s.cyclic(k) {
+			s.copyCycle(dst, src)
+			break
+		}
+		s.record(k, dst.Elem().Addr()) // record before copying to handle cycles
+		if s.trackPaths {
+			s.push(PathStep{Type: t.Elem(), Index: -1})
+			s.copyReuse(dst.Elem(), src.Elem())
+			s.pop()
+		} else {
+			s.copyReuse(dst.Elem(), src.Elem())
+		}
+		s.unrecord(k)
+	case reflect.Array:
+		s.copyElemsReuse(dst, src)
+	case reflect.Slice:
+		dst.Set(dst.Slice(0, src.Len()))
+		s.copyElemsReuse(dst, src)
+	case reflect.Map:
+		for iter := dst.MapRange(); iter.Next(); {
+			if !src.MapIndex(iter.Key()).IsValid() {
+				dst.SetMapIndex(iter.Key(), reflect.Value{})
+			}
+		}
+		vt := t.Elem()
+		for iter := src.MapRange(); iter.Next(); {
+			k := s.copy(iter.Key())
+			v := reflect.New(vt).Elem()
+			if old := dst.MapIndex(k); old.IsValid() {
+				v.Set(old)
+			}
+			if s.trackPaths {
+				s.push(PathStep{Type: vt, Index: -1, Key: iter.Key()})
+				s.copyReuse(v, iter.Value())
+				s.pop()
+			} else {
+				s.copyReuse(v, iter.Value())
+			}
+			dst.SetMapIndex(k, v)
+		}
+	case reflect.Struct:
+		if s.handlesStruct(t) {
+			s.copyStructHandled(dst, stage(src), true)
+			break
+		}
+		for _, i := range s.exportedFields(t) {
+			s.copyFieldReuse(dst.Field(i), src.Field(i), t, i)
+		}
+		allowed := s.allowedFields(t)
+		for _, i := range loadStructFields(t).unexported {
+			df := readable(dst.Field(i)) // settable since dst is addressable
+			if len(allowed) > 0 && allowed[0] == i {
+				allowed = allowed[1:]
+				s.copyFieldReuse(df, src.Field(i), t, i)
+				continue
+			}
+			df.Set(reflect.Zero(df.Type()))
+		}
+	}
+}
+
+// copyFieldReuse copies the source field src into the destination
+// field dst, where both are the i-th field of struct t.
+func (s *state) copyFieldReuse(dst, src reflect.Value, t reflect.Type, i int) {
+	if s.trackPaths {
+		f := t.Field(i)
+		s.push(PathStep{Type: f.Type, Field: f.Name, Index: -1})
+		s.copyReuse(dst, src)
+		s.pop()
+		return
+	}
+	s.copyReuse(dst, src)
+}
+
+// reusable reports whether the storage referenced by dst
+// may be reused to hold a copy of src.
+func reusable(dst, src reflect.Value) bool {
+	switch src.Kind() {
+	case reflect.Ptr, reflect.Map:
+		return !dst.IsNil() && dst.Pointer() != src.Pointer()
+	case reflect.Slice:
+		return !dst.IsNil() && dst.Cap() >= src.Len() && dst.Pointer() != src.Pointer()
+	case reflect.Array, reflect.Struct:
+		return true
+	default:
+		return false
+	}
+}
+
+// copyElemsReuse copies every element of the array or slice src
+// into the corresponding element of dst.
+func (s *state) copyElemsReuse(dst, src reflect.Value) {
+	et := src.Type().Elem()
+	for i := 0; i < src.Len(); i++ {
+		if s.trackPaths {
+			s.push(PathStep{Type: et, Index: i})
+			s.copyReuse(dst.Index(i), src.Index(i))
+			s.pop()
+			continue
+		}
+		s.copyReuse(dst.Index(i), src.Index(i))
+	}
+}
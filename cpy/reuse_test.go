@@ -0,0 +1,73 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cpy/cpy"
+)
+
+type (
+	GameState struct {
+		Tick    int
+		Player  *Entity
+		Enemies []*Entity
+		Scores  map[string]*Score
+	}
+	Entity struct {
+		Name string
+		Pos  [2]float64
+	}
+	Score struct {
+		Points int
+	}
+)
+
+func TestReuseDestination(t *testing.T) {
+	c := cpy.New(cpy.ReuseDestination(), cpy.IgnoreAllUnexported())
+
+	src := &GameState{
+		Tick:    1,
+		Player:  &Entity{Name: "player", Pos: [2]float64{1, 2}},
+		Enemies: []*Entity{{Name: "orc"}, {Name: "troll"}},
+		Scores:  map[string]*Score{"a": {1}, "b": {2}},
+	}
+	var dst GameState
+	if err := c.CopyInto(&dst, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if diff := cmp.Diff(*src, dst); diff != "" {
+		t.Errorf("CopyInto() mismatch (-want +got):\n%s", diff)
+	}
+	player, enemy, score := dst.Player, dst.Enemies[0], dst.Scores["a"]
+
+	src.Tick = 2
+	src.Player.Pos[0] = 5
+	src.Enemies = src.Enemies[:1]
+	src.Enemies[0].Name = "goblin"
+	delete(src.Scores, "b")
+	src.Scores["a"].Points = 10
+	if err := c.CopyInto(&dst, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if diff := cmp.Diff(*src, dst); diff != "" {
+		t.Errorf("CopyInto() mismatch (-want +got):\n%s", diff)
+	}
+	if dst.Player != player || dst.Enemies[0] != enemy || dst.Scores["a"] != score {
+		t.Errorf("CopyInto() did not reuse the destination")
+	}
+	if dst.Player == src.Player || dst.Enemies[0] == src.Enemies[0] || dst.Scores["a"] == src.Scores["a"] {
+		t.Errorf("CopyInto() shares memory with the source")
+	}
+
+	fresh := cpy.New(cpy.IgnoreAllUnexported())
+	want := testing.AllocsPerRun(100, func() { fresh.CopyInto(&dst, src) })
+	got := testing.AllocsPerRun(100, func() { c.CopyInto(&dst, src) })
+	if got >= want/2 {
+		t.Errorf("CopyInto() allocated %v times, want less than half of %v", got, want)
+	}
+}
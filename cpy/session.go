@@ -0,0 +1,270 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// CopySession copies multiple values such that identity of pointers is
+// preserved across all copies made within the session.
+// If the same pointer is reachable from multiple values copied by the session
+// (or multiple times within the same value), then every copy references
+// the same new value. As a consequence, cyclic data structures reachable
+// only through pointers may also be copied.
+//
+// Only pointers are tracked. Slices and maps reachable from multiple values
+// are copied separately for every occurrence. Pointers copied by a
+// Func or Shallow option are not tracked.
+//
+// A CopySession retains every pointer copied (and the value it points to)
+// until it is discarded, reset with Reset, or told to forget the pointer
+// with Forget. Long-lived sessions should forget values that are no longer
+// in use, which keeps the sharing of all other pointers intact.
+// A CopySession is safe for concurrent use by multiple goroutines,
+// but copies are serialized.
+type CopySession struct {
+	c    *Copier
+	mu   sync.Mutex
+	memo map[memoKey]reflect.Value
+}
+
+// ErrCycle is wrapped by the errors that Copier.Copy panics with
+// (or that Copier.CopyE returns) when a pointer is reached again while
+// copying the value it points to, unless PreserveAliasing is specified.
+var ErrCycle = errors.New("cyclic value")
+
+// PreserveAliasing specifies that identity of pointers is preserved
+// within every copy. If the same pointer is reachable multiple times
+// from the value being copied (e.g., a node shared by two parents in a
+// directed acyclic graph), then the copy references a single new value
+// from all of these places instead of a separate copy for each of them.
+// Cyclic values reachable through pointers (e.g., a doubly-linked list)
+// are thus copied into a structurally identical cyclic copy.
+// As with CopySession, only pointers are tracked, and pointers copied by a
+// Func or Shallow option are not tracked. Tracking pointers slows down
+// every copy made by the Copier.
+//
+// Example usage:
+//
+//	copier := cpy.New(cpy.PreserveAliasing(), cpy.IgnoreAllUnexported())
+//	doc := copier.Copy(srcDoc).(*Document) // shared nodes remain shared
+func PreserveAliasing() Option {
+	return option{preserveAliasing: true}
+}
+
+// memoKey identifies a pointer that has been copied.
+// The type is part of the key since a pointer to a struct
+// and a pointer to its first field have the same address.
+type memoKey struct {
+	p unsafe.Pointer
+	t reflect.Type
+}
+
+// memoPool is a pool of empty maps for recording the copies of pointers,
+// which are reused across copies since allocating a new map dominates
+// the cost of copying small values while tracking pointers.
+var memoPool = sync.Pool{New: func() interface{} { return make(map[memoKey]reflect.Value) }}
+
+// maxPooledMemo is the maximum number of pointers recorded in a map that
+// is returned to memoPool, which avoids retaining the storage of maps
+// grown by copying exceptionally large values.
+const maxPooledMemo = 1 << 12
+
+func getMemo() map[memoKey]reflect.Value {
+	return memoPool.Get().(map[memoKey]reflect.Value)
+}
+
+func putMemo(m map[memoKey]reflect.Value) {
+	if len(m) > maxPooledMemo {
+		return
+	}
+	for k := range m {
+		delete(m, k)
+	}
+	memoPool.Put(m)
+}
+
+// copied returns the copy of the pointer identified by k
+// if it has been recorded by record while preserving identity of pointers.
+func (s *state) copied(k memoKey) (reflect.Value, bool) {
+	p, ok := s.memo[k]
+	return p, ok
+}
+
+// record records p as the copy of the pointer identified by k
+// before the value it points to is copied. Unless identity of pointers is
+// preserved, it only records that the pointer is on the path to the current
+// value until unrecord is called, such that cycles back to it are reported
+// by copyCycle instead of recursing forever.
+func (s *state) record(k memoKey, p reflect.Value) {
+	if s.memo != nil {
+		s.memo[k] = p
+		return
+	}
+	s.ptrs.push(k)
+}
+
+// unrecord records that the value that the pointer identified by k
+// points to has been copied.
+func (s *state) unrecord(k memoKey) {
+	if s.memo == nil {
+		s.ptrs.pop(k)
+	}
+}
+
+// cyclic reports whether the pointer identified by k is on the path
+// to the current value, such that copying it again would recurse forever.
+func (s *state) cyclic(k memoKey) bool {
+	return s.memo == nil && s.ptrs.contains(k)
+}
+
+// copyCycle handles the pointer src, which is reached again
+// while copying the value it points to (see ErrCycle).
+func (s *state) copyCycle(dst, src reflect.Value) {
+	msg := fmt.Sprintf("cpy: %v of %v", ErrCycle, src.Type())
+	if len(s.path) > 0 {
+		msg += fmt.Sprintf(" at %v", s.path)
+	}
+	err := &copyError{msg: msg, err: ErrCycle}
+	if s.onError == nil {
+		panic(err)
+	}
+	s.handleError(err, dst, src)
+}
+
+// pathPointers is the set of pointers on the path to the current value.
+// The first pointers are kept inline to avoid allocating for shallow values,
+// while deeper pointers (e.g., of a long list) are kept in a map.
+type pathPointers struct {
+	n     int
+	small [8]memoKey
+	large map[memoKey]reflect.Value // nil until the set overflows small; from memoPool
+}
+
+func (ps *pathPointers) contains(k memoKey) bool {
+	for i := 0; i < ps.n && i < len(ps.small); i++ {
+		if ps.small[i] == k {
+			return true
+		}
+	}
+	_, ok := ps.large[k]
+	return ok
+}
+
+func (ps *pathPointers) push(k memoKey) {
+	switch {
+	case ps.n < len(ps.small):
+		ps.small[ps.n] = k
+	case ps.large == nil:
+		ps.large = getMemo()
+		fallthrough
+	default:
+		ps.large[k] = reflect.Value{}
+	}
+	ps.n++
+}
+
+func (ps *pathPointers) pop(k memoKey) {
+	if ps.n--; ps.n >= len(ps.small) {
+		delete(ps.large, k)
+	}
+	if ps.n == len(ps.small) {
+		putMemo(ps.large) // the map is empty again
+		ps.large = nil
+	}
+}
+
+// NewSession returns a new CopySession that copies values
+// according to the Copier presets.
+//
+// Example usage:
+//
+//	sess := copier.NewSession()
+//	graph := sess.Copy(srcGraph).(*Graph)
+//	index := sess.Copy(srcIndex).(*Index) // references nodes within graph
+func (c *Copier) NewSession() *CopySession {
+	return &CopySession{c: c, memo: make(map[memoKey]reflect.Value)}
+}
+
+// Copy copies v in the same way as Copier.Copy, except that pointers
+// previously copied within the session are replaced with their copies.
+func (s *CopySession) Copy(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.copyRoot(context.Background(), "CopySession.Copy", reflect.ValueOf(v), s.memo, nil).Interface()
+}
+
+// Forget discards the copies of all pointers reachable from v (including v
+// itself), such that the session no longer retains the memory of v.
+// Copying any of these pointers again within the session makes a new copy
+// instead of referencing the former one.
+// Pointers reachable from v are found by traversing all fields of structs
+// (whether exported or not), elements of arrays, slices, and maps,
+// and the values of interfaces and pointers.
+func (s *CopySession) Forget(v interface{}) {
+	ptrs := make(map[unsafe.Pointer]bool)
+	reachablePointers(reflect.ValueOf(v), ptrs)
+	if len(ptrs) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.memo {
+		if ptrs[k.p] {
+			delete(s.memo, k)
+		}
+	}
+}
+
+// Reset discards the copies of all pointers copied within the session,
+// as if the session was newly created.
+func (s *CopySession) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.memo = make(map[memoKey]reflect.Value)
+}
+
+// reachablePointers adds the addresses of all pointers reachable from v
+// to ptrs, which also records the pointers already traversed.
+func reachablePointers(v reflect.Value, ptrs map[unsafe.Pointer]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || ptrs[v.UnsafePointer()] {
+			return
+		}
+		ptrs[v.UnsafePointer()] = true
+		reachablePointers(v.Elem(), ptrs)
+	case reflect.Interface:
+		reachablePointers(v.Elem(), ptrs)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			reachablePointers(v.Field(i), ptrs)
+		}
+	case reflect.Array, reflect.Slice:
+		if pointerFree(v.Type().Elem()) {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			reachablePointers(v.Index(i), ptrs)
+		}
+	case reflect.Map:
+		if pointerFree(v.Type().Key()) && pointerFree(v.Type().Elem()) {
+			return
+		}
+		for iter := v.MapRange(); iter.Next(); {
+			reachablePointers(iter.Key(), ptrs)
+			reachablePointers(iter.Value(), ptrs)
+		}
+	}
+}
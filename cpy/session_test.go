@@ -0,0 +1,233 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/google/go-cpy/cpy"
+)
+
+type Node struct {
+	Name string
+	Next *Node
+}
+
+func TestCopySession(t *testing.T) {
+	shared := &Node{Name: "shared"}
+	a := &Node{Name: "a", Next: shared}
+	b := []*Node{shared, shared}
+
+	sess := cpy.New(cpy.IgnoreAllUnexported()).NewSession()
+	a2 := sess.Copy(a).(*Node)
+	b2 := sess.Copy(b).([]*Node)
+	if a2 == a || a2.Next == shared {
+		t.Errorf("Copy() shares memory with the source")
+	}
+	if a2.Next != b2[0] || b2[0] != b2[1] {
+		t.Errorf("Copy() did not preserve identity of shared pointer across copies")
+	}
+	if a2.Next.Name != "shared" {
+		t.Errorf("Copy().Next.Name = %q, want %q", a2.Next.Name, "shared")
+	}
+
+	cyclic := &Node{Name: "cyclic"}
+	cyclic.Next = cyclic
+	if got := sess.Copy(cyclic).(*Node); got == cyclic || got.Next != got {
+		t.Errorf("Copy() did not preserve cycle")
+	}
+}
+
+func TestCopySessionForget(t *testing.T) {
+	shared := &Node{Name: "shared"}
+	a := &Node{Name: "a", Next: shared}
+	b := &Node{Name: "b"}
+
+	sess := cpy.New(cpy.IgnoreAllUnexported()).NewSession()
+	a2 := sess.Copy(a).(*Node)
+	b2 := sess.Copy(b).(*Node)
+	sess.Forget([]*Node{a})
+	if got := sess.Copy(shared).(*Node); got == a2.Next {
+		t.Errorf("Copy() after Forget() references the forgotten copy of a reachable pointer")
+	}
+	if got := sess.Copy(a).(*Node); got == a2 {
+		t.Errorf("Copy() after Forget() references the forgotten copy")
+	}
+	if got := sess.Copy(b).(*Node); got != b2 {
+		t.Errorf("Copy() after Forget() did not preserve identity of a pointer that was not forgotten")
+	}
+
+	sess.Reset()
+	if got := sess.Copy(b).(*Node); got == b2 {
+		t.Errorf("Copy() after Reset() references a copy made before")
+	}
+}
+
+func TestPreserveAliasing(t *testing.T) {
+	shared := &Node{Name: "shared"}
+	src := []*Node{{Name: "a", Next: shared}, {Name: "b", Next: shared}}
+
+	c := cpy.New(cpy.PreserveAliasing(), cpy.IgnoreAllUnexported())
+	got := c.Copy(src).([]*Node)
+	if got[0].Next == shared || got[0].Next != got[1].Next || got[0].Next.Name != "shared" {
+		t.Errorf("Copy() did not preserve identity of shared pointer")
+	}
+	if got2 := c.Copy(src).([]*Node); got2[0].Next == got[0].Next {
+		t.Errorf("Copy() preserved identity across separate copies")
+	}
+	if got := cpy.New(cpy.IgnoreAllUnexported()).Copy(src).([]*Node); got[0].Next == got[1].Next {
+		t.Errorf("Copy() without PreserveAliasing preserved identity")
+	}
+
+	dst := []*Node{{Name: "x", Next: &Node{}}, {Name: "y", Next: &Node{}}}
+	if err := cpy.New(cpy.PreserveAliasing(), cpy.ReuseDestination(), cpy.IgnoreAllUnexported()).CopyInto(&dst, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if dst[0].Next != dst[1].Next || dst[0].Next.Name != "shared" || dst[0].Next == shared {
+		t.Errorf("CopyInto() with ReuseDestination did not preserve identity of shared pointer")
+	}
+}
+
+type DNode struct {
+	Value      int
+	Prev, Next *DNode
+}
+
+// makeRing returns the first of n nodes in a circular doubly-linked list.
+func makeRing(n int) *DNode {
+	nodes := make([]*DNode, n)
+	for i := range nodes {
+		nodes[i] = &DNode{Value: i}
+	}
+	for i, d := range nodes {
+		d.Prev, d.Next = nodes[(i+n-1)%n], nodes[(i+1)%n]
+	}
+	return nodes[0]
+}
+
+// checkRing reports an error unless got is a copy of the ring of n nodes
+// starting at src that is linked in the same way without sharing any node.
+func checkRing(t *testing.T, name string, got, src *DNode, n int) {
+	t.Helper()
+	d := got
+	for i := 0; i < n; i, d, src = i+1, d.Next, src.Next {
+		if d == src || d.Value != src.Value || d.Next.Prev != d {
+			t.Errorf("%v: node %d = %+v, want copy of %+v", name, i, d, src)
+			return
+		}
+	}
+	if d != got {
+		t.Errorf("%v: ring of %d nodes is not closed", name, n)
+	}
+}
+
+func TestCycles(t *testing.T) {
+	c := cpy.New(cpy.PreserveAliasing(), cpy.IgnoreAllUnexported())
+	for _, n := range []int{1, 2, 5000} {
+		src := makeRing(n)
+		checkRing(t, fmt.Sprintf("Copy(ring of %d)", n), c.Copy(src).(*DNode), src, n)
+	}
+
+	src := makeRing(2)
+	_, err := cpy.New(cpy.IgnoreAllUnexported()).CopyE(src)
+	if !errors.Is(err, cpy.ErrCycle) {
+		t.Errorf("CopyE() without PreserveAliasing error = %v, want ErrCycle", err)
+	}
+	zero := cpy.New(cpy.OnError(func(error) cpy.Action { return cpy.ZeroValue }))
+	if got := zero.Copy(src).(*DNode); got.Next.Next != nil || got.Next.Prev != nil || got.Prev.Prev != nil {
+		t.Errorf("Copy() with OnError did not zero cyclic pointers: %+v", got)
+	}
+
+	// Cycles are copied within limits proportional to the size of the value.
+	for _, opt := range []cpy.Option{cpy.MaxNodes(100), cpy.MaxBytes(4096), cpy.MaxDepth(50)} {
+		got, err := cpy.New(opt, cpy.PreserveAliasing(), cpy.IgnoreAllUnexported()).CopyE(src)
+		if err != nil {
+			t.Errorf("CopyE() with %v error: %v", opt, err)
+			continue
+		}
+		checkRing(t, fmt.Sprintf("CopyE() with %v", opt), got.(*DNode), src, 2)
+	}
+
+	type DNodeDTO struct {
+		Value      int
+		Prev, Next *DNodeDTO
+	}
+	var dto *DNodeDTO
+	if err := cpy.New(cpy.MatchFields(), cpy.PreserveAliasing(), cpy.IgnoreAllUnexported()).CopyInto(&dto, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if dto.Next.Prev != dto || dto.Next.Next != dto || dto.Next.Value != 1 {
+		t.Errorf("CopyInto() with MatchFields did not copy cycle into a structurally identical cycle")
+	}
+	if err := cpy.New(cpy.MatchFields(), cpy.IgnoreAllUnexported()).CopyInto(&dto, src); !errors.Is(err, cpy.ErrCycle) {
+		t.Errorf("CopyInto() with MatchFields error = %v, want ErrCycle", err)
+	}
+
+	dst := &DNode{Next: &DNode{}}
+	if err := cpy.New(cpy.ReuseDestination(), cpy.PreserveAliasing(), cpy.IgnoreAllUnexported()).CopyInto(&dst, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	checkRing(t, "CopyInto() with ReuseDestination", dst, src, 2)
+
+	compiled := cpy.Compile(reflect.TypeOf(src), cpy.PreserveAliasing(), cpy.IgnoreAllUnexported())
+	checkRing(t, "Compiled.Copy()", compiled.Copy(src).(*DNode), src, 2)
+}
+
+func TestCyclesMiddleware(t *testing.T) {
+	var calls int
+	var p cpy.TypeProfiler
+	c := cpy.New(
+		cpy.Middleware(func(next cpy.CopyFn) cpy.CopyFn {
+			return func(src reflect.Value) reflect.Value {
+				calls++
+				return next(src)
+			}
+		}),
+		cpy.ProfileTypes(&p),
+		cpy.PreserveAliasing(),
+		cpy.IgnoreAllUnexported(),
+	)
+	const n = 1500
+	src := makeRing(n)
+	checkRing(t, "Copy()", c.Copy(src).(*DNode), src, n)
+
+	// Every node and its three fields are visited once,
+	// in addition to the root pointer.
+	if want := 4*n + 1; calls != want {
+		t.Errorf("middleware calls = %d, want %d", calls, want)
+	}
+	got := make(map[string]int)
+	for _, s := range p.Stats() {
+		got[s.Type.String()] = s.Values
+	}
+	want := map[string]int{"*cpy_test.DNode": 2*n + 1, "cpy_test.DNode": n, "int": n}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Stats() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func BenchmarkPreserveAliasing(b *testing.B) {
+	shared := &Node{Name: "shared"}
+	src := []*Node{{Name: "a", Next: shared}, {Name: "b", Next: shared}}
+	for _, bb := range []struct {
+		name string
+		c    *cpy.Copier
+	}{
+		{"Default", cpy.New(cpy.IgnoreAllUnexported())},
+		{"PreserveAliasing", cpy.New(cpy.PreserveAliasing(), cpy.IgnoreAllUnexported())},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bb.c.Copy(src)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// defaultTagName is the default key of struct tags
+// that configure how a field is copied (see TagName).
+const defaultTagName = "cpy"
+
+// TagName specifies the key of struct tags that configure how a field is
+// copied, which is "cpy" by default. Tags of other keys are ignored.
+// If multiple TagName options are provided, the latter takes precedence.
+//
+// Example usage:
+//
+//	cpy.TagName("clone")
+//
+// This option specifies that fields are configured by tags such as
+// `clone:"-"` or `clone:"shallow"`, which allows migrating from another
+// library without editing every struct declaration.
+func TagName(name string) Option {
+	if name == "" || strings.ContainsAny(name, " \t\n\"`:") {
+		panic(fmt.Sprintf("cpy.TagName: invalid tag name %q", name))
+	}
+	return option{tagName: name}
+}
+
+// fieldTag is the parsed form of a cpy struct tag,
+// which is a comma-separated list of options (e.g., `cpy:"name=CustomerID"`).
+//
+// The options "-", "shallow", and "deep" control how the field is copied
+// (see the package documentation). Tags are only considered for fields
+// that are copied (i.e., exported fields and allowed unexported fields).
+type fieldTag struct {
+	// name is the name that the field is matched by when copying between
+	// struct types (see MatchFields). It is empty if not specified.
+	name string
+
+	// mode is how the field is copied.
+	mode tagMode
+
+	// deep and deepElem are the type information used to copy the field
+	// and the value it points to (if it is a pointer) for tagDeep,
+	// which ignore all options for these types.
+	deep, deepElem *typeInfo
+
+	// pathEnd reports whether the field may be the last field
+	// of a path provided to SkipPaths or FieldFunc.
+	pathEnd bool
+
+	// onlyPath reports whether the field may be excluded
+	// by the paths provided to OnlyPaths.
+	onlyPath bool
+}
+
+// tagMode is how a field is copied according to its tag.
+type tagMode int
+
+const (
+	tagDefault tagMode = iota
+	tagSkip            // `cpy:"-"`
+	tagShallow         // `cpy:"shallow"`
+	tagDeep            // `cpy:"deep"`
+	tagRedact          // `cpy:"redact"` or see RedactTag
+)
+
+// RedactTag specifies that fields with a struct tag of the provided key
+// that contains the provided value among its comma-separated options
+// are redacted in the copy, in addition to fields tagged `cpy:"redact"`.
+// A redacted field is left as zero in the copy, unless its value is non-zero
+// and a placeholder is provided for its type (see Placeholders).
+// Redaction takes precedence over all other tag options and all options
+// for the type of the field. When copying between different types
+// (see MatchFields), redacted source fields are never copied.
+//
+// Example usage:
+//
+//	cpy.RedactTag("secret", "true")
+//
+// This option specifies that every field tagged `secret:"true"`
+// (e.g., passwords or API tokens) never survives the copy,
+// which is suitable for copying values into audit logs.
+func RedactTag(key, value string) Option {
+	if key == "" || value == "" || strings.ContainsAny(key, " \t\n\"`:") {
+		panic(fmt.Sprintf("cpy.RedactTag: invalid tag %v:%q", key, value))
+	}
+	return option{redactTags: [][2]string{{key, value}}}
+}
+
+// Placeholders specifies that redacted fields (see RedactTag) with a
+// non-zero value are set to the provided value of the same type in the copy
+// (e.g., "[REDACTED]" for strings) instead of being left as zero.
+// Placeholders are shared by all copies and must not be mutated.
+// If multiple placeholders are provided for the same type,
+// the latter takes precedence.
+func Placeholders(vs ...interface{}) Option {
+	var opt option
+	for _, v := range vs {
+		if v == nil {
+			panic("cpy.Placeholders: placeholder must not be nil")
+		}
+		opt.placeholders = append(opt.placeholders, reflect.ValueOf(v))
+	}
+	return opt
+}
+
+// parseTag parses the tag of field f for the configured tag name.
+// Unknown options are ignored.
+func (c *Copier) parseTag(f reflect.StructField) fieldTag {
+	var ft fieldTag
+	for _, opt := range strings.Split(f.Tag.Get(c.tagName), ",") {
+		switch k, v, _ := strings.Cut(strings.TrimSpace(opt), "="); k {
+		case "name":
+			ft.name = v
+		case "-":
+			ft.mode = tagSkip
+		case "shallow":
+			ft.mode = tagShallow
+		case "deep":
+			ft.mode = tagDeep
+		case "redact":
+			ft.mode = tagRedact
+		}
+	}
+	for _, kv := range c.redactTags {
+		for _, opt := range strings.Split(f.Tag.Get(kv[0]), ",") {
+			if strings.TrimSpace(opt) == kv[1] {
+				ft.mode = tagRedact
+			}
+		}
+	}
+	return ft
+}
+
+// fieldTags returns the parsed tags of all fields of struct t indexed by
+// field, or nil if no field has a tag controlling how it is copied
+// nor may be affected by the paths provided to SkipPaths, OnlyPaths,
+// or FieldFunc.
+func (c *Copier) fieldTags(t reflect.Type) []fieldTag {
+	v, ok := c.fieldTagsCache.Load(t)
+	if !ok {
+		v, _ = c.fieldTagsCache.LoadOrStore(t, c.fieldTagsSlow(t))
+	}
+	return v.([]fieldTag)
+}
+func (c *Copier) fieldTagsSlow(t reflect.Type) []fieldTag {
+	tags := make([]fieldTag, t.NumField())
+	only := c.onlyTypes[t.Name()]
+	for i := 0; i < t.NumField() && !only && c.onlyFields != nil; i++ {
+		only = c.onlyFields[t.Field(i).Name]
+	}
+	found := only
+	for i := range tags {
+		f := t.Field(i)
+		if f.Tag != "" {
+			tags[i] = c.parseTag(f)
+		}
+		tags[i].pathEnd, tags[i].onlyPath = c.pathFields[f.Name], only
+		if tags[i].pathEnd {
+			found = true
+		}
+		switch tags[i].mode {
+		case tagDefault:
+			continue
+		case tagDeep:
+			tags[i].deep = &typeInfo{plain: c.isPlainSlow(f.Type)}
+			if f.Type.Kind() == reflect.Ptr {
+				tags[i].deepElem = &typeInfo{plain: c.isPlainSlow(f.Type.Elem())}
+			}
+		}
+		found = true
+	}
+	if !found {
+		return nil
+	}
+	return tags
+}
+
+// copyTagged copies the field src into dst according to tag,
+// reporting false if the field is copied according to the default behavior.
+// The dst field is zero unless copying into an existing destination.
+func (s *state) copyTagged(dst, src reflect.Value, tag fieldTag) bool {
+	if (tag.pathEnd && s.atPath(s.skipPaths)) || (tag.onlyPath && s.excluded()) {
+		dst.Set(reflect.Zero(dst.Type()))
+		return true
+	}
+	switch tag.mode {
+	case tagSkip:
+		dst.Set(reflect.Zero(dst.Type()))
+	case tagShallow:
+		dst.Set(src)
+	case tagRedact:
+		if p, ok := s.placeholders[dst.Type()]; ok && !src.IsZero() {
+			dst.Set(p)
+		} else {
+			dst.Set(reflect.Zero(dst.Type()))
+		}
+	case tagDeep:
+		dst.Set(reflect.Zero(dst.Type()))
+		s.copyDeep(dst, src, tag)
+	default:
+		return false
+	}
+	return true
+}
+
+// copyDeep copies the field src tagged "deep" into the zero field dst
+// according to the default behavior.
+func (s *state) copyDeep(dst, src reflect.Value, tag fieldTag) {
+	src = readable(src)
+	s.enter(src.Kind())
+	defer s.leave()
+	if tag.deepElem == nil || src.IsNil() {
+		s.copyValue(dst, src, tag.deep)
+		return
+	}
+	k := memoKey{src.UnsafePointer(), src.Type()}
+	if p, ok := s.copied(k); ok {
+		dst.Set(p)
+		return
+	}
+	if s.cyclic(k) {
+		s.copyCycle(dst, src)
+		return
+	}
+	et := src.Type().Elem()
+	s.alloc(int64(et.Size()))
+	p := reflect.New(et)
+	s.record(k, p)
+	if s.trackPaths {
+		s.push(PathStep{Type: et, Index: -1})
+		defer s.pop()
+	}
+	s.enter(et.Kind())
+	s.copyValue(p.Elem(), src.Elem(), tag.deepElem)
+	s.leave()
+	s.unrecord(k)
+	dst.Set(p)
+}
@@ -0,0 +1,168 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cpy/cpy"
+)
+
+type (
+	Settings struct {
+		Values map[string]string
+	}
+	Session struct {
+		ID       int
+		Cache    map[string][]byte `cpy:"-"`
+		Logger   *[]string         `cpy:"shallow"`
+		Settings *Settings         `cpy:"deep"`
+		Defaults *Settings
+	}
+)
+
+func TestFieldTags(t *testing.T) {
+	logger := []string{"started"}
+	src := &Session{
+		ID:       1,
+		Cache:    map[string][]byte{"k": []byte("v")},
+		Logger:   &logger,
+		Settings: &Settings{Values: map[string]string{"a": "b"}},
+		Defaults: &Settings{Values: map[string]string{"c": "d"}},
+	}
+	c := cpy.New(cpy.Shallow(new(Settings)), cpy.IgnoreAllUnexported())
+
+	got := c.Copy(src).(*Session)
+	want := &Session{ID: 1, Logger: &logger, Settings: src.Settings, Defaults: src.Defaults}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+	}
+	if got.Logger != src.Logger {
+		t.Errorf("Copy() did not share field tagged shallow")
+	}
+	if got.Settings == src.Settings || reflect.ValueOf(got.Settings.Values).Pointer() == reflect.ValueOf(src.Settings.Values).Pointer() {
+		t.Errorf("Copy() did not deep copy field tagged deep")
+	}
+	if got.Defaults != src.Defaults {
+		t.Errorf("Copy() did not apply cpy.Shallow to untagged field")
+	}
+
+	dst := &Session{Cache: map[string][]byte{"old": nil}, Settings: &Settings{}}
+	if err := cpy.New(cpy.ReuseDestination(), cpy.IgnoreAllUnexported()).CopyInto(dst, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if dst.Cache != nil || dst.Logger != src.Logger || dst.Settings == src.Settings || !cmp.Equal(dst.Settings, src.Settings) {
+		t.Errorf("CopyInto() with ReuseDestination = %+v, want fields copied according to tags", dst)
+	}
+
+	var strategies []cpy.Strategy
+	c.Plan(reflect.TypeOf(Session{})).Walk(func(path string, p *cpy.Plan) {
+		switch path {
+		case ".Cache", ".Logger", ".Settings", ".Settings*", ".Defaults":
+			strategies = append(strategies, p.Strategy)
+		}
+	})
+	wantStrategies := []cpy.Strategy{cpy.Ignore, cpy.Share, cpy.Deep, cpy.Deep, cpy.Share}
+	if diff := cmp.Diff(wantStrategies, strategies); diff != "" {
+		t.Errorf("Plan() strategies mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestUintptrHandles(t *testing.T) {
+	type Device struct {
+		Name   string
+		Handle uintptr
+		Event  uintptr `cpy:"-"`
+	}
+	src := &Device{Name: "tty", Handle: 3, Event: 4}
+	dups := map[uintptr]uintptr{3: 7}
+	c := cpy.New(cpy.FieldFunc("Device.Handle", func(h uintptr) uintptr { return dups[h] }), cpy.IgnoreAllUnexported())
+	got := c.Copy(src).(*Device)
+	want := &Device{Name: "tty", Handle: 7}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+	}
+
+	got = cpy.New(cpy.IgnoreAllUnexported()).Copy(src).(*Device)
+	if got.Handle != src.Handle || got.Event != 0 {
+		t.Errorf("Copy() = %+v, want Handle shared and Event zero", got)
+	}
+}
+
+func TestTagName(t *testing.T) {
+	type Job struct {
+		Name   string
+		Cache  []byte   `clone:"-"`
+		Inputs []string `cpy:"-"`
+	}
+	src := Job{Name: "build", Cache: []byte("cache"), Inputs: []string{"a"}}
+
+	got := cpy.New(cpy.TagName("clone"), cpy.IgnoreAllUnexported()).Copy(src).(Job)
+	want := Job{Name: "build", Inputs: []string{"a"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Copy() with TagName mismatch (-want +got):\n%s", diff)
+	}
+
+	got = cpy.New(cpy.IgnoreAllUnexported()).Copy(src).(Job)
+	want = Job{Name: "build", Cache: []byte("cache")}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Copy() without TagName mismatch (-want +got):\n%s", diff)
+	}
+
+	got = cpy.New(cpy.TagName("clone"), cpy.TagName("cpy"), cpy.IgnoreAllUnexported()).Copy(src).(Job)
+	if got.Inputs != nil || got.Cache == nil {
+		t.Errorf("Copy() did not use the latter TagName: %+v", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("TagName(%q) did not panic", "")
+		}
+	}()
+	cpy.TagName("")
+}
+
+func TestRedactTag(t *testing.T) {
+	type (
+		Credentials struct {
+			User     string
+			Password string            `secret:"true"`
+			Token    []byte            `cpy:"redact"`
+			Headers  map[string]string `json:"headers" secret:"log,true"`
+			Hint     string            `secret:"false"`
+		}
+		CredentialsDTO struct {
+			User     string
+			Password string
+		}
+	)
+	src := Credentials{User: "gopher", Password: "hunter2", Token: []byte("token"), Headers: map[string]string{"k": "v"}, Hint: "pets"}
+
+	got := cpy.New(cpy.IgnoreAllUnexported()).Copy(src).(Credentials)
+	want := Credentials{User: "gopher", Password: "hunter2", Headers: map[string]string{"k": "v"}, Hint: "pets"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Copy() mismatch (-want +got):\n%s", diff)
+	}
+
+	c := cpy.New(cpy.RedactTag("secret", "true"), cpy.Placeholders("[REDACTED]"), cpy.IgnoreAllUnexported())
+	got = c.Copy(src).(Credentials)
+	want = Credentials{User: "gopher", Password: "[REDACTED]", Hint: "pets"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Copy() with RedactTag mismatch (-want +got):\n%s", diff)
+	}
+	if got := c.Copy(Credentials{User: "gopher"}).(Credentials); got.Password != "" {
+		t.Errorf("Copy() set placeholder for zero field: %q", got.Password)
+	}
+
+	var dto CredentialsDTO
+	if err := cpy.New(cpy.RedactTag("secret", "true"), cpy.MatchFields(), cpy.IgnoreAllUnexported()).CopyInto(&dto, src); err != nil {
+		t.Fatalf("CopyInto() error: %v", err)
+	}
+	if diff := cmp.Diff(CredentialsDTO{User: "gopher"}, dto); diff != "" {
+		t.Errorf("CopyInto() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpy
+
+import (
+	"reflect"
+	"sort"
+	"unsafe"
+)
+
+// layoutStep is a step in copying a struct using unsafe.
+type layoutStep struct {
+	offset uintptr
+	size   uintptr      // only valid for block copies
+	typ    reflect.Type // nil for block copies
+	field  int          // index of the field; only valid if typ is non-nil
+}
+
+// copyStructUnsafe copies the struct src into dst,
+// which must both be addressable (see stage).
+func (s *state) copyStructUnsafe(dst, src reflect.Value) {
+	dstPtr := unsafe.Pointer(dst.UnsafeAddr())
+	srcPtr := unsafe.Pointer(src.UnsafeAddr())
+	for _, step := range s.structLayout(src.Type()) {
+		dstField := unsafe.Add(dstPtr, step.offset)
+		srcField := unsafe.Add(srcPtr, step.offset)
+		if step.typ == nil {
+			// The block contains no pointers,
+			// so it is safe to copy it as raw memory.
+			copy(unsafe.Slice((*byte)(dstField), step.size), unsafe.Slice((*byte)(srcField), step.size))
+			continue
+		}
+		if s.trackPaths {
+			s.push(PathStep{Type: step.typ, Field: src.Type().Field(step.field).Name, Index: -1})
+			s.copyTo(reflect.NewAt(step.typ, dstField).Elem(), reflect.NewAt(step.typ, srcField).Elem())
+			s.pop()
+			continue
+		}
+		s.copyTo(reflect.NewAt(step.typ, dstField).Elem(), reflect.NewAt(step.typ, srcField).Elem())
+	}
+}
+
+// readable returns v such that it may be used in calls to Set and Interface.
+// Values obtained through unexported struct fields are flagged as read-only
+// by the reflect package, which is cleared by reconstructing the value
+// from its address. Such values are always addressable since
+// unexported fields are only accessed through staged structs.
+func readable(v reflect.Value) reflect.Value {
+	if v.CanInterface() || !v.CanAddr() {
+		return v
+	}
+	return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+}
+
+// structLayout returns a list of steps for copying the exported fields
+// (and unexported fields permitted by allowedFields) of struct t,
+// where adjacent fields that are pointer-free and
+// need no deep copy are merged into a single block copy.
+func (c *Copier) structLayout(t reflect.Type) []layoutStep {
+	v, ok := c.structLayoutCache.Load(t)
+	if !ok {
+		v, _ = c.structLayoutCache.LoadOrStore(t, c.structLayoutSlow(t))
+	}
+	return v.([]layoutStep)
+}
+func (c *Copier) structLayoutSlow(t reflect.Type) []layoutStep {
+	fields := c.exportedFields(t)
+	if allowed := c.allowedFields(t); len(allowed) > 0 {
+		fields = append(append([]int(nil), fields...), allowed...)
+		sort.Ints(fields)
+	}
+	var steps []layoutStep
+	for _, i := range fields {
+		f := t.Field(i)
+		if f.Type.Size() == 0 {
+			continue
+		}
+		// Middleware must visit every field, so none are block copied.
+		if !c.isPlain(f.Type) || !pointerFree(f.Type) || len(c.middleware) > 0 {
+			steps = append(steps, layoutStep{offset: f.Offset, typ: f.Type, field: i})
+			continue
+		}
+		// Extend the previous block copy if it is adjacent to this field.
+		// Any padding between the two is copied as well, which is harmless.
+		if n := len(steps); n > 0 && steps[n-1].typ == nil && adjacent(t, steps[n-1], f) {
+			steps[n-1].size = f.Offset + f.Type.Size() - steps[n-1].offset
+			continue
+		}
+		steps = append(steps, layoutStep{offset: f.Offset, size: f.Type.Size()})
+	}
+	return steps
+}
+
+// adjacent reports whether no other fields exist in struct t
+// between the end of the block copy and the start of field f.
+func adjacent(t reflect.Type, block layoutStep, f reflect.StructField) bool {
+	for i := 0; i < f.Index[0]; i++ {
+		if g := t.Field(i); g.Type.Size() > 0 && g.Offset >= block.offset+block.size {
+			return false
+		}
+	}
+	return true
+}
+
+// pointerFree reports whether values of type t contain no pointers.
+func pointerFree(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return t.Len() == 0 || pointerFree(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !pointerFree(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/google/go-cpy
 
-go 1.17
+go 1.18
 
 require github.com/google/go-cmp v0.5.6
 